@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/natindo/CalVigil/internal/console"
+)
+
+const consoleUsage = `использование: CalVigil console [chat-id]
+  Бот работает в терминале с базой из конфигурации, без Telegram и токена.
+  chat-id — чат, от имени которого идёт переписка (по умолчанию 1);
+  напоминания приходят только по событиям этого чата.`
+
+// consoleChatID разбирает аргументы подкоманды console
+func consoleChatID(args []string) (int64, error) {
+	switch len(args) {
+	case 0:
+		return console.DefaultChatID, nil
+	case 1:
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil || id == 0 {
+			return 0, fmt.Errorf("неверный chat-id %q\n%s", args[0], consoleUsage)
+		}
+		return id, nil
+	}
+	return 0, fmt.Errorf("лишние аргументы\n%s", consoleUsage)
+}
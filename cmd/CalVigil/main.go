@@ -2,37 +2,186 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/natindo/CalVigil/internal/bot"
 	"github.com/natindo/CalVigil/internal/config"
+	"github.com/natindo/CalVigil/internal/console"
 	"github.com/natindo/CalVigil/internal/database"
+	"github.com/natindo/CalVigil/internal/matrix"
 	"github.com/natindo/CalVigil/internal/services"
+	"github.com/natindo/CalVigil/internal/telegram"
 )
 
 func main() {
-	// 1. Читаем конфиг (из env или из файла — как удобнее)
-	cfg := config.LoadConfig()
+	// 1. Читаем конфиг: файл, переменные окружения и флаги; при ошибках
+	// выводим сразу весь список и не запускаемся
+	cfg, err := config.Load(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// CalVigil migrate ... — управление схемой БД вместо запуска бота
+	if len(cfg.Args) > 0 && cfg.Args[0] == "migrate" {
+		if err := runMigrate(cfg, cfg.Args[1:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
+	// CalVigil console [chat-id] — тот же бот в терминале вместо мессенджера
+	consoleMode := len(cfg.Args) > 0 && cfg.Args[0] == "console"
+	var consoleChat int64
+	if consoleMode {
+		if consoleChat, err = consoleChatID(cfg.Args[1:]); err != nil {
+			log.Fatalf("console: %v", err)
+		}
+	}
+
+	if cfg.DefaultTimezone != "" {
+		loc, err := services.ParseTimezone(cfg.DefaultTimezone)
+		if err != nil {
+			log.Fatalf("default_timezone: %v", err)
+		}
+		services.DefaultLocation = loc
+	}
+	bot.DefaultReminder = cfg.DefaultReminder
+
+	// Контекст отменяется по Ctrl+C или SIGTERM: бот перестаёт получать апдейты,
+	// дообрабатывает начатое и закрывает БД. Повторный сигнал завершает процесс сразу.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, func() {
+		stop()
+		log.Println("Получен сигнал остановки, завершаем работу")
+	})
 
-	// 2. Подключаемся к БД
-	dbConn, err := database.ConnectPostgres(cfg.DatabaseURL)
+	// 2. Подключаемся к БД: пул соединений общий для обработчиков и notifier-а
+	var dbOpts []database.Option
+	if cfg.RequireLatestSchema {
+		dbOpts = append(dbOpts, database.RequireLatestSchema())
+	}
+	pool, err := database.ConnectPostgres(ctx, cfg.DatabaseURL, dbOpts...)
 	if err != nil {
 		log.Fatalf("Не удалось подключиться к PostgreSQL: %v", err)
 	}
-	ctx := context.Background()
-	defer dbConn.Close(ctx)
+	if err := database.CheckSchema(ctx, pool); errors.Is(err, database.ErrSchemaOutdated) {
+		log.Printf("Внимание: %v", err)
+	} else if err != nil {
+		log.Printf("Не удалось проверить версию схемы: %v", err)
+	}
 
-	// 3. Создаём инстанс бота
-	botAPI, err := bot.NewBot(cfg.TelegramToken)
-	if err != nil {
-		log.Fatalf("Ошибка при создании бота: %v", err)
+	repo := services.NewPgRepository(pool, cfg.DBQueryTimeout, cfg.DialogTTL)
+
+	// 3. Выбираем транспорт: Telegram (long polling или вебхук), Matrix или терминал
+	opts := bot.Options{
+		Workers:         cfg.Workers,
+		ShutdownTimeout: cfg.ShutdownTimeout,
+	}
+	notifierOpts := services.NotifierOptions{
+		Interval:   cfg.NotifierInterval,
+		LateWindow: cfg.NotifierLateWindow,
+	}
+	var notify func(ctx context.Context)
+	var serve func(ctx context.Context) error
+	if consoleMode {
+		term := console.New(os.Stdin, os.Stdout, consoleChat)
+		fmt.Printf("CalVigil в консоли, чат %d.\n%s\n", consoleChat, console.Usage)
+		notify = func(ctx context.Context) {
+			services.StartChatNotifier(ctx, term, repo, notifierOpts, consoleChat)
+		}
+		serve = func(ctx context.Context) error {
+			return bot.Serve(ctx, term, repo, opts, term.Receive)
+		}
+	} else if cfg.Platform == config.PlatformMatrix {
+		client, err := matrix.Connect(ctx, matrix.Options{
+			Homeserver: cfg.MatrixHomeserver,
+			Token:      cfg.MatrixToken,
+			Chats:      repo,
+		})
+		if err != nil {
+			log.Fatalf("Не удалось подключиться к Matrix: %v", err)
+		}
+		log.Printf("Бот %s подключён к %s", client.UserID(), cfg.MatrixHomeserver)
+		notify = func(ctx context.Context) {
+			services.StartNotifier(ctx, client, repo, notifierOpts)
+		}
+		serve = func(ctx context.Context) error {
+			return bot.Serve(ctx, client, repo, opts, client.Receive)
+		}
+	} else {
+		botAPI, err := telegram.NewBot(cfg.TelegramToken)
+		if err != nil {
+			log.Fatalf("Ошибка при создании бота: %v", err)
+		}
+		var webhook *telegram.WebhookOptions
+		if cfg.Mode == config.ModeWebhook {
+			webhook = &telegram.WebhookOptions{
+				URL:         cfg.WebhookURL,
+				Listen:      cfg.WebhookListen,
+				SecretToken: cfg.WebhookSecret,
+				CertFile:    cfg.WebhookTLSCert,
+				KeyFile:     cfg.WebhookTLSKey,
+			}
+		}
+		notify = func(ctx context.Context) {
+			services.StartNotifier(ctx, telegram.NewMessenger(botAPI), repo, notifierOpts)
+		}
+		serve = func(ctx context.Context) error {
+			return telegram.Run(ctx, botAPI, repo, opts, webhook)
+		}
 	}
 
 	// 4. Запускаем воркер уведомлений (notifier)
-	go services.StartNotifier(botAPI, dbConn)
+	runCtx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+	notifierDone := make(chan struct{})
+	go func() {
+		defer close(notifierDone)
+		notify(runCtx)
+	}()
+
+	// 5. Запускаем основной цикл обработки; он возвращается после остановки
+	// и дообработки полученных апдейтов (в консоли — и по концу ввода)
+	runErr := serve(runCtx)
+
+	// 6. Останавливаем notifier (начатая отправка доводится до конца) и закрываем пул.
+	// Ждём не дольше shutdown_timeout: зависший запрос не должен держать процесс
+	cancelRun()
+	shutdownTimeout := cfg.ShutdownTimeout
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = bot.DefaultShutdownTimeout
+	}
+	deadline := time.After(shutdownTimeout)
+	select {
+	case <-notifierDone:
+		poolClosed := make(chan struct{})
+		go func() {
+			defer close(poolClosed)
+			pool.Close()
+		}()
+		select {
+		case <-poolClosed:
+		case <-deadline:
+			log.Printf("Пул соединений с БД не закрылся за %v, завершаем без него", shutdownTimeout)
+		}
+	case <-deadline:
+		log.Printf("Notifier не остановился за %v, завершаем без него", shutdownTimeout)
+	}
 
-	// 5. Запускаем основной цикл обработки
-	if err := bot.Run(botAPI, dbConn); err != nil {
-		log.Fatalf("Ошибка запуска бота: %v", err)
+	if runErr != nil {
+		log.Fatalf("Ошибка запуска бота: %v", runErr)
 	}
+	log.Println("Бот остановлен")
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/natindo/CalVigil/internal/config"
+	"github.com/natindo/CalVigil/internal/database"
+)
+
+const migrateUsage = `использование: CalVigil migrate [команда]
+  up          применить все новые миграции (по умолчанию)
+  down [N]    откатить N последних миграций (по умолчанию 1)
+  to <V>      привести схему к версии V (0 — откатить всё)
+  status      показать текущую и последнюю версии схемы`
+
+// runMigrate выполняет подкоманду migrate. Проверка версии схемы при подключении
+// не делается — именно эта команда схему и обновляет.
+func runMigrate(cfg *config.Config, args []string) error {
+	cmd := "up"
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	var steps, target int
+	switch {
+	case cmd == "up" || cmd == "status":
+		if len(args) != 0 {
+			return fmt.Errorf("лишние аргументы\n%s", migrateUsage)
+		}
+	case cmd == "down" && len(args) <= 1:
+		steps = 1
+		if len(args) == 1 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				return fmt.Errorf("неверное число миграций %q\n%s", args[0], migrateUsage)
+			}
+			steps = n
+		}
+	case cmd == "to" && len(args) == 1:
+		v, err := strconv.Atoi(args[0])
+		if err != nil || v < 0 {
+			return fmt.Errorf("неверная версия %q\n%s", args[0], migrateUsage)
+		}
+		target = v
+	default:
+		return fmt.Errorf("неизвестная команда %q\n%s", cmd, migrateUsage)
+	}
+
+	ctx := context.Background()
+	pool, err := database.ConnectPostgres(ctx, cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	var done []int
+	switch cmd {
+	case "status":
+		current, err := database.SchemaVersion(ctx, pool)
+		if err != nil {
+			return err
+		}
+		latest, err := database.LatestVersion()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("версия схемы: %d, последняя миграция: %d\n", current, latest)
+		return nil
+	case "up":
+		done, err = database.MigrateUp(ctx, pool)
+	case "down":
+		done, err = database.MigrateDown(ctx, pool, steps)
+	case "to":
+		done, err = database.MigrateTo(ctx, pool, target)
+	}
+	for _, v := range done {
+		fmt.Printf("миграция %d: готово\n", v)
+	}
+	if err != nil {
+		return err
+	}
+	if len(done) == 0 {
+		fmt.Println("схема уже в нужной версии")
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+	"github.com/natindo/CalVigil/internal/models"
+	"github.com/natindo/CalVigil/internal/services"
+)
+
+// Callback-действия просмотра расписания:
+//
+//	ag:w:2025-01-13:0 — показать период (d — день, w — неделя, m — месяц), содержащий дату, страница 0
+//	ag:noop           — нажатие на номер страницы
+const (
+	agendaAction = "ag"
+	agendaDay    = "d"
+	agendaWeek   = "w"
+	agendaMonth  = "m"
+	agendaNoop   = "noop"
+)
+
+var monthNamesGenRu = [...]string{
+	"января", "февраля", "марта", "апреля", "мая", "июня",
+	"июля", "августа", "сентября", "октября", "ноября", "декабря",
+}
+
+// cmdAgenda показывает события за день, неделю или месяц, содержащие указанную дату
+// (по умолчанию — сегодня): /agenda [YYYY-MM-DD], /week [YYYY-MM-DD], /month [YYYY-MM-DD]
+func cmdAgenda(ctx context.Context, bot messenger.Messenger, repo services.Store, msg *messenger.Message, view string) {
+	date := chatNow(ctx, repo, msg.ChatID)
+	if arg := strings.TrimSpace(msg.CommandArguments()); arg != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", arg, date.Location())
+		if err != nil {
+			bot.SendMessage(msg.ChatID, "Не удалось распознать дату, формат YYYY-MM-DD.", nil)
+			return
+		}
+		date = parsed
+	}
+
+	text, keyboard, err := renderAgenda(ctx, repo, msg.ChatID, view, date, 0)
+	if err != nil {
+		log.Println("Ошибка при GetEventsInRange:", err)
+		bot.SendMessage(msg.ChatID, "Ошибка при получении списка событий", nil)
+		return
+	}
+	bot.SendMessage(msg.ChatID, text, keyboard)
+}
+
+// handleAgendaNav обрабатывает листание периодов и страниц; сообщение редактируется на месте.
+// Формат callback_data: ag:<d|w|m>:<YYYY-MM-DD>:<страница>
+func handleAgendaNav(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, cq *messenger.Callback, args []string) {
+	if len(args) == 1 && args[0] == agendaNoop {
+		bot.AnswerCallback(cq.ID, "")
+		return
+	}
+	if len(args) != 3 {
+		bot.AnswerCallback(cq.ID, "Неизвестное действие")
+		return
+	}
+	date, err1 := time.ParseInLocation("2006-01-02", args[1], chatLocation(ctx, repo, chatID))
+	page, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		bot.AnswerCallback(cq.ID, "Неизвестное действие")
+		return
+	}
+
+	text, keyboard, err := renderAgenda(ctx, repo, chatID, args[0], date, page)
+	if err != nil {
+		log.Println("Ошибка при GetEventsInRange:", err)
+		bot.AnswerCallback(cq.ID, "Ошибка при получении списка событий")
+		return
+	}
+	bot.AnswerCallback(cq.ID, "")
+
+	if err := bot.EditMessage(chatID, cq.MessageID, text, keyboard); err != nil {
+		log.Println("Не удалось отредактировать расписание:", err)
+	}
+}
+
+// agendaPeriod возвращает границы периода view, содержащего date, и соседние периоды
+func agendaPeriod(view string, date time.Time) (from, to, prev time.Time) {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	switch view {
+	case agendaWeek:
+		from = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		return from, from.AddDate(0, 0, 7), from.AddDate(0, 0, -7)
+	case agendaMonth:
+		from = time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+		return from, from.AddDate(0, 1, 0), from.AddDate(0, -1, 0)
+	default:
+		return day, day.AddDate(0, 0, 1), day.AddDate(0, 0, -1)
+	}
+}
+
+// renderAgenda собирает страницу расписания и клавиатуру листания.
+// Границы периода считаются в поясе date (поясе чата).
+func renderAgenda(ctx context.Context, repo services.EventRepository, chatID int64, view string, date time.Time, page int) (string, messenger.Keyboard, error) {
+	from, to, prev := agendaPeriod(view, date)
+	evs, err := repo.GetEventsInRange(ctx, chatID, from, to)
+	if err != nil {
+		return "", nil, err
+	}
+
+	title := agendaTitle(view, from, to)
+	blocks := agendaBlocks(view, evs, from, to)
+	// Заголовок и номер страницы повторяются на каждой странице
+	pages := splitText(blocks, messageLimit-textLen(title)-20)
+	if len(pages) == 0 {
+		pages = []string{"Событий нет."}
+	}
+	page = min(max(page, 0), len(pages)-1)
+
+	text := title + "\n\n" + pages[page]
+	if len(pages) > 1 {
+		text = fmt.Sprintf("%s (стр. %d/%d)\n\n%s", title, page+1, len(pages), pages[page])
+	}
+
+	data := func(d time.Time, p int) string {
+		return makeCallbackData(agendaAction, view, d.Format("2006-01-02"), strconv.Itoa(p))
+	}
+	rows := [][]messenger.Button{
+		messenger.NewRow(
+			messenger.NewButton("◀", data(prev, 0)),
+			messenger.NewButton("Сегодня", data(time.Now().In(from.Location()), 0)),
+			messenger.NewButton("▶", data(to, 0)),
+		),
+	}
+	if len(pages) > 1 {
+		rows = append(rows, messenger.NewRow(
+			messenger.NewButton("‹", data(from, max(page-1, 0))),
+			messenger.NewButton(fmt.Sprintf("%d/%d", page+1, len(pages)),
+				makeCallbackData(agendaAction, agendaNoop)),
+			messenger.NewButton("›", data(from, min(page+1, len(pages)-1))),
+		))
+	}
+	return text, messenger.NewKeyboard(rows...), nil
+}
+
+// agendaTitle — заголовок периода: «Пн, 13 января 2025», «Неделя 13 – 19 января 2025», «Январь 2025»
+func agendaTitle(view string, from, to time.Time) string {
+	switch view {
+	case agendaWeek:
+		last := to.AddDate(0, 0, -1)
+		if from.Month() == last.Month() {
+			return fmt.Sprintf("Неделя %d – %d %s %d", from.Day(), last.Day(), monthNamesGenRu[last.Month()-1], last.Year())
+		}
+		return fmt.Sprintf("Неделя %s – %s %d", dayMonth(from), dayMonth(last), last.Year())
+	case agendaMonth:
+		return fmt.Sprintf("%s %d", monthNamesRu[from.Month()-1], from.Year())
+	default:
+		return fmt.Sprintf("%s, %s %d", weekdayHeaderRu[(int(from.Weekday())+6)%7], dayMonth(from), from.Year())
+	}
+}
+
+// agendaBlocks группирует события по дням: блок — заголовок дня и его события.
+// Событие, начавшееся до периода (например, ночное с переходом через полночь),
+// показывается в первый день периода.
+func agendaBlocks(view string, evs []models.Event, from, to time.Time) []string {
+	var blocks []string
+	var sb strings.Builder
+	var current time.Time
+	for _, e := range evs {
+		day := startOfDay(e.StartTime.In(from.Location()))
+		if day.Before(from) {
+			day = from
+		}
+		if !day.Equal(current) {
+			if sb.Len() > 0 {
+				blocks = append(blocks, sb.String()+"\n")
+				sb.Reset()
+			}
+			current = day
+			if view != agendaDay {
+				sb.WriteString(fmt.Sprintf("%s, %s\n", weekdayHeaderRu[(int(day.Weekday())+6)%7], dayMonth(day)))
+			}
+		}
+		sb.WriteString(agendaLine(e, day) + "\n")
+	}
+	if sb.Len() > 0 {
+		blocks = append(blocks, sb.String())
+	}
+	return blocks
+}
+
+// agendaLine — строка события; даты указываются, только если событие выходит за день day
+func agendaLine(e models.Event, day time.Time) string {
+	start := e.StartTime.In(day.Location())
+	end := e.EndTime.In(day.Location())
+
+	var span string
+	if start.Equal(startOfDay(start)) && !end.Before(start.AddDate(0, 0, 1)) && end.Equal(startOfDay(end)) {
+		span = "весь день"
+		if end.After(start.AddDate(0, 0, 1)) {
+			span += ", до " + dayMonth(end.AddDate(0, 0, -1))
+		}
+	} else {
+		span = clockOn(start, day) + " - " + clockOn(end, day)
+	}
+
+	repeat := ""
+	if e.IsRecurring() {
+		repeat = " 🔁"
+	}
+	return fmt.Sprintf("%s | %s%s (ID=%d)", span, e.Title, repeat, e.ID)
+}
+
+// clockOn — «15:04», если t в день day, иначе «02.01 15:04»
+func clockOn(t, day time.Time) string {
+	if startOfDay(t).Equal(day) {
+		return t.Format("15:04")
+	}
+	return t.Format("02.01 15:04")
+}
+
+func dayMonth(t time.Time) string {
+	return fmt.Sprintf("%d %s", t.Day(), monthNamesGenRu[t.Month()-1])
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
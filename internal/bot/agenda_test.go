@@ -0,0 +1,175 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+	"github.com/natindo/CalVigil/internal/models"
+	"github.com/natindo/CalVigil/internal/services"
+)
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		name   string
+		blocks []string
+		limit  int
+		want   []string
+	}{
+		{"всё на одной странице", []string{"ab\n", "cd\n"}, 10, []string{"ab\ncd"}},
+		{"блок не разрывается", []string{"abc\n", "defg\n"}, 6, []string{"abc", "defg"}},
+		{"длинный блок делится по строкам", []string{"ab\ncd\nef\n"}, 6, []string{"ab\ncd", "ef"}},
+		{"длинная строка делится по символам", []string{"abcdefgh"}, 3, []string{"abc", "def", "gh"}},
+		// Кириллица — два байта, но одна единица UTF-16
+		{"кириллица считается символами", []string{"абв\n", "где\n"}, 8, []string{"абв\nгде"}},
+		{"кириллица на границе", []string{"абвгдеж"}, 3, []string{"абв", "где", "ж"}},
+		// Эмодзи — суррогатная пара, две единицы UTF-16: не помещается — переносится целиком
+		{"суррогатная пара на границе", []string{"абв😀где"}, 4, []string{"абв", "😀гд", "е"}},
+		{"суррогатная пара ровно по границе", []string{"аб😀\n", "в\n"}, 4, []string{"аб😀", "в"}},
+		{"пусто", nil, 10, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitText(tt.blocks, tt.limit)
+			if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+				t.Errorf("splitText(%q, %d) = %q, want %q", tt.blocks, tt.limit, got, tt.want)
+			}
+			for _, page := range got {
+				if textLen(page) > tt.limit || !utf8.ValidString(page) {
+					t.Errorf("страница %q: %d единиц UTF-16, валидная: %v", page, textLen(page), utf8.ValidString(page))
+				}
+			}
+		})
+	}
+}
+
+// rangeStore отдаёт renderAgenda заранее заданные события
+type rangeStore struct {
+	services.EventRepository
+	events []models.Event
+}
+
+func (s rangeStore) GetEventsInRange(_ context.Context, _ int64, from, to time.Time) ([]models.Event, error) {
+	var result []models.Event
+	for _, e := range s.events {
+		if !e.StartTime.Before(from) && e.StartTime.Before(to) {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+// buttonData возвращает callback_data кнопки с текстом label
+func buttonData(t *testing.T, kb messenger.Keyboard, label string) string {
+	t.Helper()
+	for _, row := range kb {
+		for _, b := range row {
+			if b.Text == label {
+				return b.Data
+			}
+		}
+	}
+	t.Fatalf("нет кнопки %q в %v", label, kb)
+	return ""
+}
+
+func TestRenderAgendaPeriodNav(t *testing.T) {
+	tests := []struct {
+		view       string
+		date       time.Time
+		title      string
+		prev, next string
+	}{
+		{agendaDay, time.Date(2025, 3, 1, 15, 0, 0, 0, time.UTC), "Сб, 1 марта 2025", "ag:d:2025-02-28:0", "ag:d:2025-03-02:0"},
+		{agendaWeek, time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC), "Неделя 30 декабря – 5 января 2025", "ag:w:2024-12-23:0", "ag:w:2025-01-06:0"},
+		{agendaMonth, time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC), "Февраль 2024", "ag:m:2024-01-01:0", "ag:m:2024-03-01:0"},
+	}
+	for _, tt := range tests {
+		text, kb, err := renderAgenda(context.Background(), rangeStore{}, 1, tt.view, tt.date, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tt.title + "\n\nСобытий нет."; text != want {
+			t.Errorf("%s: текст %q, want %q", tt.view, text, want)
+		}
+		if got := buttonData(t, kb, "◀"); got != tt.prev {
+			t.Errorf("%s: ◀ = %s, want %s", tt.view, got, tt.prev)
+		}
+		if got := buttonData(t, kb, "▶"); got != tt.next {
+			t.Errorf("%s: ▶ = %s, want %s", tt.view, got, tt.next)
+		}
+		if len(kb) != 1 {
+			t.Errorf("%s: на одной странице есть листание: %v", tt.view, kb)
+		}
+	}
+}
+
+func TestRenderAgendaPages(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var store rangeStore
+	for i := 0; i < 300; i++ {
+		start := from.Add(time.Duration(i) * 2 * time.Hour)
+		store.events = append(store.events, models.Event{
+			ID:        i + 1,
+			Title:     strings.Repeat("Совещание 📅 ", 5),
+			StartTime: start,
+			EndTime:   start.Add(time.Hour),
+		})
+	}
+	render := func(page int) (string, messenger.Keyboard) {
+		text, kb, err := renderAgenda(context.Background(), store, 1, agendaMonth, from, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return text, kb
+	}
+
+	first, kb := render(0)
+	var pages int
+	if _, err := fmt.Sscanf(buttonData(t, kb, "◀")+" "+kb[1][1].Text, "ag:m:2024-12-01:0 1/%d", &pages); err != nil || pages < 3 {
+		t.Fatalf("страниц: %d, %v; клавиатура %v", pages, err, kb)
+	}
+	seen := map[int]int{}
+	for page := 0; page < pages; page++ {
+		text, kb := render(page)
+		if page == 0 && text != first {
+			t.Error("первая страница отличается при повторной отрисовке")
+		}
+		if textLen(text) > messageLimit {
+			t.Errorf("страница %d длиной %d", page, textLen(text))
+		}
+		if want := fmt.Sprintf("Январь 2025 (стр. %d/%d)", page+1, pages); !strings.HasPrefix(text, want) {
+			t.Errorf("страница %d: заголовок %q", page, strings.SplitN(text, "\n", 2)[0])
+		}
+		prev, next := fmt.Sprintf("ag:m:2025-01-01:%d", max(page-1, 0)), fmt.Sprintf("ag:m:2025-01-01:%d", min(page+1, pages-1))
+		if got := buttonData(t, kb, "‹"); got != prev {
+			t.Errorf("страница %d: ‹ = %s, want %s", page, got, prev)
+		}
+		if got := buttonData(t, kb, "›"); got != next {
+			t.Errorf("страница %d: › = %s, want %s", page, got, next)
+		}
+		for _, e := range store.events {
+			if strings.Contains(text, fmt.Sprintf("(ID=%d)", e.ID)) {
+				seen[e.ID]++
+			}
+		}
+	}
+	if len(seen) != len(store.events) {
+		t.Errorf("показано событий: %d из %d", len(seen), len(store.events))
+	}
+	for id, n := range seen {
+		if n != 1 {
+			t.Errorf("событие %d показано %d раз", id, n)
+		}
+	}
+
+	// Номер за пределами — последняя страница
+	last, _ := render(pages - 1)
+	if beyond, _ := render(pages + 5); beyond != last {
+		t.Error("страница за пределами не приведена к последней")
+	}
+}
@@ -1,67 +1,118 @@
 package bot
 
 import (
-	"fmt"
+	"context"
 	"log"
+	"time"
 
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/jackc/pgx/v5"
+	"github.com/natindo/CalVigil/internal/messenger"
+	"github.com/natindo/CalVigil/internal/services"
 )
 
-// NewBot инициализирует и возвращает *tgbotapi.BotAPI
-func NewBot(token string) (*tgbotapi.BotAPI, error) {
-	bot, err := tgbotapi.NewBotAPI(token)
-	if err != nil {
-		return nil, err
+// Commands — меню команд бота; Serve регистрирует его через Messenger.SetCommands
+var Commands = []messenger.Command{
+	{Name: "start", Description: "Запустить бота"},
+	{Name: "help", Description: "Справка"},
+	{Name: "list", Description: "Показать события на сегодня"},
+	{Name: "agenda", Description: "События за день"},
+	{Name: "week", Description: "События за неделю"},
+	{Name: "month", Description: "События за месяц"},
+	{Name: "create", Description: "Создать событие"},
+	{Name: "cancel", Description: "Прервать создание или изменение события"},
+	{Name: "add", Description: "Создать событие одной строкой"},
+	{Name: "delete", Description: "Удалить событие"},
+	{Name: "update", Description: "Изменить событие"},
+	{Name: "timezone", Description: "Часовой пояс чата"},
+}
+
+// updateTimeout — сколько может обрабатываться один апдейт, включая все запросы к БД
+const updateTimeout = 30 * time.Second
+
+// DefaultShutdownTimeout — сколько Serve дообрабатывает полученные апдейты после остановки
+const DefaultShutdownTimeout = 30 * time.Second
+
+// Options — настройки основного цикла; нулевые значения заменяются значениями по умолчанию
+type Options struct {
+	// Workers — сколько апдейтов обрабатывается одновременно
+	Workers int
+	// ShutdownTimeout — срок на дообработку апдейтов после отмены ctx
+	ShutdownTimeout time.Duration
+}
+
+// Receiver получает апдейты и передаёт их в dispatch, пока не отменён ctx или
+// не кончились апдейты. dispatch возвращает false, если бот уже останавливается.
+type Receiver func(ctx context.Context, dispatch func(messenger.Update) bool) error
+
+// Serve — основной цикл поверх произвольного транспорта: апдейты приходят из receive,
+// ответы уходят через bot, а обрабатываются в opts.Workers воркерах. Апдейты разных
+// чатов обрабатываются параллельно, одного чата — по порядку. Когда ctx отменён,
+// Serve перестаёт получать апдейты и дообрабатывает уже полученные в течение
+// opts.ShutdownTimeout; после этого не начатые апдейты отбрасываются, а запросы к БД
+// начатых прерываются. Serve возвращается и тогда, когда receive вернулся сам
+// (например, в консоли закончился ввод).
+func Serve(ctx context.Context, bot messenger.Messenger, repo services.Store, opts Options, receive Receiver) error {
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = DefaultShutdownTimeout
 	}
-	// Можно включить Debug-логирование:
-	bot.Debug = false
-	commands := []tgbotapi.BotCommand{
-		{Command: "start", Description: "Запустить бота"},
-		{Command: "help", Description: "Справка"},
-		{Command: "list", Description: "Показать события на сегодня"},
-		{Command: "create", Description: "Создать событие"},
-		{Command: "delete", Description: "Удалить событие"},
-		{Command: "update", Description: "Изменить событие"},
+	if err := bot.SetCommands(Commands); err != nil {
+		log.Printf("Ошибка при установке команд: %v", err)
 	}
 
-	config := tgbotapi.NewSetMyCommands(commands...)
-	_, err = bot.Request(config)
-	if err != nil {
-		log.Fatalf("Ошибка при установке команд: %v", err)
-	}
-	fmt.Printf("Бот %s успешно инициализирован\n", bot.Self.UserName)
-	return bot, nil
+	// Обработчики работают в своём контексте: отмена ctx не прерывает начатый апдейт
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+	d := newDispatcher(opts.Workers, func(ctx context.Context, update messenger.Update) {
+		handleUpdate(ctx, bot, repo, update)
+	})
+	d.Start(workCtx)
+
+	err := receive(ctx, d.Dispatch)
+	shutdown(d, opts.ShutdownTimeout, cancelWork)
+	return err
 }
 
-// Run запускает основной цикл: чтение апдейтов и их обработку
-func Run(bot *tgbotapi.BotAPI, dbConn *pgx.Conn) error {
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+// shutdown дожидается очередей диспетчера, а по истечении timeout прерывает обработчики
+func shutdown(d *dispatcher, timeout time.Duration, cancelWork context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := d.Shutdown(ctx); err != nil {
+		log.Printf("Апдейты не дообработаны за %s, прерываем обработчики", timeout)
+		cancelWork()
+		d.Wait()
+	}
+}
 
-	updates := bot.GetUpdatesChan(u)
-	// if err != nil {
-	// 	return err
-	// }
+// handleUpdate обрабатывает один апдейт; запросы к БД прерываются через updateTimeout
+func handleUpdate(ctx context.Context, bot messenger.Messenger, repo services.Store, update messenger.Update) {
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
 
-	for update := range updates {
-		// Inline-кнопки (CallbackQuery)
-		if update.CallbackQuery != nil {
-			HandleCallbackQuery(bot, dbConn, update.CallbackQuery)
-			continue
-		}
+	// Inline-кнопки (CallbackQuery)
+	if update.Callback != nil {
+		HandleCallback(ctx, bot, repo, update.Callback)
+		return
+	}
 
-		// Обычные сообщения
-		if update.Message == nil {
-			continue
-		}
+	// Обычные сообщения
+	if update.Message == nil {
+		return
+	}
 
-		if update.Message.IsCommand() {
-			handleCommand(bot, dbConn, update.Message)
-		} else {
-			// Возможно, пользователь в процессе пошагового создания
-			handleCreationSteps(bot, dbConn, update.Message)
-		}
+	if update.Message.IsCommand() {
+		handleCommand(ctx, bot, repo, update.Message)
+		return
+	}
+	state, ok := loadState(ctx, repo, update.Message.ChatID)
+	switch {
+	case !ok:
+		// Текст может быть ответом мастеру (например, названием), поэтому разбирать его
+		// как быстрое добавление нельзя: получилось бы лишнее событие
+		bot.SendMessage(update.Message.ChatID, stateUnavailable, nil)
+	case state != nil:
+		// Пользователь в процессе пошагового создания
+		handleDialogText(ctx, bot, repo, update.Message, state)
+	default:
+		// Вне диалога текст разбирается как быстрое добавление события
+		handleFreeText(ctx, bot, repo, update.Message)
 	}
-	return nil
 }
@@ -0,0 +1,94 @@
+package bot
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+)
+
+// Callback-действия календаря:
+//
+//	cal:nav:2025-01   — показать месяц
+//	cal:day:2025-01-31 — выбрать день
+//	cal:noop          — нажатие на заголовок или пустую клетку
+const (
+	calendarAction = "cal"
+	calendarNav    = "nav"
+	calendarDay    = "day"
+	calendarNoop   = "noop"
+)
+
+var monthNamesRu = [...]string{
+	"Январь", "Февраль", "Март", "Апрель", "Май", "Июнь",
+	"Июль", "Август", "Сентябрь", "Октябрь", "Ноябрь", "Декабрь",
+}
+
+var weekdayHeaderRu = [...]string{"Пн", "Вт", "Ср", "Чт", "Пт", "Сб", "Вс"}
+
+// calendarKeyboard строит сетку месяца month с листанием «◀ ▶».
+// today подсвечивается точками, selected — квадратными скобками.
+func calendarKeyboard(month, today, selected time.Time) messenger.Keyboard {
+	first := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, month.Location())
+	prev := first.AddDate(0, -1, 0)
+	next := first.AddDate(0, 1, 0)
+	noop := makeCallbackData(calendarAction, calendarNoop)
+
+	rows := [][]messenger.Button{
+		messenger.NewRow(
+			messenger.NewButton("◀", makeCallbackData(calendarAction, calendarNav, prev.Format("2006-01"))),
+			messenger.NewButton(
+				fmt.Sprintf("%s %d", monthNamesRu[first.Month()-1], first.Year()), noop),
+			messenger.NewButton("▶", makeCallbackData(calendarAction, calendarNav, next.Format("2006-01"))),
+		),
+	}
+
+	header := make([]messenger.Button, 0, 7)
+	for _, name := range weekdayHeaderRu {
+		header = append(header, messenger.NewButton(name, noop))
+	}
+	rows = append(rows, header)
+
+	// Сетка начинается с понедельника недели, в которую попадает первое число
+	offset := (int(first.Weekday()) + 6) % 7
+	day := first.AddDate(0, 0, -offset)
+	for day.Before(next) {
+		row := make([]messenger.Button, 0, 7)
+		for i := 0; i < 7; i++ {
+			if day.Month() != first.Month() {
+				row = append(row, messenger.NewButton(" ", noop))
+			} else {
+				row = append(row, messenger.NewButton(
+					dayLabel(day, today, selected),
+					makeCallbackData(calendarAction, calendarDay, day.Format("2006-01-02")),
+				))
+			}
+			day = day.AddDate(0, 0, 1)
+		}
+		rows = append(rows, row)
+	}
+
+	tomorrow := today.AddDate(0, 0, 1)
+	rows = append(rows, messenger.NewRow(
+		messenger.NewButton("Сегодня", makeCallbackData(calendarAction, calendarDay, today.Format("2006-01-02"))),
+		messenger.NewButton("Завтра", makeCallbackData(calendarAction, calendarDay, tomorrow.Format("2006-01-02"))),
+	))
+	return messenger.NewKeyboard(rows...)
+}
+
+func dayLabel(day, today, selected time.Time) string {
+	label := fmt.Sprint(day.Day())
+	switch {
+	case sameDay(day, selected):
+		return "[" + label + "]"
+	case sameDay(day, today):
+		return "·" + label + "·"
+	}
+	return label
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
@@ -0,0 +1,90 @@
+package bot
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCalendarKeyboard(t *testing.T) {
+	tests := []struct {
+		name       string
+		month      time.Time
+		blanks     int // пустых клеток перед первым числом
+		days       int
+		title      string
+		prev, next string
+	}{
+		{"с понедельника", time.Date(2025, time.September, 17, 0, 0, 0, 0, time.UTC), 0, 30, "Сентябрь 2025", "cal:nav:2025-08", "cal:nav:2025-10"},
+		{"со среды через год", time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC), 2, 31, "Январь 2025", "cal:nav:2024-12", "cal:nav:2025-02"},
+		{"с воскресенья", time.Date(2025, time.June, 30, 0, 0, 0, 0, time.UTC), 6, 30, "Июнь 2025", "cal:nav:2025-05", "cal:nav:2025-07"},
+		{"февраль", time.Date(2025, time.February, 10, 0, 0, 0, 0, time.UTC), 5, 28, "Февраль 2025", "cal:nav:2025-01", "cal:nav:2025-03"},
+		{"февраль високосного года", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC), 3, 29, "Февраль 2024", "cal:nav:2024-01", "cal:nav:2024-03"},
+		{"декабрь", time.Date(2024, time.December, 31, 0, 0, 0, 0, time.UTC), 6, 31, "Декабрь 2024", "cal:nav:2024-11", "cal:nav:2025-01"},
+	}
+	today := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kb := calendarKeyboard(tt.month, today, time.Time{})
+
+			nav := kb[0]
+			if len(nav) != 3 || nav[0].Data != tt.prev || nav[1].Text != tt.title || nav[2].Data != tt.next {
+				t.Errorf("листание: %v, want ◀ %s, %s, ▶ %s", nav, tt.prev, tt.title, tt.next)
+			}
+			if len(kb[1]) != 7 || kb[1][0].Text != "Пн" || kb[1][6].Text != "Вс" {
+				t.Errorf("дни недели: %v", kb[1])
+			}
+
+			var cells []string
+			for _, row := range kb[2 : len(kb)-1] {
+				if len(row) != 7 {
+					t.Fatalf("неделя из %d клеток: %v", len(row), row)
+				}
+				for _, b := range row {
+					cells = append(cells, b.Data)
+				}
+			}
+			if len(cells)%7 != 0 || len(cells)-tt.blanks-tt.days >= 7 {
+				t.Errorf("лишняя неделя: %d клеток", len(cells))
+			}
+			for i, data := range cells {
+				want := "cal:noop"
+				if day := i - tt.blanks + 1; day >= 1 && day <= tt.days {
+					want = fmt.Sprintf("cal:day:%d-%02d-%02d", tt.month.Year(), tt.month.Month(), day)
+				}
+				if data != want {
+					t.Errorf("клетка %d: %s, want %s", i, data, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCalendarKeyboardLabels(t *testing.T) {
+	month := time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+	today := time.Date(2025, time.March, 14, 18, 0, 0, 0, time.UTC)
+	selected := time.Date(2025, time.March, 20, 0, 0, 0, 0, time.UTC)
+	kb := calendarKeyboard(month, today, selected)
+
+	labels := map[string]string{}
+	for _, row := range kb[2 : len(kb)-1] {
+		for _, b := range row {
+			labels[b.Data] = b.Text
+		}
+	}
+	for data, want := range map[string]string{
+		"cal:day:2025-03-01": "1",
+		"cal:day:2025-03-14": "·14·",
+		"cal:day:2025-03-20": "[20]",
+		"cal:day:2025-03-31": "31",
+	} {
+		if got := labels[data]; got != want {
+			t.Errorf("%s: %q, want %q", data, got, want)
+		}
+	}
+
+	last := kb[len(kb)-1]
+	if len(last) != 2 || last[0].Data != "cal:day:2025-03-14" || last[1].Data != "cal:day:2025-03-15" {
+		t.Errorf("«Сегодня» и «Завтра»: %v", last)
+	}
+}
@@ -0,0 +1,24 @@
+package bot
+
+import "strings"
+
+// callbackSep разделяет действие и аргументы в callback_data: "действие:арг1:арг2"
+const callbackSep = ":"
+
+// callbackData — разобранные данные inline-кнопки.
+// Telegram ограничивает callback_data 64 байтами, поэтому аргументы держим короткими.
+type callbackData struct {
+	Action string
+	Args   []string
+}
+
+// parseCallbackData разбирает строку "действие:арг1:арг2..."
+func parseCallbackData(s string) callbackData {
+	parts := strings.Split(s, callbackSep)
+	return callbackData{Action: parts[0], Args: parts[1:]}
+}
+
+// makeCallbackData собирает callback_data из действия и аргументов
+func makeCallbackData(action string, args ...string) string {
+	return strings.Join(append([]string{action}, args...), callbackSep)
+}
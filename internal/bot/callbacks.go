@@ -1,201 +1,228 @@
 package bot
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strconv"
-	"strings"
 	"time"
 
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/jackc/pgx/v5"
-
+	"github.com/natindo/CalVigil/internal/dialog"
+	"github.com/natindo/CalVigil/internal/messenger"
 	"github.com/natindo/CalVigil/internal/models"
+	"github.com/natindo/CalVigil/internal/recurrence"
 	"github.com/natindo/CalVigil/internal/services"
 )
 
-// HandleCallbackQuery обрабатывает клики по inline-кнопкам
-func HandleCallbackQuery(bot *tgbotapi.BotAPI, dbConn *pgx.Conn, cq *tgbotapi.CallbackQuery) {
-	chatID := cq.Message.Chat.ID
-	data := cq.Data
+// HandleCallback обрабатывает нажатия кнопок под сообщениями бота.
+// callback_data имеет вид "действие:арг1:арг2..." (см. parseCallbackData).
+func HandleCallback(ctx context.Context, bot messenger.Messenger, repo services.Store, cq *messenger.Callback) {
+	chatID := cq.ChatID
+	data := parseCallbackData(cq.Data)
 
-	switch data {
-	case "date_today":
-		handleDateToday(bot, chatID, cq)
-	case "date_tomorrow":
-		handleDateTomorrow(bot, chatID, cq)
+	switch data.Action {
+	case calendarAction, timePickerAction, durationAction, "repeat", "nag", dialog.NavAction:
+		// Кнопки шагов диалога и навигации по нему
+		handleDialogButton(ctx, bot, repo, chatID, cq, data)
 	case "delete_all_today":
-		handleDeleteAllToday(bot, dbConn, chatID, cq)
+		handleDeleteAllToday(ctx, bot, repo, chatID, cq)
+	case "snooze":
+		handleSnooze(ctx, bot, repo, chatID, cq, data.Args)
+	case "ack":
+		handleAck(ctx, bot, repo, chatID, cq, data.Args)
+	case "scope":
+		handleScopeChoice(ctx, bot, repo, chatID, cq, data.Args)
+	case "edit":
+		handleEditButton(ctx, bot, repo, chatID, cq, data.Args)
+	case editFieldAction:
+		handleEditField(ctx, bot, repo, chatID, cq, data.Args)
+	case agendaAction:
+		handleAgendaNav(ctx, bot, repo, chatID, cq, data.Args)
+	case timezoneAction:
+		handleTimezoneChoice(ctx, bot, repo, chatID, cq, data.Args)
 	default:
 		// Если callback_data не узнаём, сообщим пользователю
-		bot.Request(tgbotapi.NewCallback(cq.ID, "Неизвестное действие"))
+		bot.AnswerCallback(cq.ID, "Неизвестное действие")
 	}
 }
 
-func handleDateToday(bot *tgbotapi.BotAPI, chatID int64, cq *tgbotapi.CallbackQuery) {
-	state, ok := userCreationState[chatID]
-	if !ok || state.Step != 1 {
-		bot.Request(tgbotapi.NewCallback(cq.ID, "Нет активного создания или неверный шаг."))
+// handleScopeChoice обрабатывает выбор области изменения серии.
+// Формат callback_data: scope:<delete|update>:<this|following|all>:<eventID>:<unix начала повторения>
+func handleScopeChoice(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, cq *messenger.Callback, args []string) {
+	if len(args) != 4 {
+		bot.AnswerCallback(cq.ID, "Неизвестное действие")
+		return
+	}
+	action, scope := args[0], args[1]
+	eventID, err1 := strconv.Atoi(args[2])
+	unix, err2 := strconv.ParseInt(args[3], 10, 64)
+	if err1 != nil || err2 != nil {
+		bot.AnswerCallback(cq.ID, "Неизвестное действие")
 		return
 	}
+	occStart := time.Unix(unix, 0)
 
-	// Устанавливаем дату = сегодня
-	state.SelectedDate = time.Now()
-	state.Step = 2
-	bot.Request(tgbotapi.NewCallback(cq.ID, "Вы выбрали сегодня."))
-	sendNextStep(bot, chatID, state)
-}
+	ev, err := repo.GetEventByID(ctx, chatID, eventID)
+	if err != nil || ev == nil {
+		bot.AnswerCallback(cq.ID, "Событие не найдено.")
+		return
+	}
+	occStart = occStart.In(ev.StartTime.Location())
+	bot.AnswerCallback(cq.ID, "")
 
-func handleDateTomorrow(bot *tgbotapi.BotAPI, chatID int64, cq *tgbotapi.CallbackQuery) {
-	state, ok := userCreationState[chatID]
-	if !ok || state.Step != 1 {
-		bot.Request(tgbotapi.NewCallback(cq.ID, "Нет активного создания или неверный шаг."))
+	if action == "update" {
+		if scope == services.ScopeFollowing {
+			// Новая серия с выбранного повторения — через мастер целиком
+			startEditWizard(ctx, bot, repo, chatID, ev, scope, occStart)
+			return
+		}
+		sendEditCard(bot, chatID, ev, scope, occStart, cq.MessageID)
+		return
+	}
+
+	switch scope {
+	case services.ScopeThis:
+		err = repo.CancelOccurrence(ctx, chatID, eventID, occStart)
+	case services.ScopeFollowing:
+		err = repo.TruncateSeries(ctx, chatID, eventID, occStart)
+	default:
+		err = repo.DeleteEvent(ctx, chatID, eventID)
+	}
+	if err != nil {
+		bot.SendMessage(chatID, fmt.Sprintf("Ошибка при удалении: %v", err), nil)
 		return
 	}
 
-	// Устанавливаем дату = завтра
-	state.SelectedDate = time.Now().Add(24 * time.Hour)
-	state.Step = 2
-	bot.Request(tgbotapi.NewCallback(cq.ID, "Вы выбрали завтра."))
-	sendNextStep(bot, chatID, state)
+	text := map[string]string{
+		services.ScopeThis:      "Повторение отменено.",
+		services.ScopeFollowing: "Повторения с выбранного удалены.",
+		services.ScopeAll:       "Серия удалена.",
+	}[scope]
+	bot.SendMessage(chatID, text, nil)
 }
 
-func handleDeleteAllToday(bot *tgbotapi.BotAPI, dbConn *pgx.Conn, chatID int64, cq *tgbotapi.CallbackQuery) {
-	bot.Request(tgbotapi.NewCallback(cq.ID, "")) // Закрыть «часовые песочки» для пользователя
+func handleDeleteAllToday(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, cq *messenger.Callback) {
+	bot.AnswerCallback(cq.ID, "") // Закрыть «часовые песочки» для пользователя
 
-	err := services.DeleteAllToday(dbConn, chatID, time.Now())
+	err := repo.DeleteAllToday(ctx, chatID, chatNow(ctx, repo, chatID))
 	if err != nil {
-		bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Ошибка при удалении: %v", err)))
+		bot.SendMessage(chatID, fmt.Sprintf("Ошибка при удалении: %v", err), nil)
 		return
 	}
-	bot.Send(tgbotapi.NewMessage(chatID, "Все сегодняшние события удалены."))
+	bot.SendMessage(chatID, "Все сегодняшние события удалены.", nil)
 }
 
-// -------------------------------------------------------------------
-// Обработчик пошаговых сообщений (handleCreationSteps)
-// -------------------------------------------------------------------
+// saveEvent создаёт событие (или сохраняет правку) по собранным данным и сбрасывает диалог
+func saveEvent(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, state *models.CreationState) {
+	// Сбрасываем состояние в любом случае
+	defer dropState(ctx, repo, chatID)
+
+	ev := models.Event{
+		ChatID:     chatID,
+		Title:      state.Title,
+		StartTime:  state.SelectedStart,
+		EndTime:    endAfter(state.SelectedStart, state.Duration),
+		Reminders:  remindersFromOffsets(state.Reminders),
+		Recurrence: state.Recurrence,
+		Nag:        state.Nag,
+	}
 
-func handleCreationSteps(bot *tgbotapi.BotAPI, dbConn *pgx.Conn, msg *tgbotapi.Message) {
-	chatID := msg.Chat.ID
-	state, ok := userCreationState[chatID]
-	if !ok {
-		// Нет активного «диалога» — выходим
+	if state.EditEventID != 0 {
+		finishEdit(ctx, bot, repo, chatID, state, ev)
 		return
 	}
 
-	switch state.Step {
-	case 1:
-		// Пользователь должен был ввести дату (YYYY-MM-DD),
-		// если не выбрал «Сегодня/Завтра» Inline-кнопками
-		dateStr := strings.TrimSpace(msg.Text)
-		parsed, err := time.Parse("2006-01-02", dateStr)
-		if err != nil {
-			bot.Send(tgbotapi.NewMessage(chatID, "Не удалось распознать дату, формат YYYY-MM-DD."))
-			return
-		}
-		state.SelectedDate = parsed
-		state.Step = 2
-		sendNextStep(bot, chatID, state)
-
-	case 2:
-		// Ожидаем время начала в формате HH:MM
-		timeStr := strings.TrimSpace(msg.Text)
-		t, err := time.Parse("15:04", timeStr)
-		if err != nil {
-			bot.Send(tgbotapi.NewMessage(chatID, "Некорректный формат времени (HH:MM)."))
-			return
-		}
-		// Собираем дату и время
-		dt := time.Date(
-			state.SelectedDate.Year(),
-			state.SelectedDate.Month(),
-			state.SelectedDate.Day(),
-			t.Hour(), t.Minute(), 0, 0, time.Local,
-		)
-		state.SelectedStart = dt
-		state.Step = 3
-		sendNextStep(bot, chatID, state)
-
-	case 3:
-		// Ожидаем ввод длительности в минутах (целое число)
-		durStr := strings.TrimSpace(msg.Text)
-		durMins, err := strconv.Atoi(durStr)
-		if err != nil {
-			bot.Send(tgbotapi.NewMessage(chatID, "Пожалуйста, введите число — длительность в минутах."))
-			return
-		}
-		state.Duration = time.Duration(durMins) * time.Minute
-		state.Step = 4
-		sendNextStep(bot, chatID, state)
-
-	case 4:
-		// Ожидаем ввод "за сколько минут уведомлять"
-		notifyStr := strings.TrimSpace(msg.Text)
-		notifyMins, err := strconv.Atoi(notifyStr)
-		if err != nil {
-			bot.Send(tgbotapi.NewMessage(chatID, "Пожалуйста, введите число — за сколько минут уведомлять."))
-			return
-		}
-		if notifyMins < 0 {
-			notifyMins = 0
-		}
-		state.NotifyBefore = notifyMins
-		state.Step = 5
-		sendNextStep(bot, chatID, state)
-
-	case 5:
-		// Ожидаем название события
-		state.Title = strings.TrimSpace(msg.Text)
-		// Теперь у нас есть все данные — создаём событие в БД
-		endTime := state.SelectedStart.Add(state.Duration)
-
-		ev := models.Event{
-			ChatID:       chatID,
-			Title:        state.Title,
-			StartTime:    state.SelectedStart,
-			EndTime:      endTime,
-			NotifyBefore: state.NotifyBefore,
-			Notified:     false,
+	id, err := repo.InsertEvent(ctx, ev)
+	if err != nil {
+		log.Println("Ошибка InsertEvent:", err)
+		bot.SendMessage(chatID, "Произошла ошибка при сохранении события.", nil)
+		return
+	}
+
+	// Сообщаем пользователю об успехе в том же сообщении мастера
+	showWizardMessage(bot, chatID, state, fmt.Sprintf("Событие создано (ID=%d):\n%s", id, describeState(state)), nil)
+}
+
+// finishEdit сохраняет правку «это и последующие»: серия завершается перед
+// выбранным повторением, а с него начинается новая серия с новыми значениями
+func finishEdit(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, state *models.CreationState, ev models.Event) {
+	id, err := repo.SplitSeries(ctx, chatID, state.EditEventID, state.OccurrenceStart, ev)
+	if err != nil {
+		log.Println("Ошибка при обновлении события:", err)
+		bot.SendMessage(chatID, "Произошла ошибка при сохранении события.", nil)
+		return
+	}
+	showWizardMessage(bot, chatID, state, fmt.Sprintf("Событие обновлено (ID=%d):\n%s", id, describeState(state)), nil)
+}
+
+// describeState — сводка по введённым данным события
+func describeState(state *models.CreationState) string {
+	text := fmt.Sprintf(
+		"%s\nНачало: %s\nДлительность: %s",
+		state.Title,
+		state.SelectedStart.Format("2006-01-02 15:04"),
+		describeDuration(state.Duration),
+	)
+	if state.EditScope != services.ScopeThis {
+		text += "\nНапоминания: " + describeReminders(state.Reminders) +
+			"\nПовтор: " + describeRecurrence(state.Recurrence)
+		if state.Nag != nil {
+			text += "\n" + describeNag(state.Nag)
 		}
+	}
+	return text
+}
 
-		id, err := services.InsertEvent(dbConn, ev)
-		if err != nil {
-			log.Println("Ошибка InsertEvent:", err)
-			bot.Send(tgbotapi.NewMessage(chatID, "Произошла ошибка при сохранении события."))
-			delete(userCreationState, chatID) // Сбрасываем состояние
+// showWizardMessage редактирует сообщение мастера, а если его ещё нет
+// (или редактирование не удалось) — отправляет новое и запоминает его ID.
+func showWizardMessage(bot messenger.Messenger, chatID int64, state *models.CreationState, text string, keyboard messenger.Keyboard) {
+	if state.MessageID != 0 {
+		err := bot.EditMessage(chatID, state.MessageID, text, keyboard)
+		if err == nil {
 			return
 		}
+		log.Println("Не удалось отредактировать сообщение мастера:", err)
+	}
+
+	messageID, err := bot.SendMessage(chatID, text, keyboard)
+	if err != nil {
+		log.Println("Ошибка отправки сообщения мастера:", err)
+		return
+	}
+	state.MessageID = messageID
+}
 
-		// Сообщаем пользователю об успехе
-		summary := fmt.Sprintf(
-			"Событие создано (ID=%d):\n%s\nНачало: %s\nДлительность: %d минут\nУведомлять за %d мин",
-			id,
-			state.Title,
-			state.SelectedStart.Format("2006-01-02 15:04"),
-			int(state.Duration.Minutes()),
-			state.NotifyBefore,
-		)
-		bot.Send(tgbotapi.NewMessage(chatID, summary))
+// describeDuration — «1 ч 30 мин» или «весь день»
+func describeDuration(d time.Duration) string {
+	if d == 24*time.Hour {
+		return "весь день"
+	}
+	return models.FormatOffset(d)
+}
 
-		// Сбрасываем состояние
-		delete(userCreationState, chatID)
+// endAfter — окончание события, которое начинается в start и длится d.
+// «Весь день» (24 ч с полуночи) заканчивается в следующую полночь по местному времени,
+// даже если в этот день переводятся часы и в сутках 23 или 25 часов.
+func endAfter(start time.Time, d time.Duration) time.Time {
+	if d == 24*time.Hour && start.Equal(startOfDay(start)) {
+		return start.AddDate(0, 0, 1)
+	}
+	return start.Add(d)
+}
 
-	default:
-		// Неизвестный шаг — на всякий случай сбросим
-		delete(userCreationState, chatID)
+// eventDuration — длительность события для мастера и карточки; обратна endAfter:
+// событие с полуночи до следующей полуночи длится «весь день»
+func eventDuration(start, end time.Time) time.Duration {
+	if start.Equal(startOfDay(start)) && end.Equal(start.AddDate(0, 0, 1)) {
+		return 24 * time.Hour
 	}
+	return end.Sub(start)
 }
 
-// sendNextStep — отправляет сообщение, что ожидается на следующем шаге
-func sendNextStep(bot *tgbotapi.BotAPI, chatID int64, state *models.CreationState) {
-	switch state.Step {
-	case 2:
-		bot.Send(tgbotapi.NewMessage(chatID, "Введите время начала (HH:MM):"))
-	case 3:
-		bot.Send(tgbotapi.NewMessage(chatID, "Введите длительность события в минутах:"))
-	case 4:
-		bot.Send(tgbotapi.NewMessage(chatID, "Введите, за сколько минут до начала напоминать:"))
-	case 5:
-		bot.Send(tgbotapi.NewMessage(chatID, "Введите название события:"))
+// describeRecurrence — человекочитаемое описание повторения
+func describeRecurrence(rule *recurrence.Rule) string {
+	if rule == nil {
+		return "без повторений"
 	}
+	return rule.Describe()
 }
@@ -0,0 +1,180 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/dialog"
+	"github.com/natindo/CalVigil/internal/messenger"
+	"github.com/natindo/CalVigil/internal/models"
+	"github.com/natindo/CalVigil/internal/services"
+)
+
+// stateUnavailable — ответ, когда диалог чата не удалось прочитать из БД
+const stateUnavailable = "Не удалось загрузить диалог, попробуйте ещё раз чуть позже."
+
+// loadState возвращает незавершённый диалог чата или nil. ok = false — диалог
+// не удалось прочитать из БД (ошибка логируется): есть ли он, неизвестно.
+func loadState(ctx context.Context, repo services.StateStore, chatID int64) (state *models.CreationState, ok bool) {
+	state, err := repo.LoadDialog(ctx, chatID)
+	if err != nil {
+		log.Println("Ошибка LoadDialog:", err)
+		return nil, false
+	}
+	return state, true
+}
+
+func saveState(ctx context.Context, repo services.StateStore, chatID int64, state *models.CreationState) {
+	if err := repo.SaveDialog(ctx, chatID, state); err != nil {
+		log.Println("Ошибка SaveDialog:", err)
+	}
+}
+
+func dropState(ctx context.Context, repo services.StateStore, chatID int64) {
+	if err := repo.DeleteDialog(ctx, chatID); err != nil {
+		log.Println("Ошибка DeleteDialog:", err)
+	}
+}
+
+// startWizard начинает диалог name с заполненным состоянием
+func startWizard(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, name string, state *models.CreationState) {
+	w, _ := wizardFor(repo, name)
+	if w.dialog.Start(state, time.Now()) == dialog.Finished {
+		w.finish(ctx, bot, repo, chatID, state)
+		return
+	}
+	showStep(ctx, bot, repo, chatID, w, state)
+}
+
+// showStep показывает текущий шаг и сохраняет диалог.
+// Все шаги выводятся в одном сообщении, которое редактируется на месте.
+func showStep(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, w *wizard, state *models.CreationState) {
+	text, keyboard := w.dialog.Render(state)
+	showWizardMessage(bot, chatID, state, text, keyboard)
+	saveState(ctx, repo, chatID, state)
+}
+
+// activeWizard возвращает объявление диалога state. Диалог, который истёк
+// или не узнаётся (например, сохранён прежней версией бота), сбрасывается
+// с сообщением пользователю, и тогда возвращается nil.
+func activeWizard(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, state *models.CreationState) *wizard {
+	w, ok := wizardFor(repo, state.Cursor.Dialog)
+	if ok && !w.dialog.Expired(state, time.Now()) {
+		if _, ok := w.dialog.Current(state); ok {
+			return w
+		}
+	}
+
+	dropState(ctx, repo, chatID)
+	text := "Диалог прерван: бот обновился. Начните заново."
+	if ok {
+		text = "Время на ответ истекло, диалог прерван. Начните заново."
+	}
+	showWizardMessage(bot, chatID, state, text, nil)
+	return nil
+}
+
+// handleDialogText принимает текстовый ввод на текущем шаге незавершённого диалога
+func handleDialogText(ctx context.Context, bot messenger.Messenger, repo services.Store, msg *messenger.Message, state *models.CreationState) {
+	chatID := msg.ChatID
+	w := activeWizard(ctx, bot, repo, chatID, state)
+	if w == nil {
+		return
+	}
+
+	outcome, note := w.dialog.HandleText(state, msg.Text, time.Now())
+	if outcome == dialog.Rejected {
+		bot.SendMessage(chatID, note, nil)
+		return
+	}
+	applyOutcome(ctx, bot, repo, chatID, w, state, outcome)
+}
+
+// handleDialogButton обрабатывает кнопки шагов и навигации под сообщением диалога
+func handleDialogButton(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, cq *messenger.Callback, data callbackData) {
+	state, ok := loadState(ctx, repo, chatID)
+	if !ok {
+		bot.AnswerCallback(cq.ID, stateUnavailable)
+		return
+	}
+	// Кнопки под сообщением прежнего, уже завершённого диалога не действуют
+	if state == nil || state.MessageID != cq.MessageID {
+		bot.AnswerCallback(cq.ID, "Нет активного создания или неверный шаг.")
+		return
+	}
+	w := activeWizard(ctx, bot, repo, chatID, state)
+	if w == nil {
+		bot.AnswerCallback(cq.ID, "")
+		return
+	}
+
+	outcome, note := w.dialog.HandleButton(state, data.Action, data.Args, time.Now())
+	if outcome == dialog.Rejected && note == "" {
+		note = "Нет активного создания или неверный шаг."
+	}
+	bot.AnswerCallback(cq.ID, note)
+	applyOutcome(ctx, bot, repo, chatID, w, state, outcome)
+}
+
+// applyOutcome выполняет то, к чему привёл ввод: следующий шаг, сохранение, отмену
+func applyOutcome(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, w *wizard, state *models.CreationState, outcome dialog.Outcome) {
+	switch outcome {
+	case dialog.Continue:
+		showStep(ctx, bot, repo, chatID, w, state)
+	case dialog.Finished:
+		w.finish(ctx, bot, repo, chatID, state)
+	case dialog.Cancelled:
+		cancelDialog(ctx, bot, repo, chatID, state)
+	case dialog.Left:
+		if w.leave != nil {
+			w.leave(ctx, bot, repo, chatID, state)
+		}
+	case dialog.Broken:
+		dropState(ctx, repo, chatID)
+	}
+}
+
+// cmdCancel прерывает создание или изменение события: /cancel
+func cmdCancel(ctx context.Context, bot messenger.Messenger, repo services.Store, msg *messenger.Message) {
+	state, ok := loadState(ctx, repo, msg.ChatID)
+	if !ok {
+		bot.SendMessage(msg.ChatID, stateUnavailable, nil)
+		return
+	}
+	if state == nil {
+		bot.SendMessage(msg.ChatID, "Нечего отменять.", nil)
+		return
+	}
+	cancelDialog(ctx, bot, repo, msg.ChatID, state)
+}
+
+// cancelDialog сбрасывает диалог; событие в БД при этом не меняется
+func cancelDialog(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, state *models.CreationState) {
+	dropState(ctx, repo, chatID)
+	text := "Создание события отменено."
+	if state.EditEventID != 0 {
+		text = "Изменение события отменено."
+	}
+	showWizardMessage(bot, chatID, state, text, nil)
+}
+
+// backToEditCard бросает правку поля и снова показывает карточку события
+func backToEditCard(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, state *models.CreationState) {
+	dropState(ctx, repo, chatID)
+	ev, err := repo.GetEventByID(ctx, chatID, state.EditEventID)
+	if err == nil && ev == nil {
+		err = services.ErrEventNotFound
+	}
+	if errors.Is(err, services.ErrEventNotFound) {
+		showWizardMessage(bot, chatID, state, "Событие не найдено.", nil)
+		return
+	}
+	if err != nil {
+		log.Println("Ошибка GetEventByID:", err)
+		bot.SendMessage(chatID, "Ошибка при получении события.", nil)
+		return
+	}
+	sendEditCard(bot, chatID, ev, state.EditScope, state.OccurrenceStart, state.MessageID)
+}
@@ -0,0 +1,196 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/dialog"
+	"github.com/natindo/CalVigil/internal/messenger"
+	"github.com/natindo/CalVigil/internal/models"
+	"github.com/natindo/CalVigil/internal/services"
+)
+
+func TestCreateWizardSteps(t *testing.T) {
+	d := wizards[createDialog].dialog
+	now := time.Now()
+	state := &models.CreationState{Reminders: []time.Duration{5 * time.Minute}, Location: time.UTC}
+	d.Start(state, now)
+
+	input := []struct {
+		text string
+		next string
+	}{
+		{"2025-03-10", stepTime},
+		{"09:30", stepDuration},
+		{"45", stepReminders},
+		{"1h", stepRepeat},
+		{"нет", stepTitle},
+		{"Планёрка", stepNag},
+	}
+	for _, in := range input {
+		if got, note := d.HandleText(state, in.text, now); got != dialog.Continue || state.Cursor.Step != in.next {
+			t.Fatalf("ввод %q: %v %q, шаг %q, ожидался %q", in.text, got, note, state.Cursor.Step, in.next)
+		}
+	}
+	if got, _ := d.HandleButton(state, "nag", []string{"5", "6"}, now); got != dialog.Finished {
+		t.Fatalf("выбор повторов: %v", got)
+	}
+
+	want := time.Date(2025, 3, 10, 9, 30, 0, 0, time.UTC)
+	if !state.SelectedStart.Equal(want) || state.Duration != 45*time.Minute || state.Title != "Планёрка" ||
+		len(state.Reminders) != 1 || state.Reminders[0] != time.Hour || state.Nag == nil {
+		t.Errorf("собранное состояние: %+v", state)
+	}
+}
+
+func TestWizardSkipsSeriesSteps(t *testing.T) {
+	d := wizards[createDialog].dialog
+	now := time.Now()
+
+	// Без напоминаний режим повторов не спрашивается
+	state := &models.CreationState{Location: time.UTC}
+	d.Start(state, now)
+	for _, text := range []string{"2025-03-10", "09:30", "30", "нет", "нет"} {
+		d.HandleText(state, text, now)
+	}
+	if got, _ := d.HandleText(state, "Обед", now); got != dialog.Finished {
+		t.Errorf("после названия без напоминаний: %v", got)
+	}
+
+	// Для одного повторения серии напоминания и правило повторения не спрашиваются,
+	// а «Назад» с названия ведёт к длительности
+	this := &models.CreationState{Location: time.UTC, EditScope: services.ScopeThis}
+	d.Start(this, now)
+	for _, text := range []string{"2025-03-10", "09:30", "30"} {
+		d.HandleText(this, text, now)
+	}
+	if this.Cursor.Step != stepTitle {
+		t.Fatalf("шаг %q, ожидалось название", this.Cursor.Step)
+	}
+	if d.Back(this, now); this.Cursor.Step != stepDuration {
+		t.Errorf("«Назад» привёл к шагу %q", this.Cursor.Step)
+	}
+}
+
+func TestWizardValidation(t *testing.T) {
+	d := wizards[createDialog].dialog
+	now := time.Now()
+	state := &models.CreationState{Location: time.UTC}
+	d.Start(state, now)
+
+	if got, note := d.HandleText(state, "10.03.2025", now); got != dialog.Rejected || note == "" {
+		t.Errorf("неверная дата: %v %q", got, note)
+	}
+	// Листание календаря запоминает месяц и оставляет шаг прежним
+	if got, _ := d.HandleButton(state, calendarAction, []string{calendarNav, "2025-07"}, now); got != dialog.Continue ||
+		state.Cursor.Step != stepDate || state.CalendarMonth.Month() != time.July {
+		t.Errorf("листание: %v, шаг %q, месяц %v", got, state.Cursor.Step, state.CalendarMonth)
+	}
+	if got, _ := d.HandleButton(state, durationAction, []string{"30"}, now); got != dialog.Rejected {
+		t.Errorf("кнопка чужого шага: %v", got)
+	}
+	if got, _ := d.HandleButton(state, calendarAction, []string{calendarDay, "2025-07-15"}, now); got != dialog.Continue ||
+		!state.CalendarMonth.IsZero() {
+		t.Errorf("выбор дня: %v, месяц %v", got, state.CalendarMonth)
+	}
+}
+
+func TestEditFieldWizard(t *testing.T) {
+	w := wizards[editFieldPrefix+stepTitle]
+	if w == nil || w.leave == nil {
+		t.Fatal("нет диалога правки названия")
+	}
+	state := &models.CreationState{Title: "Старое", EditEventID: 1, EditField: stepTitle}
+	w.dialog.Start(state, time.Now())
+
+	_, kb := w.dialog.Render(state)
+	nav := kb[len(kb)-1]
+	if len(nav) != 2 || nav[0].Data != "wz:back" || nav[1].Data != "wz:cancel" {
+		t.Errorf("навигация правки поля: %+v", nav)
+	}
+	if got := w.dialog.Back(state, time.Now()); got != dialog.Left {
+		t.Errorf("«Назад» из правки поля: %v", got)
+	}
+	if got, _ := w.dialog.HandleText(state, "Новое", time.Now()); got != dialog.Finished || state.Title != "Новое" {
+		t.Errorf("правка названия: %v, %q", got, state.Title)
+	}
+	if _, ok := wizards[editFieldPrefix+stepRepeat]; ok {
+		t.Error("у повторения нет поля в карточке")
+	}
+}
+
+// sentTexts — Messenger, запоминающий тексты отправленных сообщений
+type sentTexts []string
+
+func (s *sentTexts) SendMessage(_ int64, text string, _ messenger.Keyboard) (int, error) {
+	*s = append(*s, text)
+	return len(*s), nil
+}
+func (s *sentTexts) EditMessage(int64, int, string, messenger.Keyboard) error { return nil }
+func (s *sentTexts) AnswerCallback(string, string) error                      { return nil }
+func (s *sentTexts) SetCommands([]messenger.Command) error                    { return nil }
+
+// unreachableStore — хранилище, которое не может прочитать диалог; остальные методы,
+// кроме перечисленных, не должны вызываться
+type unreachableStore struct {
+	services.Store
+	inserted int
+}
+
+func (s *unreachableStore) LoadDialog(context.Context, int64) (*models.CreationState, error) {
+	return nil, errors.New("нет связи с базой")
+}
+
+func (s *unreachableStore) InsertEvent(context.Context, models.Event) (int, error) {
+	s.inserted++
+	return s.inserted, nil
+}
+
+func (s *unreachableStore) ChatLocation(context.Context, int64) (*time.Location, error) {
+	return time.UTC, nil
+}
+
+// TestDialogUnavailable — если диалог не прочитался, ответ мастеру (здесь — название)
+// не превращается в событие быстрого добавления
+func TestDialogUnavailable(t *testing.T) {
+	var sent sentTexts
+	repo := &unreachableStore{}
+	msg := &messenger.Message{ID: 1, ChatID: 7, Private: true, Text: "Созвон завтра в 15:00"}
+	handleUpdate(context.Background(), &sent, repo, messenger.Update{Message: msg})
+
+	if repo.inserted != 0 {
+		t.Errorf("создано событий: %d", repo.inserted)
+	}
+	if len(sent) != 1 || sent[0] != stateUnavailable {
+		t.Errorf("ответ: %q", sent)
+	}
+}
+
+// ttlStore — хранилище диалогов, у которого задан только срок жизни диалога
+type ttlStore struct {
+	services.StateStore
+	ttl time.Duration
+}
+
+func (s ttlStore) DialogTTL() time.Duration { return s.ttl }
+
+// TestWizardTimeoutFromStore — мастер ждёт ответа столько же, сколько хранится диалог
+func TestWizardTimeoutFromStore(t *testing.T) {
+	w, ok := wizardFor(ttlStore{ttl: 72 * time.Hour}, editFieldPrefix+stepTitle)
+	if !ok || w.dialog.Timeout != 72*time.Hour || w.leave == nil {
+		t.Fatalf("wizardFor: %+v, %v", w, ok)
+	}
+	state := &models.CreationState{Location: time.UTC}
+	w.dialog.Start(state, time.Now().Add(-48*time.Hour))
+	if w.dialog.Expired(state, time.Now()) {
+		t.Error("диалог истёк раньше dialog_ttl")
+	}
+	if wizards[editFieldPrefix+stepTitle].dialog.Timeout != 0 {
+		t.Error("wizardFor изменил общее объявление диалога")
+	}
+	if _, ok := wizardFor(ttlStore{}, "нет такого"); ok {
+		t.Error("найден несуществующий диалог")
+	}
+}
@@ -0,0 +1,176 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+)
+
+// DefaultWorkers — сколько апдейтов обрабатывается одновременно, если не задано в конфиге
+const DefaultWorkers = 8
+
+// maxChatQueue — сколько апдейтов одного чата может ждать обработки. Если чат присылает
+// больше, пока его апдейт обрабатывается (например, завис запрос к мессенджеру), новые
+// апдейты этого чата отбрасываются: так один чат не съест память, а ждать его не
+// придётся другим чатам, как было бы, если бы Dispatch блокировался.
+const maxChatQueue = 100
+
+// dispatcher обрабатывает апдейты параллельно для разных чатов и строго
+// по порядку внутри одного чата. У каждого чата своя очередь; чат с апдейтами
+// в очереди стоит в списке ready, откуда его берёт свободный воркер.
+// Пока воркер обрабатывает апдейт чата, других апдейтов этого чата никто не берёт.
+type dispatcher struct {
+	handle   func(ctx context.Context, update messenger.Update)
+	workers  int
+	maxQueue int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queues  map[int64][]messenger.Update // чат есть в map, пока он в ready или обрабатывается
+	ready   []int64
+	dropped map[int64]int // сколько апдейтов чата отброшено с тех пор, как его очередь переполнилась
+	closed  bool
+
+	done chan struct{}
+}
+
+func newDispatcher(workers int, handle func(ctx context.Context, update messenger.Update)) *dispatcher {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	d := &dispatcher{
+		handle:   handle,
+		workers:  workers,
+		maxQueue: maxChatQueue,
+		queues:   make(map[int64][]messenger.Update),
+		dropped:  make(map[int64]int),
+		done:     make(chan struct{}),
+	}
+	d.cond = sync.NewCond(&d.mu)
+	return d
+}
+
+// Start запускает воркеры. ctx передаётся обработчикам: чтобы очередь
+// дообработалась при остановке, он не должен отменяться раньше Shutdown.
+func (d *dispatcher) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < d.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.work(ctx)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(d.done)
+	}()
+}
+
+// Dispatch ставит апдейт в очередь его чата. После Shutdown апдейты не принимаются.
+// Если в очереди чата уже maxChatQueue апдейтов, апдейт отбрасывается (см. maxChatQueue).
+func (d *dispatcher) Dispatch(update messenger.Update) bool {
+	chatID := update.ChatID()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return false
+	}
+	queue, scheduled := d.queues[chatID]
+	if len(queue) >= d.maxQueue {
+		if d.dropped[chatID] == 0 {
+			log.Printf("Очередь чата %d переполнена (%d апдейтов), новые апдейты чата отбрасываются", chatID, len(queue))
+		}
+		d.dropped[chatID]++
+		return true
+	}
+	if n := d.dropped[chatID]; n > 0 {
+		log.Printf("Очередь чата %d снова принимает апдейты, отброшено: %d", chatID, n)
+		delete(d.dropped, chatID)
+	}
+	d.queues[chatID] = append(queue, update)
+	if !scheduled {
+		d.ready = append(d.ready, chatID)
+		d.cond.Signal()
+	}
+	return true
+}
+
+// Shutdown перестаёт принимать апдейты и ждёт, пока воркеры разберут все очереди.
+// Если ctx отменён раньше, ещё не начатые апдейты отбрасываются и возвращается
+// ctx.Err(); уже начатые дорабатывают в фоне (дождаться их — Wait).
+func (d *dispatcher) Shutdown(ctx context.Context) error {
+	d.mu.Lock()
+	d.closed = true
+	d.cond.Broadcast()
+	d.mu.Unlock()
+
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	d.mu.Lock()
+	scheduled := make(map[int64]bool, len(d.ready))
+	for _, chatID := range d.ready {
+		scheduled[chatID] = true
+	}
+	dropped := 0
+	for chatID, queue := range d.queues {
+		if scheduled[chatID] {
+			dropped += len(queue)
+			delete(d.queues, chatID)
+			continue
+		}
+		// Первый апдейт в очереди сейчас обрабатывается
+		dropped += len(queue) - 1
+		d.queues[chatID] = queue[:1]
+	}
+	d.ready = nil
+	d.mu.Unlock()
+
+	if dropped > 0 {
+		log.Printf("Остановка: не обработано апдейтов: %d", dropped)
+	}
+	return ctx.Err()
+}
+
+// Wait ждёт, пока завершатся все воркеры (после Shutdown)
+func (d *dispatcher) Wait() {
+	<-d.done
+}
+
+// work берёт чат из ready, обрабатывает один его апдейт и, если в очереди
+// чата есть ещё, ставит чат в конец ready — так занятый чат не занимает воркер надолго
+func (d *dispatcher) work(ctx context.Context) {
+	for {
+		d.mu.Lock()
+		for len(d.ready) == 0 && !d.closed {
+			d.cond.Wait()
+		}
+		if len(d.ready) == 0 {
+			d.mu.Unlock()
+			return
+		}
+		chatID := d.ready[0]
+		d.ready = d.ready[1:]
+		update := d.queues[chatID][0]
+		d.mu.Unlock()
+
+		d.handle(ctx, update)
+
+		d.mu.Lock()
+		if rest := d.queues[chatID][1:]; len(rest) > 0 {
+			d.queues[chatID] = rest
+			d.ready = append(d.ready, chatID)
+			d.cond.Signal()
+		} else {
+			delete(d.queues, chatID)
+		}
+		d.mu.Unlock()
+	}
+}
@@ -0,0 +1,169 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+)
+
+func chatUpdate(chatID int64, messageID int) messenger.Update {
+	return messenger.Update{Message: &messenger.Message{ID: messageID, ChatID: chatID, Text: "x"}}
+}
+
+func TestDispatcherKeepsChatOrder(t *testing.T) {
+	var mu sync.Mutex
+	got := map[int64][]int{}
+	d := newDispatcher(4, func(_ context.Context, u messenger.Update) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		got[u.Message.ChatID] = append(got[u.Message.ChatID], u.Message.ID)
+		mu.Unlock()
+	})
+	d.Start(context.Background())
+
+	for i := 0; i < 20; i++ {
+		for chat := int64(1); chat <= 3; chat++ {
+			d.Dispatch(chatUpdate(chat, i))
+		}
+	}
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for chat := int64(1); chat <= 3; chat++ {
+		ids := got[chat]
+		if len(ids) != 20 {
+			t.Fatalf("чат %d: обработано %d апдейтов из 20", chat, len(ids))
+		}
+		for i, id := range ids {
+			if id != i {
+				t.Fatalf("чат %d: порядок нарушен: %v", chat, ids)
+			}
+		}
+	}
+}
+
+func TestDispatcherSlowChatDoesNotBlockOthers(t *testing.T) {
+	release := make(chan struct{})
+	fast := make(chan struct{})
+	d := newDispatcher(2, func(_ context.Context, u messenger.Update) {
+		if u.Message.ChatID == 1 {
+			<-release
+			return
+		}
+		close(fast)
+	})
+	d.Start(context.Background())
+
+	d.Dispatch(chatUpdate(1, 1))
+	d.Dispatch(chatUpdate(1, 2))
+	d.Dispatch(chatUpdate(2, 3))
+
+	select {
+	case <-fast:
+	case <-time.After(time.Second):
+		t.Fatal("апдейт другого чата ждёт медленный чат")
+	}
+	close(release)
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDispatcherShutdown(t *testing.T) {
+	var mu sync.Mutex
+	handled := 0
+	d := newDispatcher(2, func(context.Context, messenger.Update) {
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		handled++
+		mu.Unlock()
+	})
+	d.Start(context.Background())
+	for i := 0; i < 5; i++ {
+		d.Dispatch(chatUpdate(int64(i%2), i))
+	}
+
+	// Очереди дообрабатываются до конца
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if handled != 5 {
+		t.Errorf("обработано %d апдейтов из 5", handled)
+	}
+	if d.Dispatch(chatUpdate(9, 9)) {
+		t.Error("после Shutdown апдейт принят")
+	}
+}
+
+func TestDispatcherShutdownDeadline(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	handled := 0
+	d := newDispatcher(1, func(context.Context, messenger.Update) {
+		<-release
+		mu.Lock()
+		handled++
+		mu.Unlock()
+	})
+	d.Start(context.Background())
+	for i := 0; i < 3; i++ {
+		d.Dispatch(chatUpdate(int64(i), i))
+	}
+
+	// Обработчик занят дольше срока: не начатые апдейты отбрасываются,
+	// начатый дорабатывает
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := d.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown = %v, ожидался DeadlineExceeded", err)
+	}
+	close(release)
+	d.Wait()
+	if handled != 1 {
+		t.Errorf("обработано %d апдейтов, ожидался 1", handled)
+	}
+}
+
+// TestDispatcherQueueLimit — чат, который присылает апдейты быстрее, чем они
+// обрабатываются, не раздувает очередь и не задерживает другие чаты
+func TestDispatcherQueueLimit(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	got := map[int64][]int{}
+	d := newDispatcher(2, func(_ context.Context, u messenger.Update) {
+		if u.Message.ChatID == 1 {
+			<-release
+		}
+		mu.Lock()
+		got[u.Message.ChatID] = append(got[u.Message.ChatID], u.Message.ID)
+		mu.Unlock()
+	})
+	d.maxQueue = 3
+	d.Start(context.Background())
+
+	// Первый апдейт обрабатывается, ещё два ждут, остальные отбрасываются
+	for i := 0; i < 10; i++ {
+		if !d.Dispatch(chatUpdate(1, i)) {
+			t.Fatal("апдейт не принят до Shutdown")
+		}
+	}
+	d.Dispatch(chatUpdate(2, 100))
+	close(release)
+	// Когда очередь разобрана, чат снова принимается
+	time.Sleep(20 * time.Millisecond)
+	d.Dispatch(chatUpdate(1, 10))
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := got[1]; len(ids) != 4 || ids[0] != 0 || ids[1] != 1 || ids[2] != 2 || ids[3] != 10 {
+		t.Errorf("чат 1: обработаны %v, ожидались [0 1 2 10]", ids)
+	}
+	if len(got[2]) != 1 {
+		t.Errorf("чат 2: обработаны %v", got[2])
+	}
+}
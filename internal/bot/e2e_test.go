@@ -0,0 +1,401 @@
+package bot_test
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/bot"
+	"github.com/natindo/CalVigil/internal/console"
+	"github.com/natindo/CalVigil/internal/database"
+	"github.com/natindo/CalVigil/internal/database/dbtest"
+	"github.com/natindo/CalVigil/internal/matrix"
+	"github.com/natindo/CalVigil/internal/matrixtest"
+	"github.com/natindo/CalVigil/internal/messenger"
+	"github.com/natindo/CalVigil/internal/models"
+	"github.com/natindo/CalVigil/internal/services"
+	"github.com/natindo/CalVigil/internal/telegram"
+	"github.com/natindo/CalVigil/internal/telegramtest"
+)
+
+// Сквозные тесты запускают бота целиком, как main, поверх каждого адаптера: Telegram
+// получает апдейты long polling-ом от поддельного Bot API (telegramtest), Matrix — через
+// /sync от поддельного homeserver-а (matrixtest). Данные хранятся в настоящем
+// PostgreSQL (dbtest).
+
+func TestMain(m *testing.M) { dbtest.Main(m) }
+
+// e2eTimeout — сколько ждать ответа бота на одно действие пользователя
+const e2eTimeout = 10 * time.Second
+
+// e2eChat — личный чат пользователя с ботом
+type e2eChat struct {
+	t   *testing.T
+	srv *telegramtest.Server
+	id  int64
+}
+
+// send отправляет боту текст или команду
+func (c *e2eChat) send(text string) {
+	c.srv.Enqueue(c.srv.Text(c.id, text))
+}
+
+// press нажимает кнопку под сообщением бота
+func (c *e2eChat) press(m telegramtest.Message, label string) {
+	c.t.Helper()
+	u, err := c.srv.Press(m, label)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.srv.Enqueue(u)
+}
+
+// wait ждёт сообщения бота, содержащего substr
+func (c *e2eChat) wait(substr string) telegramtest.Message {
+	c.t.Helper()
+	return c.srv.WaitMessage(c.t, c.id, e2eTimeout, func(m telegramtest.Message) bool {
+		return strings.Contains(m.Text, substr)
+	})
+}
+
+// e2eOptions — настройки основного цикла в сквозных тестах
+var e2eOptions = bot.Options{Workers: 2, ShutdownTimeout: 5 * time.Second}
+
+// noDatabase — хранилище без базы для тестов, которые её не трогают: /help берёт из него
+// только настройки
+var noDatabase = services.NewPgRepository(nil, 0, 0)
+
+// runBot запускает telegram.Run против srv; бот останавливается в конце теста
+func runBot(t *testing.T, srv *telegramtest.Server, repo services.Store) {
+	api := srv.Bot(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- telegram.Run(ctx, api, repo, e2eOptions, nil)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run: %v", err)
+		}
+	})
+}
+
+// TestE2EPolling не трогает БД: /help и неизвестная команда проходят весь путь
+// от getUpdates до sendMessage
+func TestE2EPolling(t *testing.T) {
+	srv := telegramtest.NewServer(t)
+	runBot(t, srv, noDatabase)
+	chat := &e2eChat{t: t, srv: srv, id: 42}
+
+	chat.send("/help")
+	chat.wait("Справка:")
+	chat.send("/nonsense")
+	chat.wait("Неизвестная команда")
+
+	if len(srv.Calls("deleteWebhook")) != 1 {
+		t.Error("перед long polling вебхук не снят")
+	}
+	if len(srv.Calls("setMyCommands")) != 1 {
+		t.Error("меню команд не зарегистрировано")
+	}
+}
+
+// matrixChat — комната Matrix, где пользователь переписывается с ботом
+type matrixChat struct {
+	t    *testing.T
+	srv  *matrixtest.Server
+	room string
+}
+
+const matrixUser = "@alice:test.local"
+
+// runMatrix подключает бота к srv и запускает Serve; бот входит в комнату room
+func runMatrix(t *testing.T, srv *matrixtest.Server, repo services.Store, chats messenger.ChatDirectory, room string) *matrixChat {
+	client, err := matrix.Connect(context.Background(), matrix.Options{
+		Homeserver:  srv.URL(),
+		Token:       matrixtest.Token,
+		Chats:       chats,
+		SyncTimeout: time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- bot.Serve(ctx, client, repo, e2eOptions, client.Receive)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+
+	srv.Invite(room, 2)
+	deadline := time.Now().Add(e2eTimeout)
+	for !srv.Joined(room) {
+		if time.Now().After(deadline) {
+			t.Fatalf("бот не вошёл в комнату %s", room)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return &matrixChat{t: t, srv: srv, room: room}
+}
+
+func (c *matrixChat) send(text string) {
+	c.srv.Say(c.room, matrixUser, text)
+}
+
+// press нажимает кнопку под сообщением бота, отвечая «#N»
+func (c *matrixChat) press(m matrixtest.Message, label string) {
+	c.t.Helper()
+	reply, ok := m.Button(label)
+	if !ok {
+		c.t.Fatalf("под сообщением нет кнопки %q: %q", label, m.Text)
+	}
+	c.send(reply)
+}
+
+func (c *matrixChat) wait(substr string) matrixtest.Message {
+	c.t.Helper()
+	return c.srv.WaitMessage(c.t, c.room, e2eTimeout, func(m matrixtest.Message) bool {
+		return strings.Contains(m.Text, substr)
+	})
+}
+
+// TestE2EMatrix не трогает БД: тот же бот в комнате Matrix, от /sync до отправки ответа
+func TestE2EMatrix(t *testing.T) {
+	chat := runMatrix(t, matrixtest.NewServer(t), noDatabase, matrixtest.NewChats(), "!e2e:test.local")
+
+	chat.send("/help")
+	chat.wait("Справка:")
+	chat.send("/nonsense")
+	chat.wait("Неизвестная команда")
+	chat.send("#7")
+	chat.wait("Кнопки #7 нет.")
+}
+
+// TestE2EMatrixButtons: кнопки в Matrix — нумерованный список, «#N» нажимает кнопку.
+// Номер комнаты хранится в platform_chats.
+func TestE2EMatrixButtons(t *testing.T) {
+	ctx := context.Background()
+	pool, err := database.ConnectPostgres(ctx, dbtest.URL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	if _, err := database.MigrateUp(ctx, pool); err != nil {
+		t.Fatal(err)
+	}
+	repo := services.NewPgRepository(pool, 0, 0)
+
+	room := fmt.Sprintf("!e2e%d:test.local", time.Now().UnixNano())
+	chat := runMatrix(t, matrixtest.NewServer(t), repo, repo, room)
+
+	chat.send("/timezone")
+	chat.press(chat.wait("Выберите другой кнопкой"), "Берлин")
+	chat.wait("Часовой пояс чата: Europe/Berlin")
+
+	chatID, err := repo.ChatID(ctx, matrix.Platform, room)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc, err := repo.ChatLocation(ctx, chatID); err != nil || loc.String() != "Europe/Berlin" {
+		t.Errorf("пояс комнаты: %v, %v", loc, err)
+	}
+}
+
+// TestE2EConsole: тот же цикл Serve поверх консоли; конец ввода останавливает бота
+func TestE2EConsole(t *testing.T) {
+	var out strings.Builder
+	term := console.New(strings.NewReader("/help\n/nonsense\n"), &out, console.DefaultChatID)
+	if err := bot.Serve(context.Background(), term, noDatabase, bot.Options{Workers: 1}, term.Receive); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Справка:", "без ответа дольше 1 д", "Неизвестная команда"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("в выводе нет %q:\n%s", want, out.String())
+		}
+	}
+}
+
+// TestE2EEventLifecycle: событие создаётся мастером /create, видно в /list,
+// напоминание приходит один раз и подтверждается кнопкой, /delete удаляет событие
+func TestE2EEventLifecycle(t *testing.T) {
+	ctx := context.Background()
+	pool, err := database.ConnectPostgres(ctx, dbtest.URL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	if _, err := database.MigrateUp(ctx, pool); err != nil {
+		t.Fatal(err)
+	}
+	repo := services.NewPgRepository(pool, 0, 0)
+
+	srv := telegramtest.NewServer(t)
+	runBot(t, srv, repo)
+	chat := &e2eChat{t: t, srv: srv, id: time.Now().UnixNano()}
+
+	// Пояс чата выбирается так, чтобы у него был полдень: событие через пару минут
+	// гарантированно попадает в сегодняшний /list
+	tz := fmt.Sprintf("Etc/GMT%+d", time.Now().UTC().Hour()-12)
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chat.send("/timezone " + tz)
+	chat.wait("Часовой пояс чата: " + tz)
+
+	start := time.Now().In(loc).Add(3 * time.Minute)
+	chat.send("/create")
+	chat.wait("Выберите дату")
+	chat.send(start.Format("2006-01-02"))
+	chat.wait("Выберите время начала")
+	chat.send(start.Format("15:04"))
+	chat.wait("Выберите длительность")
+	chat.send("30")
+	chat.wait("за сколько до начала напоминать")
+	chat.send("5m")
+	chat.press(chat.wait("Повторять событие?"), "Не повторять")
+	chat.wait("Введите название события")
+	chat.send("Сквозной созвон")
+	chat.press(chat.wait("Повторять напоминание"), "Не повторять")
+
+	created := chat.wait("Событие создано")
+	match := regexp.MustCompile(`ID=(\d+)`).FindStringSubmatch(created.Text)
+	if match == nil || created.Keyboard != nil {
+		t.Fatalf("итог мастера: %+v", created)
+	}
+	id, _ := strconv.Atoi(match[1])
+
+	chat.send("/list")
+	chat.wait(fmt.Sprintf("ID=%d | Сквозной созвон", id))
+
+	// Напоминание «за 5 минут» уже наступило
+	api := srv.Bot(t)
+	notifierCtx, stopNotifier := context.WithCancel(ctx)
+	notifierDone := make(chan struct{})
+	go func() {
+		defer close(notifierDone)
+		services.StartChatNotifier(notifierCtx, telegram.NewMessenger(api), repo, services.NotifierOptions{}, chat.id)
+	}()
+	reminder := chat.wait("Напоминание!")
+	if !strings.Contains(reminder.Text, "Сквозной созвон") {
+		t.Errorf("напоминание: %q", reminder.Text)
+	}
+	chat.press(reminder, "Понятно")
+	if acked := chat.wait("✅ Принято"); acked.ID != reminder.ID || acked.Keyboard != nil {
+		t.Errorf("подтверждённое напоминание: %+v", acked)
+	}
+	time.Sleep(100 * time.Millisecond)
+	stopNotifier()
+	<-notifierDone
+	reminders := 0
+	for _, m := range srv.Messages(chat.id) {
+		if strings.Contains(m.Text, "Напоминание!") {
+			reminders++
+		}
+	}
+	if reminders != 1 {
+		t.Errorf("напоминаний отправлено: %d", reminders)
+	}
+
+	chat.send(fmt.Sprintf("/delete %d", id))
+	chat.wait("Событие удалено.")
+	chat.send("/list")
+	chat.wait("На сегодня нет событий.")
+}
+
+// TestE2ESnoozeAndAck: «Отложить» под напоминанием присылает его копию один раз, а
+// «Понятно» под копией останавливает повторы. Чтобы не ждать минутами, тест сдвигает
+// время отложенного напоминания и повтора в базе на «сейчас».
+func TestE2ESnoozeAndAck(t *testing.T) {
+	ctx := context.Background()
+	pool, err := database.ConnectPostgres(ctx, dbtest.URL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	if _, err := database.MigrateUp(ctx, pool); err != nil {
+		t.Fatal(err)
+	}
+	repo := services.NewPgRepository(pool, 0, 0)
+
+	srv := telegramtest.NewServer(t)
+	runBot(t, srv, repo)
+	chat := &e2eChat{t: t, srv: srv, id: time.Now().UnixNano()}
+
+	start := time.Now().Add(3 * time.Minute).Truncate(time.Second)
+	id, err := repo.InsertEvent(ctx, models.Event{
+		ChatID:    chat.id,
+		Title:     "Настойчивый созвон",
+		StartTime: start,
+		EndTime:   start.Add(30 * time.Minute),
+		Reminders: []models.Reminder{{Offset: 5 * time.Minute}},
+		Nag:       &models.NagPolicy{Interval: time.Minute, MaxRepeats: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := srv.Bot(t)
+	notifierCtx, stopNotifier := context.WithCancel(ctx)
+	notifierDone := make(chan struct{})
+	go func() {
+		defer close(notifierDone)
+		services.StartChatNotifier(notifierCtx, telegram.NewMessenger(api), repo,
+			services.NotifierOptions{Interval: 20 * time.Millisecond}, chat.id)
+	}()
+	defer func() {
+		stopNotifier()
+		<-notifierDone
+	}()
+	reminders := func() []telegramtest.Message {
+		var result []telegramtest.Message
+		for _, m := range srv.Messages(chat.id) {
+			if strings.Contains(m.Text, "Напоминание") {
+				result = append(result, m)
+			}
+		}
+		return result
+	}
+	fastForward := func(query string) {
+		t.Helper()
+		if _, err := pool.Exec(ctx, query, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reminder := chat.wait("Напоминание!")
+	chat.press(reminder, "Отложить 15 мин")
+	if snoozed := chat.wait("⏰ Напомню в"); snoozed.ID != reminder.ID || snoozed.Keyboard != nil {
+		t.Errorf("отложенное напоминание: %+v", snoozed)
+	}
+
+	fastForward(`UPDATE snoozes SET remind_at = now() WHERE event_id = $1 AND sent_at IS NULL`)
+	copied := chat.srv.WaitMessage(t, chat.id, e2eTimeout, func(m telegramtest.Message) bool {
+		return m.ID != reminder.ID && strings.Contains(m.Text, "Настойчивый созвон")
+	})
+	time.Sleep(200 * time.Millisecond)
+	if n := len(reminders()); n != 2 {
+		t.Fatalf("после отложенного напоминания сообщений: %d", n)
+	}
+
+	// Копия перезапустила повторы; «Понятно» их останавливает
+	chat.press(copied, "Понятно")
+	if acked := chat.wait("✅ Принято"); acked.ID != copied.ID {
+		t.Errorf("подтверждено не то сообщение: %+v", acked)
+	}
+	fastForward(`UPDATE nag_states SET next_at = now() WHERE event_id = $1`)
+	time.Sleep(200 * time.Millisecond)
+	if n := len(reminders()); n != 2 {
+		t.Errorf("после подтверждения пришли повторы, сообщений: %d", n)
+	}
+}
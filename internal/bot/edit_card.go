@@ -0,0 +1,224 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+	"github.com/natindo/CalVigil/internal/models"
+	"github.com/natindo/CalVigil/internal/services"
+)
+
+// editFieldAction — кнопки карточки редактирования.
+// Формат callback_data: ef:<поле|done>:<this|all>:<eventID>:<unix повторения или 0>
+const editFieldAction = "ef"
+
+// editFields — поля карточки. Значение поля вводится шагом мастера с тем же именем
+// (см. newWizards), поэтому у каждого поля есть свой диалог edit-field:<поле>.
+var editFields = map[string]bool{
+	stepDate:      true,
+	stepTime:      true,
+	stepDuration:  true,
+	stepReminders: true,
+	stepTitle:     true,
+}
+
+// sendEditCard показывает карточку события с кнопкой на каждое поле.
+// Если messageID не 0, карточка выводится вместо этого сообщения.
+func sendEditCard(bot messenger.Messenger, chatID int64, ev *models.Event, scope string, occStart time.Time, messageID int) {
+	text := editCardText(ev, scope, occStart) + "\n\nЧто изменить?"
+	keyboard := editCardKeyboard(ev, scope, occStart)
+
+	if messageID != 0 {
+		err := bot.EditMessage(chatID, messageID, text, keyboard)
+		if err == nil {
+			return
+		}
+		log.Println("Не удалось отредактировать карточку события:", err)
+	}
+	bot.SendMessage(chatID, text, keyboard)
+}
+
+// editCardText — текущие значения полей события (или выбранного повторения серии)
+func editCardText(ev *models.Event, scope string, occStart time.Time) string {
+	base := *ev
+	header := fmt.Sprintf("Событие ID=%d", ev.ID)
+	if scope == services.ScopeThis {
+		base = ev.Occurrence(occStart)
+		header += ", только повторение " + occStart.Format("2006-01-02")
+	}
+
+	var sb strings.Builder
+	sb.WriteString(header + "\n")
+	sb.WriteString("Название: " + base.Title + "\n")
+	sb.WriteString("Начало: " + base.StartTime.Format("2006-01-02 15:04") + "\n")
+	sb.WriteString("Длительность: " + describeDuration(eventDuration(base.StartTime, base.EndTime)))
+	if scope != services.ScopeThis {
+		sb.WriteString("\nНапоминания: " + describeReminders(ev.ReminderOffsets()))
+		if ev.IsRecurring() {
+			sb.WriteString("\nПовтор: " + describeRecurrence(ev.Recurrence))
+		}
+	}
+	return sb.String()
+}
+
+func editCardKeyboard(ev *models.Event, scope string, occStart time.Time) messenger.Keyboard {
+	unix := "0"
+	if scope == services.ScopeThis {
+		unix = strconv.FormatInt(occStart.Unix(), 10)
+	}
+	button := func(label, field string) messenger.Button {
+		return messenger.NewButton(label,
+			makeCallbackData(editFieldAction, field, scope, strconv.Itoa(ev.ID), unix))
+	}
+
+	rows := [][]messenger.Button{
+		messenger.NewRow(button("Название", "title"), button("Дата", "date")),
+		messenger.NewRow(button("Время", "time"), button("Длительность", "duration")),
+	}
+	if scope != services.ScopeThis {
+		// Напоминания задаются для всей серии
+		rows = append(rows, messenger.NewRow(button("Напоминания", "reminders")))
+	}
+	rows = append(rows, messenger.NewRow(button("Готово", "done")))
+	return messenger.NewKeyboard(rows...)
+}
+
+// handleEditField обрабатывает кнопки карточки: запрашивает новое значение поля
+// тем же шагом, что и мастер создания, в сообщении карточки.
+func handleEditField(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, cq *messenger.Callback, args []string) {
+	if len(args) != 4 {
+		bot.AnswerCallback(cq.ID, "Неизвестное действие")
+		return
+	}
+	field, scope := args[0], args[1]
+	eventID, err1 := strconv.Atoi(args[2])
+	unix, err2 := strconv.ParseInt(args[3], 10, 64)
+	if err1 != nil || err2 != nil || (scope != services.ScopeThis && scope != services.ScopeAll) {
+		bot.AnswerCallback(cq.ID, "Неизвестное действие")
+		return
+	}
+
+	ev, err := repo.GetEventByID(ctx, chatID, eventID)
+	if err != nil || ev == nil {
+		bot.AnswerCallback(cq.ID, "Событие не найдено.")
+		return
+	}
+	var occStart time.Time
+	if scope == services.ScopeThis {
+		occStart = time.Unix(unix, 0).In(ev.StartTime.Location())
+	}
+
+	if field == "done" {
+		if state, _ := loadState(ctx, repo, chatID); state != nil && state.EditField != "" {
+			dropState(ctx, repo, chatID)
+		}
+		bot.AnswerCallback(cq.ID, "")
+		bot.EditMessage(chatID, cq.MessageID, editCardText(ev, scope, occStart), nil)
+		return
+	}
+
+	if !editFields[field] || (field == stepReminders && scope == services.ScopeThis) {
+		bot.AnswerCallback(cq.ID, "Неизвестное действие")
+		return
+	}
+	bot.AnswerCallback(cq.ID, "")
+
+	state := editState(ev, scope, occStart)
+	state.EditField = field
+	state.MessageID = cq.MessageID
+	startWizard(ctx, bot, repo, chatID, editFieldPrefix+field, state)
+}
+
+// saveEditedField сохраняет одно изменённое поле и возвращает карточку события
+func saveEditedField(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, state *models.CreationState) {
+	dropState(ctx, repo, chatID)
+
+	var ev *models.Event
+	var err error
+	if state.EditScope == services.ScopeThis {
+		if err = overrideOccurrenceField(ctx, repo, chatID, state); err == nil {
+			ev, err = repo.GetEventByID(ctx, chatID, state.EditEventID)
+		}
+	} else {
+		ev, err = repo.UpdateEvent(ctx, chatID, state.EditEventID, func(ev *models.Event) {
+			applyEditField(ev, state)
+		})
+	}
+	if errors.Is(err, services.ErrEventNotFound) || (err == nil && ev == nil) {
+		bot.SendMessage(chatID, "Событие не найдено.", nil)
+		return
+	}
+	if err != nil {
+		log.Println("Ошибка при обновлении события:", err)
+		bot.SendMessage(chatID, "Произошла ошибка при сохранении события.", nil)
+		return
+	}
+	sendEditCard(bot, chatID, ev, state.EditScope, state.OccurrenceStart, state.MessageID)
+}
+
+// applyEditField переносит в событие значение поля, введённое в мастере
+func applyEditField(ev *models.Event, state *models.CreationState) {
+	switch state.EditField {
+	case "title":
+		ev.Title = state.Title
+	case "date", "time":
+		// Длительность сохраняется
+		d := eventDuration(ev.StartTime, ev.EndTime)
+		ev.StartTime = state.SelectedStart
+		ev.EndTime = endAfter(ev.StartTime, d)
+	case "duration":
+		// «Весь день» переносит начало на полночь
+		ev.StartTime = state.SelectedStart
+		ev.EndTime = endAfter(ev.StartTime, state.Duration)
+	case "reminders":
+		ev.Reminders = remindersFromOffsets(state.Reminders)
+	}
+}
+
+// overrideOccurrenceField сохраняет изменение одного повторения серии как исключение
+func overrideOccurrenceField(ctx context.Context, repo services.EventRepository, chatID int64, state *models.CreationState) error {
+	ev, err := repo.GetEventByID(ctx, chatID, state.EditEventID)
+	if err != nil {
+		return err
+	}
+	if ev == nil {
+		return services.ErrEventNotFound
+	}
+	occ := ev.Occurrence(state.OccurrenceStart)
+	applyEditField(&occ, state)
+
+	title := occ.Title
+	if title == ev.Title {
+		// Название как у серии — не фиксируем, чтобы повторение следовало за серией
+		title = ""
+	}
+	return repo.OverrideOccurrence(ctx, chatID, ev.ID, state.OccurrenceStart, occ.StartTime, occ.EndTime, title)
+}
+
+// editState — состояние мастера, заполненное значениями события
+// (для ScopeThis/ScopeFollowing — значениями выбранного повторения)
+func editState(ev *models.Event, scope string, occStart time.Time) *models.CreationState {
+	base := *ev
+	if ev.IsRecurring() && scope != services.ScopeAll {
+		base = ev.Occurrence(occStart)
+	}
+	return &models.CreationState{
+		SelectedDate:    base.StartTime,
+		SelectedStart:   base.StartTime,
+		Duration:        eventDuration(base.StartTime, base.EndTime),
+		Reminders:       ev.ReminderOffsets(),
+		Recurrence:      ev.Recurrence,
+		Nag:             ev.Nag,
+		Title:           base.Title,
+		Location:        ev.StartTime.Location(), // события читаются в поясе чата
+		EditEventID:     ev.ID,
+		EditScope:       scope,
+		OccurrenceStart: occStart,
+	}
+}
@@ -1,182 +1,256 @@
 package bot
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strconv"
 	"strings"
 	"time"
 
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/jackc/pgx/v5"
-
+	"github.com/natindo/CalVigil/internal/messenger"
 	"github.com/natindo/CalVigil/internal/models"
 	"github.com/natindo/CalVigil/internal/services"
 )
 
-// userCreationState хранит в памяти шаги создания события. Для продакшена можно сохранять в БД.
-var userCreationState = make(map[int64]*models.CreationState)
-
-func handleCommand(bot *tgbotapi.BotAPI, dbConn *pgx.Conn, msg *tgbotapi.Message) {
+func handleCommand(ctx context.Context, bot messenger.Messenger, repo services.Store, msg *messenger.Message) {
 	switch msg.Command() {
 	case "start":
-		cmdStart(bot, msg)
+		cmdStart(ctx, bot, repo, msg)
 	case "help":
-		cmdHelp(bot, msg)
+		cmdHelp(bot, repo, msg)
 	case "list":
-		cmdList(bot, dbConn, msg)
+		cmdList(ctx, bot, repo, msg)
+	case "agenda":
+		cmdAgenda(ctx, bot, repo, msg, agendaDay)
+	case "week":
+		cmdAgenda(ctx, bot, repo, msg, agendaWeek)
+	case "month":
+		cmdAgenda(ctx, bot, repo, msg, agendaMonth)
 	case "create":
-		cmdCreate(bot, msg)
+		cmdCreate(ctx, bot, repo, msg)
+	case "cancel":
+		cmdCancel(ctx, bot, repo, msg)
+	case "add":
+		cmdAdd(ctx, bot, repo, msg)
+	case "timezone":
+		cmdTimezone(ctx, bot, repo, msg)
 	case "delete":
-		cmdDelete(bot, dbConn, msg)
+		cmdDelete(ctx, bot, repo, msg)
 	case "update":
-		cmdUpdate(bot, dbConn, msg)
+		cmdUpdate(ctx, bot, repo, msg)
 	default:
 		unknownCommand(bot, msg)
 	}
 }
 
-func cmdStart(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) {
+// cmdStart здоровается и снова включает напоминания, если они были отключены из-за того,
+// что бот не мог писать в чат: в Telegram /start приходит, когда бота разблокируют
+func cmdStart(ctx context.Context, bot messenger.Messenger, repo services.Store, msg *messenger.Message) {
+	if err := repo.ResumeReminders(ctx, msg.ChatID); err != nil {
+		log.Println("Ошибка ResumeReminders:", err)
+	}
 	text := "Привет! Я бот-планировщик.\n" +
 		"Доступные команды:\n" +
 		"/create — пошагово создать событие\n" +
+		"/cancel — прервать создание или изменение события\n" +
+		"/add <описание> — создать событие одной строкой\n" +
 		"/list — показать события на сегодня\n" +
-		"/delete <id> — удалить событие\n" +
-		"/update <id> — изменить событие\n" +
+		"/agenda [дата], /week, /month — расписание на день, неделю, месяц\n" +
+		"/delete <id> [дата] — удалить событие\n" +
+		"/update <id> [дата] — изменить событие\n" +
+		"/timezone — часовой пояс чата\n" +
 		"/help — справка"
-	bot.Send(tgbotapi.NewMessage(msg.Chat.ID, text))
+	bot.SendMessage(msg.ChatID, text, nil)
 }
 
-func cmdHelp(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) {
+func cmdHelp(bot messenger.Messenger, repo services.StateStore, msg *messenger.Message) {
 	text := "Справка:\n" +
 		"/create — начать диалог по созданию события\n" +
+		"    Кнопка «Назад» возвращает к предыдущему шагу, «Пропустить» оставляет уже введённое значение,\n" +
+		"    /cancel или «Отмена» — прерывают диалог.\n" +
+		"    Незавершённый диалог сохраняется и продолжится после перезапуска бота; " +
+		"без ответа дольше " + models.FormatOffset(repo.DialogTTL()) + " он прерывается.\n" +
+		"/add <описание> — создать событие одной строкой, например:\n" +
+		"    /add завтра в 15:00 созвон с командой 45м напомни за 10м\n" +
+		"    В личном чате можно просто написать описание без команды.\n" +
 		"/list — показать события на сегодня\n" +
-		"/delete <id> — удалить событие\n" +
-		"/update <id> — изменить событие\n"
-	bot.Send(tgbotapi.NewMessage(msg.Chat.ID, text))
+		"/agenda [YYYY-MM-DD] — события за день (по умолчанию сегодня)\n" +
+		"/week [YYYY-MM-DD] — события за неделю\n" +
+		"/month [YYYY-MM-DD] — события за месяц\n" +
+		"    Кнопки ◀ ▶ листают дни, недели или месяцы в том же сообщении.\n" +
+		"/delete <id> [дата] — удалить событие или повторение серии\n" +
+		"/update <id> [дата] — изменить событие или повторение серии\n" +
+		"/update открывает карточку события: название, дату, время, длительность " +
+		"и напоминания можно менять по отдельности, ID события сохраняется.\n" +
+		"/timezone [пояс] — показать или сменить часовой пояс чата (например, Europe/Berlin); " +
+		"даты и время вводятся и показываются в нём.\n" +
+		"Для повторяющихся событий бот спросит, менять только это повторение, " +
+		"это и последующие или всю серию.\n"
+	bot.SendMessage(msg.ChatID, text, nil)
 }
 
-func cmdList(bot *tgbotapi.BotAPI, dbConn *pgx.Conn, msg *tgbotapi.Message) {
-	evs, err := services.GetEventsForToday(dbConn, msg.Chat.ID, time.Now())
+func cmdList(ctx context.Context, bot messenger.Messenger, repo services.Store, msg *messenger.Message) {
+	evs, err := repo.GetEventsForToday(ctx, msg.ChatID, chatNow(ctx, repo, msg.ChatID))
 	if err != nil {
 		log.Println("Ошибка при GetEventsForToday:", err)
-		bot.Send(tgbotapi.NewMessage(msg.Chat.ID, "Ошибка при получении списка событий"))
+		bot.SendMessage(msg.ChatID, "Ошибка при получении списка событий", nil)
 		return
 	}
 	if len(evs) == 0 {
-		bot.Send(tgbotapi.NewMessage(msg.Chat.ID, "На сегодня нет событий."))
+		bot.SendMessage(msg.ChatID, "На сегодня нет событий.", nil)
 		return
 	}
 
-	var sb strings.Builder
-	sb.WriteString("Ваши события на сегодня:\n")
+	lines := []string{"Ваши события на сегодня:\n"}
 	for i, e := range evs {
 		startStr := e.StartTime.Format("15:04")
 		endStr := e.EndTime.Format("15:04")
-		sb.WriteString(fmt.Sprintf("%d) ID=%d | %s (%s - %s)\n", i+1, e.ID, e.Title, startStr, endStr))
+		repeat := ""
+		if e.IsRecurring() {
+			repeat = " 🔁"
+		}
+		lines = append(lines, fmt.Sprintf("%d) ID=%d | %s (%s - %s)%s\n", i+1, e.ID, e.Title, startStr, endStr, repeat))
+	}
+	// Длинный список отправляется несколькими сообщениями, кнопка — под последним
+	pages := splitText(lines, messageLimit)
+	for _, page := range pages[:len(pages)-1] {
+		bot.SendMessage(msg.ChatID, page, nil)
 	}
 
 	// Пример inline-кнопки: «Удалить все события за сегодня»
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Удалить все за сегодня", "delete_all_today"),
+	keyboard := messenger.NewKeyboard(
+		messenger.NewRow(
+			messenger.NewButton("Удалить все за сегодня", "delete_all_today"),
 		),
 	)
-	message := tgbotapi.NewMessage(msg.Chat.ID, sb.String())
-	message.ReplyMarkup = keyboard
-	bot.Send(message)
+	bot.SendMessage(msg.ChatID, pages[len(pages)-1], keyboard)
 }
 
-func cmdCreate(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) {
+func cmdCreate(ctx context.Context, bot messenger.Messenger, repo services.Store, msg *messenger.Message) {
 	// Инициализируем состояние
-	userCreationState[msg.Chat.ID] = &models.CreationState{
-		Step:         1,
-		NotifyBefore: 5, // по умолчанию 5 минут
+	state := &models.CreationState{
+		Reminders: defaultReminders(),
+		Location:  chatLocation(ctx, repo, msg.ChatID),
 	}
-
-	text := "Приступим к созданию события.\nВыберите дату или введите её (формат YYYY-MM-DD):"
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Сегодня", "date_today"),
-			tgbotapi.NewInlineKeyboardButtonData("Завтра", "date_tomorrow"),
-		),
-	)
-	msgOut := tgbotapi.NewMessage(msg.Chat.ID, text)
-	msgOut.ReplyMarkup = keyboard
-	bot.Send(msgOut)
+	startWizard(ctx, bot, repo, msg.ChatID, createDialog, state)
 }
 
-func cmdDelete(bot *tgbotapi.BotAPI, dbConn *pgx.Conn, msg *tgbotapi.Message) {
-	args := msg.CommandArguments()
-	if args == "" {
-		bot.Send(tgbotapi.NewMessage(msg.Chat.ID, "Укажите ID события: /delete 123"))
+func cmdDelete(ctx context.Context, bot messenger.Messenger, repo services.Store, msg *messenger.Message) {
+	ev, occStart, ok := resolveEventArgs(ctx, bot, repo, msg, "/delete 123")
+	if !ok {
 		return
 	}
-	id, err := strconv.Atoi(args)
-	if err != nil {
-		bot.Send(tgbotapi.NewMessage(msg.Chat.ID, "Некорректный ID."))
+
+	if !ev.IsRecurring() {
+		err := repo.DeleteEvent(ctx, msg.ChatID, ev.ID)
+		if err != nil {
+			bot.SendMessage(msg.ChatID, fmt.Sprintf("Ошибка при удалении: %v", err), nil)
+			return
+		}
+		bot.SendMessage(msg.ChatID, "Событие удалено.", nil)
 		return
 	}
 
-	err = services.DeleteEvent(dbConn, msg.Chat.ID, id)
-	if err != nil {
-		bot.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("Ошибка при удалении: %v", err)))
+	sendScopeChoice(bot, msg.ChatID, "delete", ev, occStart)
+}
+
+func cmdUpdate(ctx context.Context, bot messenger.Messenger, repo services.Store, msg *messenger.Message) {
+	ev, occStart, ok := resolveEventArgs(ctx, bot, repo, msg, "/update 123")
+	if !ok {
 		return
 	}
-	bot.Send(tgbotapi.NewMessage(msg.Chat.ID, "Событие удалено."))
-}
 
-func cmdUpdate(bot *tgbotapi.BotAPI, dbConn *pgx.Conn, msg *tgbotapi.Message) {
-	args := msg.CommandArguments()
-	if args == "" {
-		bot.Send(tgbotapi.NewMessage(msg.Chat.ID, "Укажите ID события: /update 123"))
+	if !ev.IsRecurring() {
+		sendEditCard(bot, msg.ChatID, ev, services.ScopeAll, time.Time{}, 0)
 		return
 	}
-	id, err := strconv.Atoi(args)
+
+	sendScopeChoice(bot, msg.ChatID, "update", ev, occStart)
+}
+
+// resolveEventArgs разбирает аргументы "<id> [YYYY-MM-DD]" команд /delete и /update.
+// Для повторяющегося события возвращает исходное начало выбранного повторения:
+// в указанную дату или ближайшее предстоящее.
+func resolveEventArgs(ctx context.Context, bot messenger.Messenger, repo services.Store, msg *messenger.Message, usage string) (*models.Event, time.Time, bool) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		bot.SendMessage(msg.ChatID, "Укажите ID события: "+usage+
+			"\nДля повторяющегося события можно добавить дату повторения: "+usage+" 2025-01-31", nil)
+		return nil, time.Time{}, false
+	}
+	id, err := strconv.Atoi(args[0])
 	if err != nil {
-		bot.Send(tgbotapi.NewMessage(msg.Chat.ID, "Некорректный ID."))
-		return
+		bot.SendMessage(msg.ChatID, "Некорректный ID.", nil)
+		return nil, time.Time{}, false
 	}
 
-	ev, err := services.GetEventByID(dbConn, msg.Chat.ID, id)
+	ev, err := repo.GetEventByID(ctx, msg.ChatID, id)
 	if err != nil {
-		bot.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("Ошибка при получении события: %v", err)))
-		return
+		bot.SendMessage(msg.ChatID, fmt.Sprintf("Ошибка при получении события: %v", err), nil)
+		return nil, time.Time{}, false
 	}
 	if ev == nil {
-		bot.Send(tgbotapi.NewMessage(msg.Chat.ID, "Событие не найдено."))
-		return
+		bot.SendMessage(msg.ChatID, "Событие не найдено.", nil)
+		return nil, time.Time{}, false
+	}
+	if !ev.IsRecurring() {
+		return ev, time.Time{}, true
 	}
 
-	// «Удаляем» старое событие, чтобы пересоздать (упрощённо)
-	err = services.DeleteEvent(dbConn, msg.Chat.ID, id)
-	if err != nil {
-		bot.Send(tgbotapi.NewMessage(msg.Chat.ID, "Ошибка при подготовке к редактированию."))
-		return
+	var occ models.Event
+	var found bool
+	if len(args) > 1 {
+		day, err := time.ParseInLocation("2006-01-02", args[1], ev.StartTime.Location())
+		if err != nil {
+			bot.SendMessage(msg.ChatID, "Не удалось распознать дату, формат YYYY-MM-DD.", nil)
+			return nil, time.Time{}, false
+		}
+		occ, found = ev.OccurrenceOn(day)
+	} else {
+		occ, found = ev.NextOccurrence(time.Now())
 	}
+	if !found {
+		bot.SendMessage(msg.ChatID, "У серии нет повторения на эту дату.", nil)
+		return nil, time.Time{}, false
+	}
+	return ev, occ.OccurrenceStart, true
+}
 
-	// Инициализируем state
-	userCreationState[msg.Chat.ID] = &models.CreationState{
-		Step:          1,
-		SelectedDate:  ev.StartTime,
-		SelectedStart: ev.StartTime,
-		Duration:      ev.EndTime.Sub(ev.StartTime),
-		NotifyBefore:  ev.NotifyBefore,
-		Title:         ev.Title,
+// sendScopeChoice спрашивает, к каким повторениям серии применить действие
+func sendScopeChoice(bot messenger.Messenger, chatID int64, action string, ev *models.Event, occStart time.Time) {
+	occ := ev.Occurrence(occStart)
+	verb := "Удалить"
+	if action == "update" {
+		verb = "Изменить"
 	}
+	text := fmt.Sprintf("«%s» — повторяющееся событие (%s).\n%s повторение %s, это и последующие или всю серию?",
+		ev.Title, describeRecurrence(ev.Recurrence), verb, occ.StartTime.Format("2006-01-02 15:04"))
 
-	text := "Обновление события.\nСначала выберите/введите дату (YYYY-MM-DD)."
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Сегодня", "date_today"),
-			tgbotapi.NewInlineKeyboardButtonData("Завтра", "date_tomorrow"),
+	data := func(scope string) string {
+		return makeCallbackData("scope", action, scope, strconv.Itoa(ev.ID), strconv.FormatInt(occStart.Unix(), 10))
+	}
+	keyboard := messenger.NewKeyboard(
+		messenger.NewRow(
+			messenger.NewButton("Только это", data(services.ScopeThis)),
+		),
+		messenger.NewRow(
+			messenger.NewButton("Это и последующие", data(services.ScopeFollowing)),
+		),
+		messenger.NewRow(
+			messenger.NewButton("Всю серию", data(services.ScopeAll)),
 		),
 	)
-	msgOut := tgbotapi.NewMessage(msg.Chat.ID, text)
-	msgOut.ReplyMarkup = keyboard
-	bot.Send(msgOut)
+	bot.SendMessage(chatID, text, keyboard)
+}
+
+// startEditWizard запускает пошаговое редактирование события с заполненными значениями
+// (правка «это и последующие»: на последнем шаге серия делится на две).
+// Событие остаётся в БД до последнего шага, поэтому брошенный диалог ничего не теряет.
+func startEditWizard(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, ev *models.Event, scope string, occStart time.Time) {
+	startWizard(ctx, bot, repo, chatID, followDialog, editState(ev, scope, occStart))
 }
 
-func unknownCommand(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) {
-	bot.Send(tgbotapi.NewMessage(msg.Chat.ID, "Неизвестная команда. Используйте /help"))
+func unknownCommand(bot messenger.Messenger, msg *messenger.Message) {
+	bot.SendMessage(msg.ChatID, "Неизвестная команда. Используйте /help", nil)
 }
@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// messageLimit — максимальная длина текста сообщения Telegram (в UTF-16 символах)
+const messageLimit = 4096
+
+// textLen — длина строки так, как её считает Telegram
+func textLen(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// splitText раскладывает блоки текста по страницам не длиннее limit.
+// Блок (например, день со списком событий) по возможности не разрывается;
+// слишком длинный блок делится по строкам, а слишком длинная строка — по символам.
+func splitText(blocks []string, limit int) []string {
+	var pages []string
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			pages = append(pages, strings.TrimRight(cur.String(), "\n"))
+			cur.Reset()
+		}
+	}
+	add := func(piece string) {
+		if cur.Len() > 0 && textLen(cur.String())+textLen(piece) > limit {
+			flush()
+		}
+		cur.WriteString(piece)
+	}
+
+	for _, block := range blocks {
+		if textLen(block) <= limit {
+			add(block)
+			continue
+		}
+		for _, line := range strings.SplitAfter(block, "\n") {
+			// Перевод строки в конце страницы отбрасывается и в лимит не входит
+			for textLen(strings.TrimSuffix(line, "\n")) > limit {
+				head := truncateText(line, limit)
+				flush()
+				pages = append(pages, head)
+				line = line[len(head):]
+			}
+			add(line)
+		}
+	}
+	flush()
+	return pages
+}
+
+// truncateText возвращает самое длинное начало s длиной не больше limit
+func truncateText(s string, limit int) string {
+	n := 0
+	for i, r := range s {
+		n += len(utf16.Encode([]rune{r}))
+		if n > limit {
+			return s[:i]
+		}
+	}
+	return s
+}
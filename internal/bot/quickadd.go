@@ -0,0 +1,131 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+	"github.com/natindo/CalVigil/internal/models"
+	"github.com/natindo/CalVigil/internal/quickadd"
+	"github.com/natindo/CalVigil/internal/services"
+)
+
+// quickAddHint — подсказка с примерами быстрого добавления
+const quickAddHint = "Примеры:\n" +
+	"/add завтра в 15:00 созвон с командой 45м\n" +
+	"/add в пятницу в 19:00 кино напомни за 1ч и 10м\n" +
+	"/add через 2 часа позвонить маме\n" +
+	"/add 31.12 новый год весь день"
+
+// cmdAdd создаёт событие из описания одной строкой: /add завтра в 15:00 созвон 45м
+func cmdAdd(ctx context.Context, bot messenger.Messenger, repo services.Store, msg *messenger.Message) {
+	text := strings.TrimSpace(msg.CommandArguments())
+	if text == "" {
+		bot.SendMessage(msg.ChatID, "Опишите событие одной строкой.\n"+quickAddHint, nil)
+		return
+	}
+	quickAdd(ctx, bot, repo, msg.ChatID, text)
+}
+
+// handleFreeText обрабатывает сообщение без команды вне мастера:
+// в личном чате текст считается описанием события для быстрого добавления.
+func handleFreeText(ctx context.Context, bot messenger.Messenger, repo services.Store, msg *messenger.Message) {
+	if !msg.Private || strings.TrimSpace(msg.Text) == "" {
+		return
+	}
+	quickAdd(ctx, bot, repo, msg.ChatID, msg.Text)
+}
+
+// quickAdd разбирает описание, сохраняет событие и отправляет карточку с кнопкой «Изменить»
+func quickAdd(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, text string) {
+	res, err := quickadd.Parse(text, chatNow(ctx, repo, chatID))
+	if err != nil {
+		reply := "Не удалось разобрать событие."
+		switch {
+		case errors.Is(err, quickadd.ErrNoDateTime):
+			reply = "Не понял, когда событие: укажите дату или время."
+		case errors.Is(err, quickadd.ErrNoTitle):
+			reply = "Не указано название события."
+		}
+		bot.SendMessage(chatID, reply+"\n"+quickAddHint, nil)
+		return
+	}
+
+	offsets := res.Reminders
+	if offsets == nil && !res.AllDay {
+		offsets = defaultReminders() // как в /create
+	}
+	ev := models.Event{
+		ChatID:    chatID,
+		Title:     res.Title,
+		StartTime: res.Start,
+		EndTime:   endAfter(res.Start, res.Duration),
+		Reminders: remindersFromOffsets(offsets),
+	}
+	id, err := repo.InsertEvent(ctx, ev)
+	if err != nil {
+		log.Println("Ошибка InsertEvent:", err)
+		bot.SendMessage(chatID, "Произошла ошибка при сохранении события.", nil)
+		return
+	}
+
+	keyboard := messenger.NewKeyboard(
+		messenger.NewRow(
+			messenger.NewButton("Изменить", makeCallbackData("edit", strconv.Itoa(id))),
+		),
+	)
+	bot.SendMessage(chatID, fmt.Sprintf("Событие создано (ID=%d):\n%s", id, describeQuickAdd(res, offsets)), keyboard)
+}
+
+// describeQuickAdd — карточка события, созданного быстрым добавлением
+func describeQuickAdd(res *quickadd.Result, offsets []time.Duration) string {
+	var when string
+	switch {
+	case res.AllDay && res.Duration == 24*time.Hour:
+		when = res.Start.Format("2006-01-02") + ", весь день"
+	case res.AllDay:
+		when = fmt.Sprintf("%s, %s", res.Start.Format("2006-01-02"), describeDuration(res.Duration))
+	default:
+		// Окончание — как у сохранённого события; дата указывается, если оно в другой день
+		end := endAfter(res.Start, res.Duration)
+		when = fmt.Sprintf("%s – %s (%s)", res.Start.Format("2006-01-02 15:04"),
+			clockOn(end, startOfDay(res.Start)), describeDuration(res.Duration))
+	}
+	return fmt.Sprintf("%s\nКогда: %s\nНапоминания: %s", res.Title, when, describeReminders(offsets))
+}
+
+// handleEditButton обрабатывает кнопку «Изменить» под карточкой события.
+// Формат callback_data: edit:<eventID>
+func handleEditButton(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, cq *messenger.Callback, args []string) {
+	if len(args) != 1 {
+		bot.AnswerCallback(cq.ID, "Неизвестное действие")
+		return
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		bot.AnswerCallback(cq.ID, "Неизвестное действие")
+		return
+	}
+	ev, err := repo.GetEventByID(ctx, chatID, id)
+	if err != nil || ev == nil {
+		bot.AnswerCallback(cq.ID, "Событие не найдено.")
+		return
+	}
+	bot.AnswerCallback(cq.ID, "")
+
+	if !ev.IsRecurring() {
+		sendEditCard(bot, chatID, ev, services.ScopeAll, time.Time{}, cq.MessageID)
+		return
+	}
+	occ, found := ev.NextOccurrence(time.Now())
+	if !found {
+		sendEditCard(bot, chatID, ev, services.ScopeAll, time.Time{}, cq.MessageID)
+		return
+	}
+	sendScopeChoice(bot, chatID, "update", ev, occ.OccurrenceStart)
+}
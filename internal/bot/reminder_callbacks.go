@@ -0,0 +1,109 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+	"github.com/natindo/CalVigil/internal/models"
+	"github.com/natindo/CalVigil/internal/services"
+)
+
+// handleSnooze обрабатывает кнопки «Отложить» под напоминанием.
+// Формат callback_data: snooze:<минуты|start>:<eventID>:<unix повторения>
+func handleSnooze(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, cq *messenger.Callback, args []string) {
+	if len(args) != 3 {
+		bot.AnswerCallback(cq.ID, "Неизвестное действие")
+		return
+	}
+	occ, ok := loadOccurrence(ctx, bot, repo, chatID, cq, args[1], args[2])
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	var remindAt time.Time
+	if args[0] == "start" {
+		remindAt = occ.StartTime
+		if !remindAt.After(now) {
+			bot.AnswerCallback(cq.ID, "Событие уже началось.")
+			return
+		}
+	} else {
+		mins, err := strconv.Atoi(args[0])
+		if err != nil || mins <= 0 {
+			bot.AnswerCallback(cq.ID, "Неизвестное действие")
+			return
+		}
+		remindAt = now.Add(time.Duration(mins) * time.Minute)
+	}
+
+	// Отложенное напоминание само перезапустит повторы, текущие останавливаем
+	if err := repo.AcknowledgeOccurrence(ctx, chatID, occ.ID, occ.OccurrenceKey()); err != nil {
+		log.Println("Ошибка AcknowledgeOccurrence:", err)
+	}
+	err := repo.ScheduleSnooze(ctx, chatID, occ.ID, occ.OccurrenceKey(), remindAt)
+	if err != nil {
+		log.Println("Ошибка ScheduleSnooze:", err)
+		bot.AnswerCallback(cq.ID, "Не удалось отложить напоминание.")
+		return
+	}
+
+	note := "Напомню в " + remindAt.In(occ.StartTime.Location()).Format("15:04")
+	bot.AnswerCallback(cq.ID, note)
+	closeReminder(bot, cq, "⏰ "+note)
+}
+
+// handleAck обрабатывает кнопку «Понятно» под напоминанием.
+// Формат callback_data: ack:<eventID>:<unix повторения>
+func handleAck(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, cq *messenger.Callback, args []string) {
+	if len(args) != 2 {
+		bot.AnswerCallback(cq.ID, "Неизвестное действие")
+		return
+	}
+	occ, ok := loadOccurrence(ctx, bot, repo, chatID, cq, args[0], args[1])
+	if !ok {
+		return
+	}
+	if err := repo.AcknowledgeOccurrence(ctx, chatID, occ.ID, occ.OccurrenceKey()); err != nil {
+		log.Println("Ошибка AcknowledgeOccurrence:", err)
+		bot.AnswerCallback(cq.ID, "Не удалось подтвердить напоминание.")
+		return
+	}
+	bot.AnswerCallback(cq.ID, "Принято")
+	closeReminder(bot, cq, "✅ Принято")
+}
+
+// loadOccurrence находит повторение события по ID и исходному началу (unix)
+func loadOccurrence(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, cq *messenger.Callback, idStr, unixStr string) (models.Event, bool) {
+	eventID, err1 := strconv.Atoi(idStr)
+	unix, err2 := strconv.ParseInt(unixStr, 10, 64)
+	if err1 != nil || err2 != nil {
+		bot.AnswerCallback(cq.ID, "Неизвестное действие")
+		return models.Event{}, false
+	}
+
+	ev, err := repo.GetEventByID(ctx, chatID, eventID)
+	if err != nil || ev == nil {
+		bot.AnswerCallback(cq.ID, "Событие не найдено.")
+		return models.Event{}, false
+	}
+	if !ev.IsRecurring() {
+		return *ev, true
+	}
+	occStart := time.Unix(unix, 0).In(ev.StartTime.Location())
+	if ev.OccurrenceCancelled(occStart) {
+		bot.AnswerCallback(cq.ID, "Это повторение отменено.")
+		return models.Event{}, false
+	}
+	return ev.Occurrence(occStart), true
+}
+
+// closeReminder убирает кнопки с сообщения-напоминания и дописывает отметку
+func closeReminder(bot messenger.Messenger, cq *messenger.Callback, note string) {
+	text := fmt.Sprintf("%s\n\n%s", cq.MessageText, note)
+	bot.EditMessage(cq.ChatID, cq.MessageID, text, nil)
+}
@@ -0,0 +1,172 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/natindo/CalVigil/internal/models"
+)
+
+// DefaultReminder — напоминание о новом событии, если пользователь не указал своих;
+// 0 — без напоминания. Задаётся из конфигурации при запуске.
+var DefaultReminder = 5 * time.Minute
+
+// defaultReminders — напоминания нового события по умолчанию
+func defaultReminders() []time.Duration {
+	if DefaultReminder <= 0 {
+		return nil
+	}
+	return []time.Duration{DefaultReminder}
+}
+
+// reminderUnits — суффиксы единиц в списке напоминаний ("1d, 1h, 10m", "1 д 2 ч")
+var reminderUnits = map[string]time.Duration{
+	"m": time.Minute, "min": time.Minute, "м": time.Minute, "мин": time.Minute,
+	"h": time.Hour, "ч": time.Hour,
+	"d": 24 * time.Hour, "д": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour, "н": 7 * 24 * time.Hour, "нед": 7 * 24 * time.Hour,
+}
+
+// parseReminderOffsets разбирает список напоминаний вида "1d, 1h, 10m": напоминания
+// разделяются запятой или точкой с запятой, а внутри одного единицы складываются
+// ("1 д 2 ч" — одно напоминание за 26 часов, как его показывает models.FormatOffset).
+// Число без единицы считается минутами. «нет» — без напоминаний.
+// Возвращает смещения без повторов, от большего к меньшему.
+func parseReminderOffsets(s string) ([]time.Duration, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "нет" || s == "-" || s == "no" || s == "none" {
+		return nil, nil
+	}
+
+	var fields []string
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' }) {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("пустой список напоминаний")
+	}
+
+	seen := make(map[time.Duration]bool)
+	var result []time.Duration
+	for _, f := range fields {
+		// «за 1 д» — так напоминание записано в карточке события
+		d, err := parseReminderOffset(strings.TrimSpace(strings.TrimPrefix(f, "за ")))
+		if err != nil {
+			return nil, err
+		}
+		if !seen[d] {
+			seen[d] = true
+			result = append(result, d)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] > result[j] })
+	return result, nil
+}
+
+// parseReminderOffset разбирает одно смещение — сумму чисел с единицами: "10", "10m",
+// "1h30m", "2д", "1 д 2 ч 10 мин"
+func parseReminderOffset(s string) (time.Duration, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 {
+			return 0, fmt.Errorf("отрицательное напоминание %q", s)
+		}
+		return time.Duration(n) * time.Minute, nil
+	}
+
+	var total time.Duration
+	rest := []rune(s)
+	skipSpaces := func() {
+		for len(rest) > 0 && unicode.IsSpace(rest[0]) {
+			rest = rest[1:]
+		}
+	}
+	for skipSpaces(); len(rest) > 0; skipSpaces() {
+		i := 0
+		for i < len(rest) && unicode.IsDigit(rest[i]) {
+			i++
+		}
+		number := rest[:i]
+		rest = rest[i:]
+		skipSpaces()
+		j := 0
+		for j < len(rest) && unicode.IsLetter(rest[j]) {
+			j++
+		}
+		if len(number) == 0 || j == 0 {
+			return 0, fmt.Errorf("не удалось разобрать напоминание %q", s)
+		}
+		n, _ := strconv.Atoi(string(number))
+		unit, ok := reminderUnits[string(rest[:j])]
+		if !ok {
+			return 0, fmt.Errorf("неизвестная единица в %q", s)
+		}
+		total += time.Duration(n) * unit
+		rest = rest[j:]
+	}
+	return total, nil
+}
+
+// remindersFromOffsets превращает смещения в напоминания для models.Event
+func remindersFromOffsets(offsets []time.Duration) []models.Reminder {
+	result := make([]models.Reminder, 0, len(offsets))
+	for _, d := range offsets {
+		result = append(result, models.Reminder{Offset: d})
+	}
+	return result
+}
+
+// describeReminders — «за 1 д, за 10 мин» или «без напоминаний»
+func describeReminders(offsets []time.Duration) string {
+	if len(offsets) == 0 {
+		return "без напоминаний"
+	}
+	parts := make([]string, 0, len(offsets))
+	for _, d := range offsets {
+		if d == 0 {
+			parts = append(parts, "в момент начала")
+			continue
+		}
+		parts = append(parts, "за "+models.FormatOffset(d))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// parseNagPolicy разбирает режим повторов напоминания: "<интервал> <число повторов>",
+// например "5m 6" или "10 x 3". «нет» — без повторов.
+func parseNagPolicy(s string) (*models.NagPolicy, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "нет" || s == "-" || s == "no" || s == "none" {
+		return nil, nil
+	}
+
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == 'x' || r == 'х' || r == '*' || r == ',' || unicode.IsSpace(r)
+	})
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("ожидается интервал и число повторов")
+	}
+	interval, err := parseReminderOffset(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	if interval < time.Minute {
+		return nil, fmt.Errorf("интервал должен быть не меньше минуты")
+	}
+	repeats, err := strconv.Atoi(fields[1])
+	if err != nil || repeats < 1 || repeats > 100 {
+		return nil, fmt.Errorf("некорректное число повторов %q", fields[1])
+	}
+	return &models.NagPolicy{Interval: interval, MaxRepeats: repeats}, nil
+}
+
+// describeNag — «повторять каждые 5 мин, до 6 раз, пока не подтвердите»
+func describeNag(nag *models.NagPolicy) string {
+	return fmt.Sprintf("Повторять напоминание каждые %s, до %d раз, пока не подтвердите",
+		models.FormatOffset(nag.Interval), nag.MaxRepeats)
+}
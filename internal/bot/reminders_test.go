@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/models"
+)
+
+func TestParseReminderOffsets(t *testing.T) {
+	const day = 24 * time.Hour
+	tests := []struct {
+		in   string
+		want []time.Duration
+	}{
+		{"1d, 1h, 10m", []time.Duration{day, time.Hour, 10 * time.Minute}},
+		{"10m; 1h;1d", []time.Duration{day, time.Hour, 10 * time.Minute}},
+		{"15", []time.Duration{15 * time.Minute}},
+		{"0", []time.Duration{0}},
+		// Внутри одного напоминания единицы складываются
+		{"1д 2ч", []time.Duration{26 * time.Hour}},
+		{"1h30m, 2 нед", []time.Duration{14 * day, 90 * time.Minute}},
+		// Так напоминания показываются в карточке события
+		{"1 д 2 ч 10 мин", []time.Duration{26*time.Hour + 10*time.Minute}},
+		{"за 1 д, за 10 мин", []time.Duration{day, 10 * time.Minute}},
+		// Повторы убираются
+		{"1h, 60m, 60, 1ч", []time.Duration{time.Hour}},
+		{"нет", nil},
+		{"  None ", nil},
+		{"-", nil},
+	}
+	for _, tt := range tests {
+		got, err := parseReminderOffsets(tt.in)
+		if err != nil || fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("parseReminderOffsets(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", " , ;", "abc", "10x", "1 2", "-5", "h1", "1d,, 2y", "10 мин 5"} {
+		if got, err := parseReminderOffsets(in); err == nil {
+			t.Errorf("parseReminderOffsets(%q) = %v, ошибка не обнаружена", in, got)
+		}
+	}
+}
+
+// TestReminderOffsetRoundTrip — всё, что показывает models.FormatOffset, можно ввести обратно
+func TestReminderOffsetRoundTrip(t *testing.T) {
+	for _, d := range []time.Duration{time.Minute, 90 * time.Minute, 26*time.Hour + 10*time.Minute, 8 * 24 * time.Hour} {
+		got, err := parseReminderOffsets(models.FormatOffset(d))
+		if err != nil || len(got) != 1 || got[0] != d {
+			t.Errorf("%s: %v, %v", models.FormatOffset(d), got, err)
+		}
+	}
+}
+
+func TestParseNagPolicy(t *testing.T) {
+	tests := []struct {
+		in   string
+		want *models.NagPolicy
+	}{
+		{"5m 6", &models.NagPolicy{Interval: 5 * time.Minute, MaxRepeats: 6}},
+		{"10 x 3", &models.NagPolicy{Interval: 10 * time.Minute, MaxRepeats: 3}},
+		{"1h х 2", &models.NagPolicy{Interval: time.Hour, MaxRepeats: 2}},
+		{"15м*4", &models.NagPolicy{Interval: 15 * time.Minute, MaxRepeats: 4}},
+		{"2ч, 100", &models.NagPolicy{Interval: 2 * time.Hour, MaxRepeats: 100}},
+		{"нет", nil},
+		{" NO ", nil},
+	}
+	for _, tt := range tests {
+		got, err := parseNagPolicy(tt.in)
+		if err != nil || (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("parseNagPolicy(%q) = %+v, %v; want %+v", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "5m", "5m 6 7", "0 3", "30s 3", "5m 0", "5m 101", "5m много", "abc 3"} {
+		if got, err := parseNagPolicy(in); err == nil {
+			t.Errorf("parseNagPolicy(%q) = %+v, ошибка не обнаружена", in, got)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+)
+
+// Callback-действия выбора времени и длительности:
+//
+//	tp:add:-60 — сдвинуть время начала на N минут
+//	tp:set:0930 — установить время начала
+//	tp:ok       — подтвердить время
+//	dur:30      — длительность в минутах
+//	dur:allday  — весь день
+const (
+	timePickerAction = "tp"
+	timePickerAdd    = "add"
+	timePickerSet    = "set"
+	timePickerOK     = "ok"
+
+	durationAction = "dur"
+	durationAllDay = "allday"
+)
+
+// timePickerKeyboard — степперы часов и минут вокруг текущего значения start
+func timePickerKeyboard(start time.Time) messenger.Keyboard {
+	add := func(label string, mins int) messenger.Button {
+		return messenger.NewButton(label, makeCallbackData(timePickerAction, timePickerAdd, strconv.Itoa(mins)))
+	}
+	set := func(hh, mm int) messenger.Button {
+		return messenger.NewButton(
+			fmt.Sprintf("%02d:%02d", hh, mm),
+			makeCallbackData(timePickerAction, timePickerSet, fmt.Sprintf("%02d%02d", hh, mm)),
+		)
+	}
+
+	return messenger.NewKeyboard(
+		messenger.NewRow(
+			add("−1 ч", -60),
+			messenger.NewButton(start.Format("15:04"), makeCallbackData(timePickerAction, timePickerOK)),
+			add("+1 ч", 60),
+		),
+		messenger.NewRow(
+			add("−15 м", -15), add("−5 м", -5), add("+5 м", 5), add("+15 м", 15),
+		),
+		messenger.NewRow(
+			set(9, 0), set(12, 0), set(15, 0), set(18, 0),
+		),
+		messenger.NewRow(
+			messenger.NewButton("Готово ✓", makeCallbackData(timePickerAction, timePickerOK)),
+		),
+	)
+}
+
+// durationKeyboard — быстрые варианты длительности
+func durationKeyboard() messenger.Keyboard {
+	dur := func(label, value string) messenger.Button {
+		return messenger.NewButton(label, makeCallbackData(durationAction, value))
+	}
+	return messenger.NewKeyboard(
+		messenger.NewRow(
+			dur("15 мин", "15"), dur("30 мин", "30"), dur("1 ч", "60"), dur("2 ч", "120"),
+		),
+		messenger.NewRow(
+			dur("Весь день", durationAllDay),
+		),
+	)
+}
+
+// shiftClock сдвигает время суток на mins минут, оставаясь в том же дне
+func shiftClock(t time.Time, mins int) time.Time {
+	total := (t.Hour()*60 + t.Minute() + mins) % (24 * 60)
+	if total < 0 {
+		total += 24 * 60
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), total/60, total%60, 0, 0, t.Location())
+}
+
+// defaultStart — время начала по умолчанию: ближайший следующий час для сегодняшней даты,
+// иначе 09:00
+func defaultStart(date, now time.Time) time.Time {
+	if sameDay(date, now) && now.Hour() < 23 {
+		return time.Date(now.Year(), now.Month(), now.Day(), now.Hour()+1, 0, 0, 0, now.Location())
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), 9, 0, 0, 0, date.Location())
+}
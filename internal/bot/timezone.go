@@ -0,0 +1,104 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+	"github.com/natindo/CalVigil/internal/models"
+	"github.com/natindo/CalVigil/internal/services"
+)
+
+// timezoneAction — кнопки выбора часового пояса. Формат callback_data: tz:<имя IANA>
+const timezoneAction = "tz"
+
+// timezonePresets — пояса, которые предлагаются кнопками
+var timezonePresets = []struct{ Label, Name string }{
+	{"Москва", "Europe/Moscow"},
+	{"Берлин", "Europe/Berlin"},
+	{"Алматы", "Asia/Almaty"},
+	{"UTC", "UTC"},
+}
+
+// chatLocation возвращает часовой пояс чата; при ошибке БД — пояс по умолчанию
+func chatLocation(ctx context.Context, repo services.EventRepository, chatID int64) *time.Location {
+	loc, err := repo.ChatLocation(ctx, chatID)
+	if err != nil {
+		log.Println("Ошибка ChatLocation:", err)
+	}
+	return loc
+}
+
+// chatNow — текущее время в поясе чата
+func chatNow(ctx context.Context, repo services.EventRepository, chatID int64) time.Time {
+	return time.Now().In(chatLocation(ctx, repo, chatID))
+}
+
+// stateNow — текущее время в поясе чата, для которого ведётся мастер
+func stateNow(state *models.CreationState) time.Time {
+	return time.Now().In(stateLocation(state))
+}
+
+func stateLocation(state *models.CreationState) *time.Location {
+	if state.Location != nil {
+		return state.Location
+	}
+	return services.DefaultLocation
+}
+
+// cmdTimezone показывает или меняет часовой пояс чата: /timezone [Europe/Berlin]
+func cmdTimezone(ctx context.Context, bot messenger.Messenger, repo services.Store, msg *messenger.Message) {
+	arg := strings.TrimSpace(msg.CommandArguments())
+	if arg != "" {
+		setTimezone(ctx, bot, repo, msg.ChatID, arg)
+		return
+	}
+
+	loc := chatLocation(ctx, repo, msg.ChatID)
+	text := fmt.Sprintf("Часовой пояс чата: %s (сейчас %s).\n"+
+		"Выберите другой кнопкой или укажите его названием из базы IANA: /timezone Europe/Berlin",
+		describeLocation(loc), time.Now().In(loc).Format("15:04"))
+
+	var row []messenger.Button
+	for _, p := range timezonePresets {
+		row = append(row, messenger.NewButton(p.Label, makeCallbackData(timezoneAction, p.Name)))
+	}
+	keyboard := messenger.NewKeyboard(row)
+	bot.SendMessage(msg.ChatID, text, keyboard)
+}
+
+// handleTimezoneChoice обрабатывает кнопки выбора пояса: tz:<имя IANA>
+func handleTimezoneChoice(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, cq *messenger.Callback, args []string) {
+	if len(args) != 1 {
+		bot.AnswerCallback(cq.ID, "Неизвестное действие")
+		return
+	}
+	bot.AnswerCallback(cq.ID, "")
+	setTimezone(ctx, bot, repo, chatID, args[0])
+}
+
+func setTimezone(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, name string) {
+	loc, err := services.ParseTimezone(name)
+	if err != nil {
+		bot.SendMessage(chatID, fmt.Sprintf("%v. Пример: /timezone Europe/Moscow", err), nil)
+		return
+	}
+	if err := repo.SetChatTimezone(ctx, chatID, loc); err != nil {
+		log.Println("Ошибка SetChatTimezone:", err)
+		bot.SendMessage(chatID, "Не удалось сохранить часовой пояс.", nil)
+		return
+	}
+	bot.SendMessage(chatID, fmt.Sprintf("Часовой пояс чата: %s (сейчас %s).",
+		describeLocation(loc), time.Now().In(loc).Format("15:04")), nil)
+}
+
+// describeLocation — «Europe/Berlin (UTC+01:00)»; смещение — на текущий момент
+func describeLocation(loc *time.Location) string {
+	if loc == time.Local {
+		return "пояс сервера " + time.Now().Format("UTC-07:00")
+	}
+	return fmt.Sprintf("%s (UTC%s)", loc, time.Now().In(loc).Format("-07:00"))
+}
@@ -0,0 +1,137 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/dialog"
+	"github.com/natindo/CalVigil/internal/models"
+	"github.com/natindo/CalVigil/internal/quickadd"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skip("нет базы часовых поясов:", err)
+	}
+	return loc
+}
+
+func TestCombineDateTimeUsesDateZone(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	almaty := mustLoad(t, "Asia/Almaty")
+	clock := time.Date(0, 1, 1, 9, 30, 0, 0, time.UTC)
+
+	for _, loc := range []*time.Location{berlin, almaty} {
+		date := time.Date(2025, time.March, 30, 0, 0, 0, 0, loc)
+		got := combineDateTime(date, clock)
+		if got.Location() != loc || got.Hour() != 9 || got.Minute() != 30 {
+			t.Errorf("%v: combineDateTime = %v, want 09:30 local", loc, got)
+		}
+	}
+}
+
+func TestCombineDateTimeInDSTGap(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	// 30 марта 2025 в Берлине 02:00–03:00 не существует
+	date := time.Date(2025, time.March, 30, 0, 0, 0, 0, berlin)
+	got := combineDateTime(date, time.Date(0, 1, 1, 2, 30, 0, 0, time.UTC))
+	if got.Hour() != 3 || got.Minute() != 30 {
+		t.Errorf("combineDateTime in DST gap = %v, want 03:30", got)
+	}
+}
+
+func TestAgendaPeriodAcrossDST(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	tests := []struct {
+		view   string
+		date   time.Time
+		from   time.Time
+		length time.Duration
+	}{
+		{agendaDay, time.Date(2025, time.March, 30, 15, 0, 0, 0, berlin),
+			time.Date(2025, time.March, 30, 0, 0, 0, 0, berlin), 23 * time.Hour},
+		{agendaWeek, time.Date(2025, time.October, 29, 15, 0, 0, 0, berlin),
+			time.Date(2025, time.October, 27, 0, 0, 0, 0, berlin), 7 * 24 * time.Hour},
+		{agendaWeek, time.Date(2025, time.October, 26, 15, 0, 0, 0, berlin),
+			time.Date(2025, time.October, 20, 0, 0, 0, 0, berlin), 7*24*time.Hour + time.Hour},
+		{agendaMonth, time.Date(2025, time.March, 10, 0, 0, 0, 0, berlin),
+			time.Date(2025, time.March, 1, 0, 0, 0, 0, berlin), 31*24*time.Hour - time.Hour},
+	}
+	for _, tt := range tests {
+		from, to, prev := agendaPeriod(tt.view, tt.date)
+		if !from.Equal(tt.from) {
+			t.Errorf("%s %v: from = %v, want %v", tt.view, tt.date, from, tt.from)
+		}
+		if got := to.Sub(from); got != tt.length {
+			t.Errorf("%s %v: length = %v, want %v", tt.view, tt.date, got, tt.length)
+		}
+		if prev.Hour() != 0 || !prev.Before(from) {
+			t.Errorf("%s %v: prev = %v, want previous local midnight", tt.view, tt.date, prev)
+		}
+	}
+}
+
+func TestDefaultStartInChatZone(t *testing.T) {
+	almaty := mustLoad(t, "Asia/Almaty")
+	now := time.Date(2025, time.January, 15, 6, 30, 0, 0, time.UTC).In(almaty) // 11:30 в Алматы
+	date := time.Date(2025, time.January, 15, 0, 0, 0, 0, almaty)
+	got := defaultStart(date, now)
+	if got.Hour() != 12 || got.Location() != almaty {
+		t.Errorf("defaultStart = %v, want 12:00 Almaty", got)
+	}
+}
+
+func TestAllDayAcrossDST(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	d := wizards[createDialog].dialog
+	now := time.Now()
+
+	// 30 марта 2025 в Берлине длится 23 часа, 26 октября — 25
+	for _, date := range []string{"2025-03-30", "2025-10-26", "2025-06-01"} {
+		state := &models.CreationState{Location: berlin}
+		d.Start(state, now)
+		d.HandleText(state, date, now)
+		d.HandleText(state, "10:00", now)
+		if got, _ := d.HandleButton(state, durationAction, []string{durationAllDay}, now); got != dialog.Continue {
+			t.Fatalf("%s: «Весь день»: %v", date, got)
+		}
+
+		start := state.SelectedStart
+		end := endAfter(start, state.Duration)
+		day, _ := time.ParseInLocation("2006-01-02", date, berlin)
+		if !start.Equal(day) || !end.Equal(day.AddDate(0, 0, 1)) {
+			t.Errorf("%s: %v - %v, ожидалось с полуночи до полуночи", date, start, end)
+		}
+		if got := eventDuration(start, end); got != 24*time.Hour {
+			t.Errorf("%s: длительность %v, ожидался весь день", date, got)
+		}
+		ev := models.Event{ID: 1, Title: "Отпуск", StartTime: start, EndTime: end}
+		if line := agendaLine(ev, day); !strings.HasPrefix(line, "весь день |") {
+			t.Errorf("%s: %q", date, line)
+		}
+	}
+}
+
+func TestDescribeQuickAddEnd(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	tests := []struct {
+		start    time.Time
+		duration time.Duration
+		want     string
+	}{
+		{time.Date(2025, time.June, 2, 15, 0, 0, 0, berlin), 45 * time.Minute, "2025-06-02 15:00 – 15:45"},
+		{time.Date(2025, time.June, 2, 23, 30, 0, 0, berlin), time.Hour, "2025-06-02 23:30 – 03.06 00:30"},
+		// В сутках 30 марта 23 часа: «весь день» заканчивается в полночь, а не в 01:00
+		{time.Date(2025, time.March, 30, 0, 0, 0, 0, berlin), 24 * time.Hour, "2025-03-30 00:00 – 31.03 00:00"},
+	}
+	for _, tt := range tests {
+		res := &quickadd.Result{Title: "Созвон", Start: tt.start, Duration: tt.duration}
+		card := describeQuickAdd(res, nil)
+		if !strings.Contains(card, "Когда: "+tt.want+" (") {
+			t.Errorf("%v + %v: %q, want %q", tt.start, tt.duration, card, tt.want)
+		}
+	}
+}
@@ -0,0 +1,431 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/dialog"
+	"github.com/natindo/CalVigil/internal/messenger"
+	"github.com/natindo/CalVigil/internal/models"
+	"github.com/natindo/CalVigil/internal/recurrence"
+	"github.com/natindo/CalVigil/internal/services"
+)
+
+// Шаги мастера события. Имена полей карточки редактирования совпадают с именами шагов.
+const (
+	stepDate      = "date"
+	stepTime      = "time"
+	stepDuration  = "duration"
+	stepReminders = "reminders"
+	stepRepeat    = "repeat"
+	stepTitle     = "title"
+	stepNag       = "nag"
+)
+
+// Имена диалогов (dialog.Cursor.Dialog)
+const (
+	createDialog    = "create"
+	followDialog    = "follow"      // «это и последующие»: новая серия с выбранного повторения
+	editFieldPrefix = "edit-field:" // правка одного поля из карточки: edit-field:<поле>
+)
+
+type wizardDialog = dialog.Dialog[*models.CreationState]
+
+type wizardStep = dialog.Step[*models.CreationState]
+
+// wizard — объявленный диалог и что делать при его завершении
+type wizard struct {
+	dialog *wizardDialog
+	// finish сохраняет результат, когда все шаги пройдены
+	finish func(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, state *models.CreationState)
+	// leave — «Назад» с первого шага (dialog.Left); nil, если выйти некуда
+	leave func(ctx context.Context, bot messenger.Messenger, repo services.Store, chatID int64, state *models.CreationState)
+}
+
+// wizards — все диалоги с событиями по имени. Срок ожидания ответа у них не задан:
+// его подставляет wizardFor из настроек хранилища.
+var wizards = newWizards()
+
+// wizardFor возвращает диалог name со сроком ожидания ответа repo.DialogTTL() —
+// тем же, после которого хранилище забывает брошенный диалог
+func wizardFor(repo services.StateStore, name string) (*wizard, bool) {
+	w, ok := wizards[name]
+	if !ok {
+		return nil, false
+	}
+	d := *w.dialog
+	d.Timeout = repo.DialogTTL()
+	withTTL := *w
+	withTTL.dialog = &d
+	return &withTTL, true
+}
+
+func newWizards() map[string]*wizard {
+	steps := []wizardStep{dateStep(), timeStep(), durationStep(), remindersStep(), repeatStep(), titleStep(), nagStep()}
+
+	ws := map[string]*wizard{
+		createDialog: {
+			dialog: &wizardDialog{Name: createDialog, Title: "Создание события.", Steps: steps},
+			finish: saveEvent,
+		},
+		followDialog: {
+			dialog: &wizardDialog{Name: followDialog, Title: "Обновление события.", Steps: steps},
+			finish: saveEvent,
+		},
+	}
+
+	// Правка поля — тот же шаг без «Пропустить»; «Назад» возвращает к карточке
+	for _, step := range steps {
+		if !editFields[step.Name] {
+			continue
+		}
+		step.Skippable = nil
+		name := editFieldPrefix + step.Name
+		ws[name] = &wizard{
+			dialog: &wizardDialog{
+				Name:          name,
+				Title:         "Обновление события.",
+				Steps:         []wizardStep{step},
+				BackFromStart: true,
+			},
+			finish: saveEditedField,
+			leave:  backToEditCard,
+		}
+	}
+	return ws
+}
+
+func dateStep() wizardStep {
+	return wizardStep{
+		Name: stepDate,
+		Prompt: func(*models.CreationState) string {
+			return "Выберите дату в календаре или введите её (формат YYYY-MM-DD):"
+		},
+		Keyboard: func(state *models.CreationState) messenger.Keyboard {
+			now := stateNow(state)
+			month := state.CalendarMonth
+			if month.IsZero() {
+				month = state.SelectedDate
+			}
+			if month.IsZero() {
+				month = now
+			}
+			return calendarKeyboard(month, now, state.SelectedDate)
+		},
+		Summary: func(state *models.CreationState) string {
+			return "Дата: " + state.SelectedDate.Format("2006-01-02")
+		},
+		Text: func(state *models.CreationState, text string) dialog.Result {
+			day, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(text), stateLocation(state))
+			if err != nil {
+				return dialog.Retry("Не удалось распознать дату, формат YYYY-MM-DD.")
+			}
+			setStartDate(state, day)
+			return dialog.Next()
+		},
+		Buttons: map[string]func(*models.CreationState, []string) dialog.Result{
+			calendarAction: func(state *models.CreationState, args []string) dialog.Result {
+				switch argAt(args, 0) {
+				case calendarNav:
+					month, err := time.ParseInLocation("2006-01", argAt(args, 1), stateLocation(state))
+					if err != nil {
+						return dialog.Retry("Неизвестное действие")
+					}
+					state.CalendarMonth = month
+					return dialog.Stay()
+				case calendarDay:
+					day, err := time.ParseInLocation("2006-01-02", argAt(args, 1), stateLocation(state))
+					if err != nil {
+						return dialog.Retry("Неизвестное действие")
+					}
+					setStartDate(state, day)
+					return dialog.Next().Notify("Вы выбрали " + day.Format("2006-01-02"))
+				}
+				return dialog.Ignore()
+			},
+		},
+		Skippable: func(state *models.CreationState) bool { return !state.SelectedDate.IsZero() },
+	}
+}
+
+func timeStep() wizardStep {
+	return wizardStep{
+		Name: stepTime,
+		Prompt: func(*models.CreationState) string {
+			return "Выберите время начала кнопками и нажмите «Готово» или введите его (HH:MM):"
+		},
+		Keyboard: func(state *models.CreationState) messenger.Keyboard {
+			return timePickerKeyboard(state.SelectedStart)
+		},
+		Summary: func(state *models.CreationState) string {
+			return "Начало: " + state.SelectedStart.Format("15:04")
+		},
+		Text: func(state *models.CreationState, text string) dialog.Result {
+			t, err := time.Parse("15:04", strings.TrimSpace(text))
+			if err != nil {
+				return dialog.Retry("Некорректный формат времени (HH:MM).")
+			}
+			state.SelectedStart = combineDateTime(state.SelectedDate, t)
+			return dialog.Next()
+		},
+		Buttons: map[string]func(*models.CreationState, []string) dialog.Result{
+			timePickerAction: func(state *models.CreationState, args []string) dialog.Result {
+				switch argAt(args, 0) {
+				case timePickerAdd:
+					mins, err := strconv.Atoi(argAt(args, 1))
+					if err != nil {
+						return dialog.Retry("Неизвестное действие")
+					}
+					state.SelectedStart = shiftClock(state.SelectedStart, mins)
+					return dialog.Stay()
+				case timePickerSet:
+					t, err := time.Parse("1504", argAt(args, 1))
+					if err != nil {
+						return dialog.Retry("Неизвестное действие")
+					}
+					state.SelectedStart = combineDateTime(state.SelectedDate, t)
+					return dialog.Stay()
+				case timePickerOK:
+					return dialog.Next()
+				}
+				return dialog.Retry("Неизвестное действие")
+			},
+		},
+	}
+}
+
+func durationStep() wizardStep {
+	return wizardStep{
+		Name: stepDuration,
+		Prompt: func(*models.CreationState) string {
+			return "Выберите длительность или введите её в минутах:"
+		},
+		Keyboard: func(*models.CreationState) messenger.Keyboard {
+			return durationKeyboard()
+		},
+		Summary: func(state *models.CreationState) string {
+			return "Длительность: " + describeDuration(state.Duration)
+		},
+		Text: func(state *models.CreationState, text string) dialog.Result {
+			mins, err := strconv.Atoi(strings.TrimSpace(text))
+			if err != nil || mins <= 0 {
+				return dialog.Retry("Пожалуйста, введите число — длительность в минутах.")
+			}
+			state.Duration = time.Duration(mins) * time.Minute
+			return dialog.Next()
+		},
+		Buttons: map[string]func(*models.CreationState, []string) dialog.Result{
+			durationAction: func(state *models.CreationState, args []string) dialog.Result {
+				if argAt(args, 0) == durationAllDay {
+					// Конец — следующая полночь в поясе чата (см. endAfter)
+					d := state.SelectedDate
+					state.SelectedStart = time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, stateLocation(state))
+					state.Duration = 24 * time.Hour
+					return dialog.Next()
+				}
+				mins, err := strconv.Atoi(argAt(args, 0))
+				if err != nil || mins <= 0 {
+					return dialog.Retry("Неизвестный вариант.")
+				}
+				state.Duration = time.Duration(mins) * time.Minute
+				return dialog.Next()
+			},
+		},
+		Skippable: func(state *models.CreationState) bool { return state.Duration > 0 },
+	}
+}
+
+func remindersStep() wizardStep {
+	return wizardStep{
+		Name: stepReminders,
+		Prompt: func(*models.CreationState) string {
+			return "Введите, за сколько до начала напоминать, " +
+				"можно несколько через запятую (например: 1d, 1h, 10m; «нет» — без напоминаний):"
+		},
+		Summary: func(state *models.CreationState) string {
+			return "Напоминания: " + describeReminders(state.Reminders)
+		},
+		Text: func(state *models.CreationState, text string) dialog.Result {
+			offsets, err := parseReminderOffsets(text)
+			if err != nil {
+				return dialog.Retry("Введите напоминания списком, например: 1d, 1h, 10m (или «нет»).")
+			}
+			state.Reminders = offsets
+			return dialog.Next()
+		},
+		Skip:      wholeSeriesOnly,
+		Skippable: always,
+	}
+}
+
+// repeatPresets — готовые правила повторения для inline-кнопок шага повторения
+var repeatPresets = map[string]string{
+	"daily":    "FREQ=DAILY",
+	"weekdays": "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR",
+	"weekly":   "FREQ=WEEKLY",
+	"monthly":  "FREQ=MONTHLY",
+	"yearly":   "FREQ=YEARLY",
+}
+
+func repeatStep() wizardStep {
+	return wizardStep{
+		Name: stepRepeat,
+		Prompt: func(*models.CreationState) string {
+			return "Повторять событие? Выберите вариант или введите правило " +
+				"(например, FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10), «нет» — без повторений:"
+		},
+		Keyboard: func(*models.CreationState) messenger.Keyboard {
+			return messenger.NewKeyboard(
+				messenger.NewRow(
+					messenger.NewButton("Не повторять", "repeat:none"),
+					messenger.NewButton("Каждый день", "repeat:daily"),
+				),
+				messenger.NewRow(
+					messenger.NewButton("По будням", "repeat:weekdays"),
+					messenger.NewButton("Каждую неделю", "repeat:weekly"),
+				),
+				messenger.NewRow(
+					messenger.NewButton("Каждый месяц", "repeat:monthly"),
+					messenger.NewButton("Каждый год", "repeat:yearly"),
+				),
+			)
+		},
+		Summary: func(state *models.CreationState) string {
+			return "Повтор: " + describeRecurrence(state.Recurrence)
+		},
+		Text: func(state *models.CreationState, text string) dialog.Result {
+			ruleStr := strings.TrimSpace(text)
+			if strings.EqualFold(ruleStr, "нет") || ruleStr == "-" {
+				state.Recurrence = nil
+				return dialog.Next()
+			}
+			rule, err := recurrence.Parse(ruleStr)
+			if err != nil {
+				return dialog.Retry(fmt.Sprintf("Не удалось разобрать правило: %v", err))
+			}
+			state.Recurrence = rule
+			return dialog.Next()
+		},
+		Buttons: map[string]func(*models.CreationState, []string) dialog.Result{
+			"repeat": func(state *models.CreationState, args []string) dialog.Result {
+				var rule *recurrence.Rule
+				if choice := argAt(args, 0); choice != "none" {
+					var err error
+					if rule, err = recurrence.Parse(repeatPresets[choice]); err != nil {
+						return dialog.Retry("Неизвестный вариант повторения.")
+					}
+				}
+				state.Recurrence = rule
+				return dialog.Next().Notify(describeRecurrence(rule))
+			},
+		},
+		Skip:      wholeSeriesOnly,
+		Skippable: always,
+	}
+}
+
+func titleStep() wizardStep {
+	return wizardStep{
+		Name:   stepTitle,
+		Prompt: func(*models.CreationState) string { return "Введите название события:" },
+		Summary: func(state *models.CreationState) string {
+			return "Название: " + state.Title
+		},
+		Text: func(state *models.CreationState, text string) dialog.Result {
+			title := strings.TrimSpace(text)
+			if title == "" {
+				return dialog.Retry("Название не может быть пустым.")
+			}
+			state.Title = title
+			return dialog.Next()
+		},
+		Skippable: func(state *models.CreationState) bool { return state.Title != "" },
+	}
+}
+
+func nagStep() wizardStep {
+	return wizardStep{
+		Name: stepNag,
+		Prompt: func(*models.CreationState) string {
+			return "Повторять напоминание, пока вы его не подтвердите? " +
+				"Выберите вариант или введите интервал и число повторов (например: 5m 6), «нет» — не повторять:"
+		},
+		Keyboard: func(*models.CreationState) messenger.Keyboard {
+			return messenger.NewKeyboard(
+				messenger.NewRow(
+					messenger.NewButton("Не повторять", "nag:none"),
+				),
+				messenger.NewRow(
+					messenger.NewButton("Каждые 5 мин, до 6 раз", "nag:5:6"),
+					messenger.NewButton("Каждые 15 мин, до 4 раз", "nag:15:4"),
+				),
+			)
+		},
+		Text: func(state *models.CreationState, text string) dialog.Result {
+			nag, err := parseNagPolicy(text)
+			if err != nil {
+				return dialog.Retry("Введите интервал и число повторов, например: 5m 6 (или «нет»).")
+			}
+			state.Nag = nag
+			return dialog.Next()
+		},
+		Buttons: map[string]func(*models.CreationState, []string) dialog.Result{
+			"nag": func(state *models.CreationState, args []string) dialog.Result {
+				if argAt(args, 0) == "none" {
+					state.Nag = nil
+					return dialog.Next()
+				}
+				if len(args) != 2 {
+					return dialog.Retry("Неизвестный вариант.")
+				}
+				nag, err := parseNagPolicy(args[0] + "m " + args[1])
+				if err != nil {
+					return dialog.Retry("Неизвестный вариант.")
+				}
+				state.Nag = nag
+				return dialog.Next()
+			},
+		},
+		// Режим повторов задаётся для всей серии и имеет смысл только с напоминаниями
+		Skip: func(state *models.CreationState) bool {
+			return wholeSeriesOnly(state) || len(state.Reminders) == 0
+		},
+		Skippable: always,
+	}
+}
+
+// wholeSeriesOnly — шаг задаёт значение для всей серии и не спрашивается
+// при изменении одного повторения
+func wholeSeriesOnly(state *models.CreationState) bool {
+	return state.EditScope == services.ScopeThis
+}
+
+func always(*models.CreationState) bool { return true }
+
+// setStartDate запоминает дату. Время суток берётся из уже выбранного
+// (при редактировании) или по умолчанию.
+func setStartDate(state *models.CreationState, date time.Time) {
+	state.SelectedDate = date
+	state.CalendarMonth = time.Time{}
+	if state.SelectedStart.IsZero() {
+		state.SelectedStart = defaultStart(date, time.Now().In(date.Location()))
+	}
+	state.SelectedStart = combineDateTime(date, state.SelectedStart)
+}
+
+// combineDateTime собирает момент времени из даты и времени суток в поясе даты.
+// Время, которого нет из-за перевода часов, сдвигается вперёд (02:30 → 03:30).
+func combineDateTime(date, clock time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), clock.Hour(), clock.Minute(), 0, 0, date.Location())
+}
+
+// argAt возвращает i-й аргумент callback_data или пустую строку
+func argAt(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return ""
+}
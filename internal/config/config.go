@@ -1,19 +1,381 @@
+// Package config собирает настройки бота из файла YAML или TOML, переменных окружения и флагов.
+//
+// Приоритет, от низшего к высшему: значения по умолчанию, файл конфигурации
+// (-config или CALVIGIL_CONFIG), переменные окружения, флаги командной строки.
+// Каждая настройка задаётся ключом в файле (telegram_token), переменной окружения
+// (TELEGRAM_BOT_TOKEN) и флагом с тем же именем, что и ключ, через дефис (-telegram-token).
 package config
 
 import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/jackc/pgx/v5"
+	"gopkg.in/yaml.v3"
 )
 
 // Config хранит основные настройки приложения.
 type Config struct {
-	TelegramToken string
-	DatabaseURL   string
+	TelegramToken string `yaml:"telegram_token" toml:"telegram_token"`
+	DatabaseURL   string `yaml:"database_url" toml:"database_url"`
+	// DefaultTimezone — пояс IANA для чатов, не выбравших свой через /timezone;
+	// пусто — пояс сервера
+	DefaultTimezone string `yaml:"default_timezone" toml:"default_timezone"`
+	// DefaultReminder — за сколько до начала напоминать о новом событии; 0 — не напоминать
+	DefaultReminder time.Duration `yaml:"default_reminder" toml:"default_reminder"`
+	// RequireLatestSchema — не запускаться, если в базе применены не все миграции
+	RequireLatestSchema bool `yaml:"require_latest_schema" toml:"require_latest_schema"`
+	// DBQueryTimeout ограничивает одно обращение к БД
+	DBQueryTimeout time.Duration `yaml:"db_query_timeout" toml:"db_query_timeout"`
+	// DialogTTL — через сколько забывается брошенный диалог создания события
+	DialogTTL time.Duration `yaml:"dialog_ttl" toml:"dialog_ttl"`
+	// NotifierInterval — наибольшая пауза между проверками напоминаний; ближайшее
+	// напоминание notifier ждёт точно, проверка подхватывает изменения других процессов
+	NotifierInterval time.Duration `yaml:"notifier_interval" toml:"notifier_interval"`
+	// NotifierLateWindow — сколько после начала события ещё отправляются напоминания,
+	// пропущенные, пока бот был остановлен
+	NotifierLateWindow time.Duration `yaml:"notifier_late_window" toml:"notifier_late_window"`
+	// Workers — сколько апдейтов обрабатывается одновременно
+	Workers int `yaml:"workers" toml:"workers"`
+	// ShutdownTimeout — сколько после SIGINT/SIGTERM дообрабатываются полученные апдейты;
+	// столько же затем ждут остановки notifier-а и закрытия пула БД
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+
+	// Platform — мессенджер бота: PlatformTelegram или PlatformMatrix
+	Platform string `yaml:"platform" toml:"platform"`
+	// MatrixHomeserver — адрес client-server API homeserver-а Matrix
+	MatrixHomeserver string `yaml:"matrix_homeserver" toml:"matrix_homeserver"`
+	// MatrixToken — access token пользователя-бота в Matrix
+	MatrixToken string `yaml:"matrix_token" toml:"matrix_token"`
+
+	// Mode — как бот получает апдейты из Telegram: ModePolling или ModeWebhook
+	Mode string `yaml:"mode" toml:"mode"`
+	// WebhookURL — публичный https-адрес вебхука, который регистрируется в Telegram
+	WebhookURL string `yaml:"webhook_url" toml:"webhook_url"`
+	// WebhookListen — адрес локального HTTP-сервера вебхука
+	WebhookListen string `yaml:"webhook_listen" toml:"webhook_listen"`
+	// WebhookSecret — secret_token, который Telegram присылает с каждым апдейтом;
+	// обязателен в режиме вебхука
+	WebhookSecret string `yaml:"webhook_secret" toml:"webhook_secret"`
+	// WebhookTLSCert и WebhookTLSKey — TLS на самом боте; пусто — HTTP за reverse proxy
+	WebhookTLSCert string `yaml:"webhook_tls_cert" toml:"webhook_tls_cert"`
+	WebhookTLSKey  string `yaml:"webhook_tls_key" toml:"webhook_tls_key"`
+
+	// Args — аргументы после флагов: подкоманда (migrate ..., console ...) или пусто для запуска бота
+	Args []string `yaml:"-" toml:"-"`
+}
+
+// Платформы
+const (
+	PlatformTelegram = "telegram"
+	PlatformMatrix   = "matrix"
+)
+
+// Режимы получения апдейтов
+const (
+	ModePolling = "polling"
+	ModeWebhook = "webhook"
+)
+
+// secretTokenRe — допустимый secret_token по документации Bot API
+var secretTokenRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// Default — настройки по умолчанию
+func Default() *Config {
+	return &Config{
+		DefaultReminder:    5 * time.Minute,
+		DBQueryTimeout:     5 * time.Second,
+		DialogTTL:          24 * time.Hour,
+		NotifierInterval:   5 * time.Minute,
+		NotifierLateWindow: 15 * time.Minute,
+		Workers:            8,
+		ShutdownTimeout:    30 * time.Second,
+		Platform:           PlatformTelegram,
+		Mode:               ModePolling,
+		WebhookListen:      ":8080",
+	}
+}
+
+// setting — одна настройка: ключ в файле (он же имя флага через дефис),
+// переменная окружения и поле Config
+type setting struct {
+	key   string
+	env   string
+	usage string
+	ptr   any // *string, *bool, *int или *time.Duration
+}
+
+func (cfg *Config) settings() []setting {
+	return []setting{
+		{"telegram_token", "TELEGRAM_BOT_TOKEN", "токен бота от @BotFather", &cfg.TelegramToken},
+		{"database_url", "DATABASE_URL", "строка подключения к PostgreSQL", &cfg.DatabaseURL},
+		{"default_timezone", "DEFAULT_TIMEZONE", "пояс IANA по умолчанию, например Europe/Moscow", &cfg.DefaultTimezone},
+		{"default_reminder", "DEFAULT_REMINDER", "напоминание о новом событии по умолчанию, 0 — без него", &cfg.DefaultReminder},
+		{"require_latest_schema", "DB_REQUIRE_LATEST_SCHEMA", "не запускаться со схемой БД не последней версии", &cfg.RequireLatestSchema},
+		{"db_query_timeout", "DB_QUERY_TIMEOUT", "предельная длительность запроса к БД", &cfg.DBQueryTimeout},
+		{"dialog_ttl", "DIALOG_TTL", "через сколько забывается брошенный диалог", &cfg.DialogTTL},
+		{"notifier_interval", "NOTIFIER_INTERVAL", "наибольшая пауза между проверками напоминаний", &cfg.NotifierInterval},
+		{"notifier_late_window", "NOTIFIER_LATE_WINDOW", "сколько после начала события отправлять пропущенные напоминания", &cfg.NotifierLateWindow},
+		{"workers", "BOT_WORKERS", "число одновременно обрабатываемых апдейтов", &cfg.Workers},
+		{"shutdown_timeout", "SHUTDOWN_TIMEOUT", "срок на дообработку апдейтов при остановке", &cfg.ShutdownTimeout},
+		{"platform", "BOT_PLATFORM", "мессенджер: telegram или matrix", &cfg.Platform},
+		{"matrix_homeserver", "MATRIX_HOMESERVER", "адрес homeserver-а Matrix", &cfg.MatrixHomeserver},
+		{"matrix_token", "MATRIX_ACCESS_TOKEN", "access token бота в Matrix", &cfg.MatrixToken},
+		{"mode", "BOT_MODE", "получение апдейтов из Telegram: polling или webhook", &cfg.Mode},
+		{"webhook_url", "WEBHOOK_URL", "публичный https-адрес вебхука", &cfg.WebhookURL},
+		{"webhook_listen", "WEBHOOK_LISTEN", "адрес HTTP-сервера вебхука", &cfg.WebhookListen},
+		{"webhook_secret", "WEBHOOK_SECRET", "secret_token вебхука", &cfg.WebhookSecret},
+		{"webhook_tls_cert", "WEBHOOK_TLS_CERT", "сертификат TLS сервера вебхука", &cfg.WebhookTLSCert},
+		{"webhook_tls_key", "WEBHOOK_TLS_KEY", "ключ TLS сервера вебхука", &cfg.WebhookTLSKey},
+	}
+}
+
+// ValidationError перечисляет все ошибочные и недостающие настройки
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "некорректная конфигурация:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Load собирает конфигурацию из значений по умолчанию, файла, окружения и флагов args
+// (обычно os.Args[1:]) и проверяет её. Все проблемы возвращаются одной ошибкой
+// *ValidationError. На -h возвращает flag.ErrHelp, напечатав справку в output.
+func Load(args []string, output io.Writer) (*Config, error) {
+	cfg := Default()
+	settings := cfg.settings()
+
+	// Флаги разбираются первыми, чтобы узнать -config, а применяются последними
+	fs := flag.NewFlagSet("CalVigil", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprintln(output, "Использование: CalVigil [флаги] [migrate ... | console [chat-id]]")
+		fmt.Fprintln(output, "Приоритет настроек: флаги > переменные окружения > файл -config > значения по умолчанию.")
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", os.Getenv("CALVIGIL_CONFIG"), "файл конфигурации YAML или TOML (CALVIGIL_CONFIG)")
+	flagValues := map[string]string{}
+	for _, s := range settings {
+		fs.Var(&rawFlag{values: flagValues, key: s.key, isBool: isBool(s.ptr)},
+			flagName(s.key), fmt.Sprintf("%s (%s)", s.usage, s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg.Args = fs.Args()
+
+	var problems []string
+	if *configPath != "" {
+		if err := cfg.loadFile(*configPath); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok && v != "" {
+			if err := setValue(s.ptr, v); err != nil {
+				problems = append(problems, fmt.Sprintf("%s (%s): %v", s.key, s.env, err))
+			}
+		}
+	}
+	for _, s := range settings {
+		if v, ok := flagValues[s.key]; ok {
+			if err := setValue(s.ptr, v); err != nil {
+				problems = append(problems, fmt.Sprintf("%s (-%s): %v", s.key, flagName(s.key), err))
+			}
+		}
+	}
+
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return cfg, nil
 }
 
-func LoadConfig() *Config {
-	cfg := &Config{
-		TelegramToken: os.Getenv("TELEGRAM_BOT_TOKEN"),
-		DatabaseURL:   os.Getenv("DATABASE_URL"),
+// loadFile читает настройки из YAML, а если у файла расширение .toml — из TOML.
+// Незнакомый ключ — ошибка: скорее всего, это опечатка.
+func (cfg *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("файл конфигурации: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		md, err := toml.NewDecoder(bytes.NewReader(data)).Decode(cfg)
+		if err != nil {
+			return fmt.Errorf("файл конфигурации %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, key := range undecoded {
+				keys[i] = key.String()
+			}
+			return fmt.Errorf("файл конфигурации %s: неизвестные ключи %s", path, strings.Join(keys, ", "))
+		}
+		return nil
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("файл конфигурации %s: %w", path, err)
 	}
-	return cfg
+	return nil
 }
+
+// validate возвращает все найденные проблемы
+func (cfg *Config) validate() []string {
+	var problems []string
+	add := func(key, format string, args ...any) {
+		problems = append(problems, key+": "+fmt.Sprintf(format, args...))
+	}
+	bot := len(cfg.Args) == 0
+	if len(cfg.Args) > 0 && cfg.Args[0] != "migrate" && cfg.Args[0] != "console" {
+		problems = append(problems, fmt.Sprintf("неизвестная команда %q, есть migrate и console", cfg.Args[0]))
+	}
+
+	switch cfg.Platform {
+	case PlatformTelegram:
+		switch {
+		case bot && cfg.TelegramToken == "":
+			add("telegram_token", "не задан (TELEGRAM_BOT_TOKEN, -telegram-token или telegram_token в файле)")
+		case bot && !strings.Contains(cfg.TelegramToken, ":"):
+			add("telegram_token", "не похож на токен от @BotFather (ожидается <id>:<секрет>)")
+		}
+	case PlatformMatrix:
+		if !bot {
+			break
+		}
+		if u, err := url.Parse(cfg.MatrixHomeserver); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			add("matrix_homeserver", "нужен адрес вида https://matrix.example.org, задано %q", cfg.MatrixHomeserver)
+		}
+		if cfg.MatrixToken == "" {
+			add("matrix_token", "не задан (MATRIX_ACCESS_TOKEN, -matrix-token или matrix_token в файле)")
+		}
+	default:
+		add("platform", "ожидается %q или %q, задано %q", PlatformTelegram, PlatformMatrix, cfg.Platform)
+	}
+
+	if cfg.DatabaseURL == "" {
+		add("database_url", "не задан (DATABASE_URL, -database-url или database_url в файле)")
+	} else if _, err := pgx.ParseConfig(cfg.DatabaseURL); err != nil {
+		add("database_url", "не разбирается: %v", err)
+	}
+	if cfg.DefaultTimezone != "" {
+		if _, err := time.LoadLocation(cfg.DefaultTimezone); err != nil {
+			add("default_timezone", "неизвестный часовой пояс %q", cfg.DefaultTimezone)
+		}
+	}
+	if cfg.DefaultReminder < 0 {
+		add("default_reminder", "не может быть отрицательным")
+	}
+	for _, d := range []struct {
+		key   string
+		value time.Duration
+		min   time.Duration
+	}{
+		{"db_query_timeout", cfg.DBQueryTimeout, time.Millisecond},
+		{"dialog_ttl", cfg.DialogTTL, time.Minute},
+		{"notifier_interval", cfg.NotifierInterval, time.Second},
+		{"notifier_late_window", cfg.NotifierLateWindow, time.Minute},
+		{"shutdown_timeout", cfg.ShutdownTimeout, time.Second},
+	} {
+		if d.value < d.min {
+			add(d.key, "должно быть не меньше %s, задано %s", d.min, d.value)
+		}
+	}
+	if cfg.Workers < 1 {
+		add("workers", "должно быть положительным, задано %d", cfg.Workers)
+	}
+
+	switch cfg.Mode {
+	case ModePolling:
+	case ModeWebhook:
+		if cfg.Platform != PlatformTelegram {
+			add("mode", "вебхук есть только у Telegram, для %s нужен polling", cfg.Platform)
+		}
+		if u, err := url.Parse(cfg.WebhookURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			add("webhook_url", "нужен публичный https-адрес, задано %q", cfg.WebhookURL)
+		}
+		if _, _, err := net.SplitHostPort(cfg.WebhookListen); err != nil {
+			add("webhook_listen", "нужен адрес вида host:port или :port, задано %q", cfg.WebhookListen)
+		}
+		// Без секрета апдейты от имени любого чата мог бы прислать кто угодно, кто знает адрес
+		if cfg.WebhookSecret == "" {
+			add("webhook_secret", "обязателен в режиме webhook")
+		} else if !secretTokenRe.MatchString(cfg.WebhookSecret) {
+			add("webhook_secret", "допустимы 1–256 символов A-Z, a-z, 0-9, _ и -")
+		}
+		if (cfg.WebhookTLSCert == "") != (cfg.WebhookTLSKey == "") {
+			add("webhook_tls_cert", "webhook_tls_cert и webhook_tls_key задаются вместе")
+		}
+	default:
+		add("mode", "ожидается %q или %q, задано %q", ModePolling, ModeWebhook, cfg.Mode)
+	}
+	return problems
+}
+
+// setValue разбирает строку из окружения или флага в поле настройки
+func setValue(ptr any, v string) error {
+	switch p := ptr.(type) {
+	case *string:
+		*p = v
+	case *bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("ожидается true или false, получено %q", v)
+		}
+		*p = b
+	case *int:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("ожидается целое число, получено %q", v)
+		}
+		*p = n
+	case *time.Duration:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("ожидается длительность вроде 30s или 5m, получено %q", v)
+		}
+		*p = d
+	default:
+		return fmt.Errorf("неподдерживаемый тип %T", ptr)
+	}
+	return nil
+}
+
+func isBool(ptr any) bool {
+	_, ok := ptr.(*bool)
+	return ok
+}
+
+func flagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// rawFlag запоминает строку флага; разбирается она после файла и окружения
+type rawFlag struct {
+	values map[string]string
+	key    string
+	isBool bool
+}
+
+func (f *rawFlag) String() string { return "" }
+
+func (f *rawFlag) Set(v string) error {
+	f.values[f.key] = v
+	return nil
+}
+
+func (f *rawFlag) IsBoolFlag() bool { return f.isBool }
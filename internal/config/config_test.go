@@ -0,0 +1,210 @@
+package config
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv убирает переменные настроек, чтобы окружение машины не влияло на тест
+func clearEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("CALVIGIL_CONFIG", "")
+	for _, s := range Default().settings() {
+		t.Setenv(s.env, "")
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	return writeConfigAs(t, "config.yaml", content)
+}
+
+// writeConfigAs записывает файл конфигурации с именем name: формат определяется расширением
+func writeConfigAs(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, `
+telegram_token: "1:file"
+database_url: postgres://localhost/calvigil
+notifier_interval: 30s
+workers: 2
+default_timezone: Europe/Berlin
+`)
+	t.Setenv("BOT_WORKERS", "4")
+	t.Setenv("DEFAULT_TIMEZONE", "Asia/Tokyo")
+
+	cfg, err := Load([]string{"-config", path, "-workers", "16", "-require-latest-schema"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TelegramToken != "1:file" || cfg.NotifierInterval != 30*time.Second {
+		t.Errorf("значения из файла не применены: %+v", cfg)
+	}
+	if cfg.DefaultTimezone != "Asia/Tokyo" {
+		t.Errorf("окружение не перекрыло файл: %q", cfg.DefaultTimezone)
+	}
+	if cfg.Workers != 16 || !cfg.RequireLatestSchema {
+		t.Errorf("флаги не перекрыли окружение: workers=%d, require=%v", cfg.Workers, cfg.RequireLatestSchema)
+	}
+	if cfg.DialogTTL != 24*time.Hour || cfg.Mode != ModePolling {
+		t.Errorf("значения по умолчанию потеряны: %+v", cfg)
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	clearEnv(t)
+	path := writeConfigAs(t, "config.toml", `
+telegram_token = "1:file"
+database_url = "postgres://localhost/calvigil"
+notifier_interval = "30s"
+workers = 2
+require_latest_schema = true
+`)
+	cfg, err := Load([]string{"-config", path, "-workers", "16"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TelegramToken != "1:file" || cfg.NotifierInterval != 30*time.Second || !cfg.RequireLatestSchema {
+		t.Errorf("значения из файла не применены: %+v", cfg)
+	}
+	if cfg.Workers != 16 {
+		t.Errorf("флаг не перекрыл файл: workers=%d", cfg.Workers)
+	}
+
+	// Как и в YAML, опечатка в ключе — ошибка
+	path = writeConfigAs(t, "config.toml", "notifer_interval = \"10s\"\n")
+	if _, err := Load([]string{"-config", path}, io.Discard); err == nil || !strings.Contains(err.Error(), "notifer_interval") {
+		t.Errorf("незнакомый ключ: %v", err)
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("CALVIGIL_CONFIG", writeConfig(t, "database_url: postgres://localhost/db\n"))
+	t.Setenv("TELEGRAM_BOT_TOKEN", "1:env")
+
+	cfg, err := Load(nil, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DatabaseURL != "postgres://localhost/db" || cfg.TelegramToken != "1:env" {
+		t.Errorf("конфигурация: %+v", cfg)
+	}
+}
+
+func TestLoadReportsAllProblems(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("NOTIFIER_INTERVAL", "soon")
+	t.Setenv("DEFAULT_TIMEZONE", "Mars/Olympus")
+
+	_, err := Load([]string{"-workers", "0", "-mode", "webhook", "-webhook-secret", "пароль"}, io.Discard)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("ожидалась ValidationError, получено %v", err)
+	}
+	for _, key := range []string{"telegram_token", "database_url", "notifier_interval", "default_timezone",
+		"workers", "webhook_url", "webhook_secret"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("в ошибке нет %s:\n%v", key, err)
+		}
+	}
+
+	// Вебхук без секрета не запускается
+	_, err = Load([]string{"-telegram-token", "1:flag", "-database-url", "postgres://localhost/db",
+		"-mode", "webhook", "-webhook-url", "https://bot.example.com/hook"}, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "webhook_secret") {
+		t.Errorf("вебхук без webhook_secret: %v", err)
+	}
+}
+
+func TestLoadCommandsNeedNoToken(t *testing.T) {
+	clearEnv(t)
+	for _, args := range [][]string{{"migrate", "down", "2"}, {"console", "42"}} {
+		cfg, err := Load(append([]string{"-database-url", "postgres://localhost/db"}, args...), io.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(cfg.Args, " ") != strings.Join(args, " ") {
+			t.Errorf("Args = %v", cfg.Args)
+		}
+	}
+
+	if _, err := Load([]string{"-database-url", "postgres://localhost/db", "serve"}, io.Discard); err == nil ||
+		!strings.Contains(err.Error(), "неизвестная команда") {
+		t.Errorf("неизвестная команда: %v", err)
+	}
+}
+
+func TestLoadMatrix(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+	t.Setenv("BOT_PLATFORM", "matrix")
+
+	// Токен Telegram для Matrix не нужен, зато нужны homeserver и его токен
+	_, err := Load([]string{"-matrix-homeserver", "matrix.example.org", "-mode", "webhook",
+		"-webhook-url", "https://bot.example.com/hook"}, io.Discard)
+	for _, key := range []string{"matrix_homeserver", "matrix_token", "mode"} {
+		if err == nil || !strings.Contains(err.Error(), key) {
+			t.Errorf("в ошибке нет %s:\n%v", key, err)
+		}
+	}
+	if err != nil && strings.Contains(err.Error(), "telegram_token") {
+		t.Errorf("для Matrix потребовался токен Telegram:\n%v", err)
+	}
+
+	t.Setenv("MATRIX_ACCESS_TOKEN", "syt_secret")
+	cfg, err := Load([]string{"-matrix-homeserver", "https://matrix.example.org"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Platform != PlatformMatrix || cfg.MatrixToken != "syt_secret" {
+		t.Errorf("конфигурация: %+v", cfg)
+	}
+
+	if _, err := Load([]string{"-platform", "icq"}, io.Discard); err == nil || !strings.Contains(err.Error(), "platform") {
+		t.Errorf("неизвестная платформа: %v", err)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("TELEGRAM_BOT_TOKEN", "1:x")
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+
+	// Опечатка в ключе не должна молча игнорироваться
+	path := writeConfig(t, "notifer_interval: 10s\n")
+	if _, err := Load([]string{"-config", path}, io.Discard); err == nil || !strings.Contains(err.Error(), "notifer_interval") {
+		t.Errorf("незнакомый ключ: %v", err)
+	}
+	if _, err := Load([]string{"-config", filepath.Join(t.TempDir(), "нет.yaml")}, io.Discard); err == nil {
+		t.Error("отсутствующий файл не обнаружен")
+	}
+	// Пустой файл допустим
+	if _, err := Load([]string{"-config", writeConfig(t, "")}, io.Discard); err != nil {
+		t.Errorf("пустой файл: %v", err)
+	}
+}
+
+func TestExampleConfig(t *testing.T) {
+	clearEnv(t)
+	cfg, err := Load([]string{"-config", "../../config.example.yaml"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DefaultTimezone != "Europe/Moscow" || cfg.Workers != 8 {
+		t.Errorf("пример конфигурации: %+v", cfg)
+	}
+}
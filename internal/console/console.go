@@ -0,0 +1,183 @@
+// Package console — транспорт для запуска бота в терминале, без Telegram и токена.
+// Строки ввода становятся сообщениями пользователя, ответы бота печатаются,
+// inline-кнопки нумеруются, а «#N» нажимает кнопку N.
+package console
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+)
+
+// DefaultChatID — чат, от имени которого пишет пользователь консоли, если не задан другой
+const DefaultChatID int64 = 1
+
+// Usage — подсказка, которая печатается при запуске
+const Usage = "Пишите сообщения и команды как в Telegram (/help — список команд).\n" +
+	"Кнопки пронумерованы: #N нажимает кнопку [N]. Ctrl+D — выход."
+
+// message — напечатанное сообщение бота в текущем виде
+type message struct {
+	chatID   int64
+	text     string
+	keyboard messenger.Keyboard
+}
+
+// Console — Messenger, печатающий сообщения в out, и источник апдейтов из in.
+// Все кнопки сессии нумеруются подряд, поэтому нажать можно и кнопку под старым
+// сообщением, например под напоминанием, пришедшим посреди диалога.
+type Console struct {
+	in     io.Reader
+	out    io.Writer
+	chatID int64
+
+	mu       sync.Mutex
+	lastID   int
+	messages map[int]*message
+	buttons  messenger.ButtonNumbers
+}
+
+var _ messenger.Messenger = (*Console)(nil)
+
+// New создаёт консоль для чата chatID
+func New(in io.Reader, out io.Writer, chatID int64) *Console {
+	return &Console{
+		in:       in,
+		out:      out,
+		chatID:   chatID,
+		messages: map[int]*message{},
+	}
+}
+
+// SendMessage печатает сообщение; сообщения другим чатам помечаются номером чата
+func (c *Console) SendMessage(chatID int64, text string, keyboard messenger.Keyboard) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastID++
+	m := &message{chatID: chatID, text: text, keyboard: keyboard}
+	c.messages[c.lastID] = m
+	c.print(c.lastID, m, "")
+	return c.lastID, nil
+}
+
+// EditMessage печатает сообщение заново с пометкой «изменено»
+func (c *Console) EditMessage(chatID int64, messageID int, text string, keyboard messenger.Keyboard) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, ok := c.messages[messageID]
+	if !ok || m.chatID != chatID {
+		return fmt.Errorf("сообщение %d не найдено", messageID)
+	}
+	if m.text == text && messenger.SameKeyboard(m.keyboard, keyboard) {
+		return nil
+	}
+	m.text, m.keyboard = text, keyboard
+	c.print(messageID, m, "изменено")
+	return nil
+}
+
+// AnswerCallback печатает всплывающую подсказку, если она есть
+func (c *Console) AnswerCallback(_ string, text string) error {
+	if text == "" {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(c.out, "(%s)\n", text)
+	return nil
+}
+
+// SetCommands ничего не делает: меню команд в терминале нет
+func (c *Console) SetCommands([]messenger.Command) error {
+	return nil
+}
+
+// print выводит сообщение и нумерует его кнопки; вызывается под c.mu
+func (c *Console) print(id int, m *message, note string) {
+	header := fmt.Sprintf("── сообщение %d", id)
+	if m.chatID != c.chatID {
+		header += fmt.Sprintf(", чат %d", m.chatID)
+	}
+	if note != "" {
+		header += ", " + note
+	}
+	var b strings.Builder
+	b.WriteString(header + " ──\n" + m.text + "\n")
+	for _, line := range c.buttons.Assign(id, m.keyboard) {
+		b.WriteString("  " + line + "\n")
+	}
+	io.WriteString(c.out, b.String())
+}
+
+// Receive читает строки из in и передаёт их в dispatch, пока не отменён ctx
+// или не кончился ввод. Подходит как bot.Receiver.
+func (c *Console) Receive(ctx context.Context, dispatch func(messenger.Update) bool) error {
+	lines := make(chan string)
+	errc := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(c.in)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+		errc <- scanner.Err()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errc:
+			return err
+		case line := <-lines:
+			update, ok := c.parse(strings.TrimSpace(line))
+			if !ok {
+				continue
+			}
+			if !dispatch(update) {
+				return nil
+			}
+		}
+	}
+}
+
+// parse превращает строку ввода в апдейт: «#N» — нажатие кнопки, остальное — сообщение
+func (c *Console) parse(line string) (messenger.Update, bool) {
+	if line == "" {
+		return messenger.Update{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	messageID, data, isPress, ok := c.buttons.Press(line)
+	if isPress && !ok {
+		fmt.Fprintf(c.out, "(нет кнопки %s)\n", line)
+		return messenger.Update{}, false
+	}
+	c.lastID++
+	if isPress {
+		m := c.messages[messageID]
+		return messenger.Update{Callback: &messenger.Callback{
+			ID:          strconv.Itoa(c.lastID),
+			ChatID:      m.chatID,
+			MessageID:   messageID,
+			MessageText: m.text,
+			Data:        data,
+		}}, true
+	}
+	return messenger.Update{Message: &messenger.Message{
+		ID:      c.lastID,
+		ChatID:  c.chatID,
+		Text:    line,
+		Private: true,
+	}}, true
+}
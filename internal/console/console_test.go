@@ -0,0 +1,88 @@
+package console
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+)
+
+func TestConsoleMessages(t *testing.T) {
+	var out strings.Builder
+	c := New(strings.NewReader(""), &out, 7)
+
+	keyboard := messenger.NewKeyboard(
+		messenger.NewRow(
+			messenger.NewButton("Назад", "wz:back"),
+			messenger.NewButton("Отмена", "wz:cancel"),
+		),
+	)
+	id, _ := c.SendMessage(7, "Выберите дату", keyboard)
+	c.SendMessage(42, "Чужое напоминание", nil)
+	if err := c.EditMessage(7, id, "Выберите время", keyboard); err != nil {
+		t.Fatal(err)
+	}
+	// Правка без изменений не печатается
+	c.EditMessage(7, id, "Выберите время", keyboard)
+	if err := c.EditMessage(7, 100, "x", nil); err == nil {
+		t.Error("правка несуществующего сообщения прошла без ошибки")
+	}
+	c.AnswerCallback("1", "Вы выбрали 2025-01-15")
+
+	want := "── сообщение 1 ──\nВыберите дату\n  [1] Назад  [2] Отмена\n" +
+		"── сообщение 2, чат 42 ──\nЧужое напоминание\n" +
+		"── сообщение 1, изменено ──\nВыберите время\n  [3] Назад  [4] Отмена\n" +
+		"(Вы выбрали 2025-01-15)\n"
+	if out.String() != want {
+		t.Errorf("вывод:\n%s\nожидался:\n%s", out.String(), want)
+	}
+}
+
+func TestConsoleReceive(t *testing.T) {
+	var out strings.Builder
+	c := New(strings.NewReader("/add завтра созвон\n\n#1\n#3\n30\n"), &out, 7)
+	keyboard := messenger.NewKeyboard(messenger.NewRow(
+		messenger.NewButton("Понятно", "ack:5:1700000000"),
+	))
+	c.SendMessage(7, "Напоминание!", keyboard)
+
+	var got []messenger.Update
+	err := c.Receive(context.Background(), func(u messenger.Update) bool {
+		got = append(got, u)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("апдейтов %d, ожидалось 3", len(got))
+	}
+	if msg := got[0].Message; !msg.IsCommand() || msg.Command() != "add" || msg.CommandArguments() != "завтра созвон" ||
+		msg.ChatID != 7 {
+		t.Errorf("команда: %+v", msg)
+	}
+	if cq := got[1].Callback; cq == nil || cq.Data != "ack:5:1700000000" || cq.MessageID != 1 ||
+		cq.MessageText != "Напоминание!" {
+		t.Errorf("кнопка: %+v", cq)
+	}
+	// Число без «#» — обычный текст, например длительность в минутах
+	if msg := got[2].Message; msg == nil || msg.IsCommand() || msg.Text != "30" {
+		t.Errorf("текст: %+v", msg)
+	}
+	if !strings.Contains(out.String(), "(нет кнопки #3)") {
+		t.Errorf("несуществующая кнопка не отмечена:\n%s", out.String())
+	}
+}
+
+func TestConsoleReceiveStops(t *testing.T) {
+	c := New(strings.NewReader("раз\nдва\n"), &strings.Builder{}, 7)
+	calls := 0
+	c.Receive(context.Background(), func(messenger.Update) bool {
+		calls++
+		return false
+	})
+	if calls != 1 {
+		t.Errorf("после отказа dispatch принято ещё %d апдейтов", calls-1)
+	}
+}
@@ -3,28 +3,71 @@ package database
 import (
 	"context"
 	"fmt"
+	"time"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// ConnectPostgres открывает соединение с PostgreSQL по заданной строке подключения.
-// Возвращает *pgx.Conn, которое надо закрывать.
-func ConnectPostgres(connStr string) (*pgx.Conn, error) {
-    cfg, err := pgx.ParseConfig(connStr)
-    if err != nil {
-        return nil, fmt.Errorf("parse config error: %w", err)
-    }
-
-    conn, err := pgx.ConnectConfig(context.Background(), cfg)
-    if err != nil {
-        return nil, fmt.Errorf("pgx connect error: %w", err)
-    }
-
-    // Проверка связи
-    if err := conn.Ping(context.Background()); err != nil {
-        conn.Close(context.Background())
-        return nil, fmt.Errorf("pgx ping error: %w", err)
-    }
-
-    return conn, nil
-}
\ No newline at end of file
+// Option — дополнительная настройка ConnectPostgres
+type Option func(*options)
+
+type options struct {
+	requireSchema bool
+	maxConns      int32
+}
+
+// RequireLatestSchema запрещает подключение к базе, в которой применены не все
+// встроенные миграции: ConnectPostgres вернёт ошибку, обёрнутую вокруг ErrSchemaOutdated.
+func RequireLatestSchema() Option {
+	return func(o *options) { o.requireSchema = true }
+}
+
+// MaxConns ограничивает число соединений в пуле (по умолчанию — как в pgxpool)
+func MaxConns(n int32) Option {
+	return func(o *options) { o.maxConns = n }
+}
+
+// connectTimeout — сколько ждать первого соединения при старте
+const connectTimeout = 10 * time.Second
+
+// ConnectPostgres открывает пул соединений с PostgreSQL по заданной строке подключения.
+// Пул безопасен для одновременного использования из разных горутин; его надо закрывать.
+func ConnectPostgres(ctx context.Context, connStr string, opts ...Option) (*pgxpool.Pool, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	cfg, err := pgxpool.ParseConfig(connStr)
+	if err != nil {
+		return nil, fmt.Errorf("parse config error: %w", err)
+	}
+	// Время хранится и сравнивается в UTC; в пояс чата оно переводится уже в приложении
+	cfg.ConnConfig.RuntimeParams["timezone"] = "UTC"
+	if o.maxConns > 0 {
+		cfg.MaxConns = o.maxConns
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("pgx connect error: %w", err)
+	}
+
+	// Проверка связи
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("pgx ping error: %w", err)
+	}
+
+	if o.requireSchema {
+		if err := CheckSchema(ctx, pool); err != nil {
+			pool.Close()
+			return nil, err
+		}
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,103 @@
+// Package dbtest выдаёт тестам базу PostgreSQL без Docker: адрес берётся из
+// CALVIGIL_TEST_DATABASE_URL, а если он не задан — запускается встроенный PostgreSQL
+// (embedded-postgres), один на тестовый бинарник. Бинарники PostgreSQL скачиваются
+// при первом запуске и кешируются в ~/.embedded-postgres-go; если это не удалось
+// (например, нет сети), тесты с базой пропускаются.
+//
+// Пакет, который пользуется URL, должен остановить встроенный сервер в TestMain:
+//
+//	func TestMain(m *testing.M) { dbtest.Main(m) }
+package dbtest
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+)
+
+// EnvURL — переменная окружения с адресом готовой тестовой базы
+const EnvURL = "CALVIGIL_TEST_DATABASE_URL"
+
+var (
+	once       sync.Once
+	embedded   *embeddedpostgres.EmbeddedPostgres
+	runtimeDir string
+	url        string
+	startErr   error
+)
+
+// URL возвращает адрес тестовой базы или пропускает тест, если базы нет.
+// Встроенная база общая для всех тестов пакета: тесты не должны рассчитывать на пустые
+// таблицы и разделяют данные, например, уникальными chat_id.
+func URL(t testing.TB) string {
+	t.Helper()
+	if u := os.Getenv(EnvURL); u != "" {
+		return u
+	}
+	once.Do(start)
+	if startErr != nil {
+		t.Skipf("%s не задан, встроенный PostgreSQL не запустился: %v", EnvURL, startErr)
+	}
+	return url
+}
+
+// Main выполняет тесты пакета и останавливает встроенный PostgreSQL, если он запускался
+func Main(m *testing.M) {
+	code := m.Run()
+	if embedded != nil {
+		if err := embedded.Stop(); err != nil {
+			fmt.Fprintln(os.Stderr, "dbtest: остановка PostgreSQL:", err)
+		}
+		os.RemoveAll(runtimeDir)
+	}
+	os.Exit(code)
+}
+
+func start() {
+	port, err := freePort()
+	if err != nil {
+		startErr = err
+		return
+	}
+	// Каталоги свои у каждого бинарника: пакеты тестируются параллельно
+	runtimeDir, err = os.MkdirTemp("", "calvigil-pg-")
+	if err != nil {
+		startErr = err
+		return
+	}
+
+	var logs bytes.Buffer
+	cfg := embeddedpostgres.DefaultConfig().
+		Port(port).
+		Database("calvigil").
+		RuntimePath(runtimeDir).
+		StartTimeout(time.Minute).
+		Logger(&logs)
+	db := embeddedpostgres.NewDatabase(cfg)
+	if err := db.Start(); err != nil {
+		os.RemoveAll(runtimeDir)
+		startErr = err
+		if logs.Len() > 0 {
+			startErr = fmt.Errorf("%w\n%s", err, logs.String())
+		}
+		return
+	}
+	embedded = db
+	url = cfg.GetConnectionURL() + "?sslmode=disable"
+}
+
+// freePort находит свободный локальный порт для сервера
+func freePort() (uint32, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return uint32(l.Addr().(*net.TCPAddr).Port), nil
+}
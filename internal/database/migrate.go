@@ -0,0 +1,278 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey — ключ advisory-блокировки, чтобы две копии бота не применяли миграции одновременно
+const migrationLockKey = 7_224_561_001
+
+// ErrSchemaOutdated возвращается, если в базе применены не все миграции
+var ErrSchemaOutdated = errors.New("схема БД устарела, выполните миграции: CalVigil migrate up")
+
+// Migration — одна версия схемы: SQL для применения и отката
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+var migrationNameRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migrations возвращает встроенные в бинарник миграции по возрастанию версии.
+// Файлы называются <версия>_<название>.up.sql и <версия>_<название>.down.sql.
+func Migrations() ([]Migration, error) {
+	return loadMigrations(migrationFiles, "migrations")
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		m := migrationNameRe.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("миграция %s: имя не соответствует формату <версия>_<название>.<up|down>.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := fs.ReadFile(fsys, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("миграция %d: разные названия %q и %q", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	result := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("миграция %d_%s: нужны оба файла, up и down", mig.Version, mig.Name)
+		}
+		result = append(result, *mig)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+// LatestVersion — версия последней встроенной миграции
+func LatestVersion() (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// SchemaVersion возвращает версию схемы в базе (0 — миграции не применялись)
+func SchemaVersion(ctx context.Context, conn *pgxpool.Pool) (int, error) {
+	var exists bool
+	err := conn.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	if err != nil || !exists {
+		return 0, err
+	}
+	var version int
+	err = conn.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// CheckSchema возвращает ErrSchemaOutdated, если в базе применены не все встроенные миграции
+func CheckSchema(ctx context.Context, conn *pgxpool.Pool) error {
+	current, err := SchemaVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+	latest, err := LatestVersion()
+	if err != nil {
+		return err
+	}
+	if current < latest {
+		return fmt.Errorf("%w (версия %d, нужна %d)", ErrSchemaOutdated, current, latest)
+	}
+	return nil
+}
+
+// MigrateUp применяет все ещё не применённые миграции и возвращает их версии
+func MigrateUp(ctx context.Context, pool *pgxpool.Pool) ([]int, error) {
+	latest, err := LatestVersion()
+	if err != nil {
+		return nil, err
+	}
+	return MigrateTo(ctx, pool, latest)
+}
+
+// MigrateDown откатывает steps последних применённых миграций и возвращает их версии
+func MigrateDown(ctx context.Context, pool *pgxpool.Pool, steps int) ([]int, error) {
+	if steps < 1 {
+		return nil, fmt.Errorf("число откатываемых миграций должно быть положительным: %d", steps)
+	}
+	var done []int
+	err := withMigrationLock(ctx, pool, func(conn *pgx.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		target := 0
+		if steps < len(applied) {
+			target = applied[len(applied)-steps-1]
+		}
+		done, err = migrateTo(ctx, conn, target)
+		return err
+	})
+	return done, err
+}
+
+// MigrateTo приводит схему к версии target: применяет недостающие миграции
+// или откатывает лишние. Каждая миграция выполняется в своей транзакции.
+func MigrateTo(ctx context.Context, pool *pgxpool.Pool, target int) ([]int, error) {
+	var done []int
+	err := withMigrationLock(ctx, pool, func(conn *pgx.Conn) error {
+		var err error
+		done, err = migrateTo(ctx, conn, target)
+		return err
+	})
+	return done, err
+}
+
+func migrateTo(ctx context.Context, conn *pgx.Conn, target int) ([]int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if target != 0 && !hasVersion(migrations, target) {
+		return nil, fmt.Errorf("нет миграции с версией %d", target)
+	}
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	isApplied := make(map[int]bool, len(applied))
+	for _, v := range applied {
+		isApplied[v] = true
+	}
+
+	var done []int
+	// Применяем по возрастанию
+	for _, m := range migrations {
+		if m.Version > target || isApplied[m.Version] {
+			continue
+		}
+		if err := runMigration(ctx, conn, m, true); err != nil {
+			return done, err
+		}
+		done = append(done, m.Version)
+	}
+	// Откатываем по убыванию
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version <= target || !isApplied[m.Version] {
+			continue
+		}
+		if err := runMigration(ctx, conn, m, false); err != nil {
+			return done, err
+		}
+		done = append(done, m.Version)
+	}
+	return done, nil
+}
+
+func runMigration(ctx context.Context, conn *pgx.Conn, m Migration, up bool) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	sql, direction := m.Up, "up"
+	if !up {
+		sql, direction = m.Down, "down"
+	}
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("миграция %d_%s (%s): %w", m.Version, m.Name, direction, err)
+	}
+
+	if up {
+		_, err = tx.Exec(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+	} else {
+		_, err = tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// appliedVersions возвращает применённые версии по возрастанию, создавая schema_migrations при необходимости
+func appliedVersions(ctx context.Context, conn *pgx.Conn) ([]int, error) {
+	_, err := conn.Exec(ctx, `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    BIGINT PRIMARY KEY,
+    name       TEXT        NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, `SELECT version FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
+
+// withMigrationLock выполняет fn на отдельном соединении пула под advisory-блокировкой:
+// блокировка сессионная, поэтому все миграции идут через одно соединение.
+func withMigrationLock(ctx context.Context, pool *pgxpool.Pool, fn func(conn *pgx.Conn) error) error {
+	c, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Release()
+
+	conn := c.Conn()
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+	return fn(conn)
+}
+
+func hasVersion(migrations []Migration, version int) bool {
+	for _, m := range migrations {
+		if m.Version == version {
+			return true
+		}
+	}
+	return false
+}
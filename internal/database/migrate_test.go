@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/natindo/CalVigil/internal/database/dbtest"
+)
+
+func TestMain(m *testing.M) { dbtest.Main(m) }
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("нет встроенных миграций")
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("миграция %s: версия %d, ожидалась %d — версии должны идти подряд", m.Name, m.Version, i+1)
+		}
+	}
+	latest, err := LatestVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest != len(migrations) {
+		t.Errorf("LatestVersion = %d, ожидалось %d", latest, len(migrations))
+	}
+}
+
+func TestLoadMigrationsErrors(t *testing.T) {
+	file := func(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+	tests := []struct {
+		name string
+		fs   fstest.MapFS
+	}{
+		{"нет down", fstest.MapFS{
+			"m/0001_a.up.sql": file("SELECT 1"),
+		}},
+		{"неверное имя", fstest.MapFS{
+			"m/0001_a.sql": file("SELECT 1"),
+		}},
+		{"разные названия", fstest.MapFS{
+			"m/0001_a.up.sql":   file("SELECT 1"),
+			"m/0001_b.down.sql": file("SELECT 1"),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadMigrations(tt.fs, "m"); err == nil {
+				t.Error("ожидалась ошибка")
+			}
+		})
+	}
+
+	got, err := loadMigrations(fstest.MapFS{
+		"m/0002_b.up.sql":   file("up2"),
+		"m/0002_b.down.sql": file("down2"),
+		"m/0001_a.up.sql":   file("up1"),
+		"m/0001_a.down.sql": file("down1"),
+	}, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Version != 1 || got[1].Up != "up2" || got[1].Down != "down2" {
+		t.Errorf("loadMigrations = %+v", got)
+	}
+}
+
+// TestMigrateRoundTrip применяет и откатывает все миграции на настоящей базе.
+// Нужна пустая тестовая база: CALVIGIL_TEST_DATABASE_URL=postgres://... или встроенный PostgreSQL
+func TestMigrateRoundTrip(t *testing.T) {
+	url := dbtest.URL(t)
+	ctx := context.Background()
+	pool, err := ConnectPostgres(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	latest, err := LatestVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MigrateUp(ctx, pool); err != nil {
+		t.Fatal("up:", err)
+	}
+	if err := CheckSchema(ctx, pool); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := MigrateTo(ctx, pool, 0); err != nil {
+		t.Fatal("down:", err)
+	}
+	if v, _ := SchemaVersion(ctx, pool); v != 0 {
+		t.Fatalf("после отката версия %d", v)
+	}
+	if err := CheckSchema(ctx, pool); !errors.Is(err, ErrSchemaOutdated) {
+		t.Fatalf("CheckSchema = %v, ожидалась ErrSchemaOutdated", err)
+	}
+	if _, err := ConnectPostgres(ctx, url, RequireLatestSchema()); !errors.Is(err, ErrSchemaOutdated) {
+		t.Fatalf("ConnectPostgres = %v, ожидалась ErrSchemaOutdated", err)
+	}
+
+	done, err := MigrateUp(ctx, pool)
+	if err != nil {
+		t.Fatal("повторный up:", err)
+	}
+	if len(done) != latest {
+		t.Errorf("применено %d миграций, ожидалось %d", len(done), latest)
+	}
+	if done, _ := MigrateDown(ctx, pool, 1); len(done) != 1 || done[0] != latest {
+		t.Errorf("MigrateDown(1) = %v", done)
+	}
+	if _, err := MigrateUp(ctx, pool); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,13 @@
+-- Исходная таблица событий. IF NOT EXISTS — чтобы принять под миграции базы,
+-- где таблица уже была создана вручную.
+CREATE TABLE IF NOT EXISTS events (
+    id            SERIAL PRIMARY KEY,
+    chat_id       BIGINT      NOT NULL,
+    title         TEXT        NOT NULL,
+    start_time    TIMESTAMPTZ NOT NULL,
+    end_time      TIMESTAMPTZ NOT NULL,
+    notify_before INT         NOT NULL DEFAULT 5,
+    notified      BOOLEAN     NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS events_chat_start_idx ON events (chat_id, start_time);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS event_exceptions;
+ALTER TABLE events DROP COLUMN IF EXISTS rrule;
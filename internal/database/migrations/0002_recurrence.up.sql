@@ -0,0 +1,12 @@
+-- Повторяющиеся события: правило RRULE и исключения для отдельных повторений
+ALTER TABLE events ADD COLUMN rrule TEXT;
+
+CREATE TABLE event_exceptions (
+    event_id         INT         NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    occurrence_start TIMESTAMPTZ NOT NULL,
+    cancelled        BOOLEAN     NOT NULL DEFAULT false,
+    start_time       TIMESTAMPTZ,
+    end_time         TIMESTAMPTZ,
+    title            TEXT,
+    PRIMARY KEY (event_id, occurrence_start)
+);
@@ -0,0 +1,20 @@
+ALTER TABLE events
+    ADD COLUMN notify_before INT     NOT NULL DEFAULT 5,
+    ADD COLUMN notified      BOOLEAN NOT NULL DEFAULT false;
+
+-- Из нескольких напоминаний сохраняется самое раннее
+UPDATE events e
+SET notify_before = r.offset_minutes,
+    notified = EXISTS (
+        SELECT 1 FROM reminder_deliveries d
+        WHERE d.reminder_id = r.id AND d.occurrence_start = e.start_time
+    )
+FROM (
+    SELECT DISTINCT ON (event_id) id, event_id, offset_minutes
+    FROM event_reminders
+    ORDER BY event_id, offset_minutes DESC
+) r
+WHERE r.event_id = e.id;
+
+DROP TABLE IF EXISTS reminder_deliveries;
+DROP TABLE IF EXISTS event_reminders;
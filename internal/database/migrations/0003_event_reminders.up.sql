@@ -0,0 +1,30 @@
+-- Несколько напоминаний на событие; доставка учитывается для каждого повторения отдельно.
+-- Заменяет колонки events.notify_before и events.notified.
+CREATE TABLE event_reminders (
+    id             SERIAL PRIMARY KEY,
+    event_id       INT NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    offset_minutes INT NOT NULL CHECK (offset_minutes >= 0),
+    UNIQUE (event_id, offset_minutes)
+);
+
+CREATE TABLE reminder_deliveries (
+    reminder_id      INT         NOT NULL REFERENCES event_reminders (id) ON DELETE CASCADE,
+    occurrence_start TIMESTAMPTZ NOT NULL,
+    sent_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (reminder_id, occurrence_start)
+);
+
+INSERT INTO event_reminders (event_id, offset_minutes)
+SELECT id, notify_before
+FROM events
+WHERE notify_before >= 0;
+
+INSERT INTO reminder_deliveries (reminder_id, occurrence_start)
+SELECT r.id, e.start_time
+FROM events e
+JOIN event_reminders r ON r.event_id = e.id
+WHERE e.notified;
+
+ALTER TABLE events
+    DROP COLUMN notify_before,
+    DROP COLUMN notified;
@@ -0,0 +1,10 @@
+-- Отложенные напоминания («напомнить через 5 минут»)
+CREATE TABLE snoozes (
+    id               SERIAL PRIMARY KEY,
+    event_id         INT         NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    occurrence_start TIMESTAMPTZ NOT NULL,
+    remind_at        TIMESTAMPTZ NOT NULL,
+    sent_at          TIMESTAMPTZ
+);
+
+CREATE INDEX snoozes_due_idx ON snoozes (remind_at) WHERE sent_at IS NULL;
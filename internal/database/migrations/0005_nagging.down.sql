@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS nag_states;
+ALTER TABLE events
+    DROP COLUMN IF EXISTS nag_interval_minutes,
+    DROP COLUMN IF EXISTS nag_max;
@@ -0,0 +1,15 @@
+-- Режим «напоминать, пока не подтвердят»
+ALTER TABLE events
+    ADD COLUMN nag_interval_minutes INT CHECK (nag_interval_minutes > 0),
+    ADD COLUMN nag_max              INT NOT NULL DEFAULT 0;
+
+CREATE TABLE nag_states (
+    event_id         INT         NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    occurrence_start TIMESTAMPTZ NOT NULL,
+    next_at          TIMESTAMPTZ NOT NULL,
+    sent_count       INT         NOT NULL DEFAULT 0,
+    acknowledged_at  TIMESTAMPTZ,
+    PRIMARY KEY (event_id, occurrence_start)
+);
+
+CREATE INDEX nag_states_due_idx ON nag_states (next_at) WHERE acknowledged_at IS NULL;
@@ -0,0 +1,5 @@
+-- Настройки чата: часовой пояс IANA, в котором вводятся и показываются даты
+CREATE TABLE chat_settings (
+    chat_id  BIGINT PRIMARY KEY,
+    timezone TEXT NOT NULL
+);
@@ -0,0 +1,8 @@
+-- Незавершённые диалоги создания и редактирования событий: переживают перезапуск бота
+CREATE TABLE dialog_states (
+    chat_id    BIGINT PRIMARY KEY,
+    state      JSONB       NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX dialog_states_updated_idx ON dialog_states (updated_at);
@@ -0,0 +1,13 @@
+-- Числовые ID для чатов платформ, где чат задаётся строкой (комнаты Matrix).
+-- Последовательность начинается с 2^62, чтобы не пересечься с ID чатов Telegram,
+-- которые хранятся в events.chat_id как есть.
+CREATE SEQUENCE platform_chat_id_seq START WITH 4611686018427387904 MINVALUE 4611686018427387904;
+
+CREATE TABLE platform_chats (
+    chat_id     BIGINT PRIMARY KEY DEFAULT nextval('platform_chat_id_seq'),
+    platform    TEXT NOT NULL,
+    external_id TEXT NOT NULL,
+    UNIQUE (platform, external_id)
+);
+
+ALTER SEQUENCE platform_chat_id_seq OWNED BY platform_chats.chat_id;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS blocked_chats;
+DROP TABLE IF EXISTS reminder_outbox;
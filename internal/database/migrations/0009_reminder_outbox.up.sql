@@ -0,0 +1,27 @@
+-- Очередь отправки напоминаний: сообщение доставлено, только когда мессенджер
+-- подтвердил отправку; неудачные попытки повторяются с растущей паузой до expires_at
+CREATE TABLE reminder_outbox (
+    id              BIGSERIAL PRIMARY KEY,
+    chat_id         BIGINT      NOT NULL,
+    text            TEXT        NOT NULL,
+    keyboard        JSONB,
+    attempts        INT         NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at      TIMESTAMPTZ NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    sent_at         TIMESTAMPTZ,
+    failed_at       TIMESTAMPTZ,
+    last_error      TEXT
+);
+
+CREATE INDEX reminder_outbox_pending_idx ON reminder_outbox (next_attempt_at)
+    WHERE sent_at IS NULL AND failed_at IS NULL;
+CREATE INDEX reminder_outbox_created_idx ON reminder_outbox (created_at);
+
+-- Чаты, куда бот не может писать (бота заблокировали или удалили):
+-- напоминания для них не отправляются до команды /start
+CREATE TABLE blocked_chats (
+    chat_id    BIGINT PRIMARY KEY,
+    reason     TEXT        NOT NULL,
+    blocked_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,4 @@
+-- Конец серии: позже series_end у неё нет повторений по правилу (NULL — бесконечная
+-- серия или одиночное событие). Notifier по нему не загружает закончившиеся серии.
+-- У уже созданных серий колонка пуста, пока их не изменят: они считаются бесконечными.
+ALTER TABLE events ADD COLUMN series_end TIMESTAMPTZ;
@@ -0,0 +1,307 @@
+// Package dialog — конечный автомат для многошаговых диалогов бота.
+//
+// Диалог объявляется списком шагов: у каждого шага есть подсказка, клавиатура,
+// обработчики текста и кнопок (они же проверяют ввод), условие пропуска и строка
+// для сводки уже введённых значений. Переходы, «Назад», «Пропустить», «Отмена»
+// и тайм-аут диалога движок делает сам; отправка сообщений и хранение состояния
+// остаются за вызывающим кодом.
+package dialog
+
+import (
+	"strings"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+)
+
+// Callback-действия навигации, общие для всех диалогов:
+//
+//	wz:back   — вернуться к предыдущему шагу
+//	wz:skip   — оставить значение шага как есть и перейти дальше
+//	wz:cancel — прервать диалог
+const (
+	NavAction = "wz"
+	NavBack   = "back"
+	NavSkip   = "skip"
+	NavCancel = "cancel"
+)
+
+// Cursor — положение диалога. Хранится вместе с состоянием диалога.
+type Cursor struct {
+	Dialog  string    `json:"dialog"`            // имя диалога (Dialog.Name)
+	Step    string    `json:"step"`              // текущий шаг
+	History []string  `json:"history,omitempty"` // пройденные шаги, для «Назад» и сводки
+	Touched time.Time `json:"touched"`           // последнее продвижение, для тайм-аута
+}
+
+// State — состояние диалога; движок хранит в нём свой Cursor
+type State interface {
+	DialogCursor() *Cursor
+}
+
+type resultKind int
+
+const (
+	resultNext resultKind = iota
+	resultGoto
+	resultStay
+	resultRetry
+	resultIgnore
+)
+
+// Result — что делать после ввода на шаге. Создаётся функциями Next, Goto,
+// Stay, Retry и Ignore.
+type Result struct {
+	kind    resultKind
+	step    string
+	message string
+}
+
+// Next — значение принято, перейти к следующему шагу (или завершить диалог)
+func Next() Result { return Result{kind: resultNext} }
+
+// Goto — значение принято, перейти к шагу step
+func Goto(step string) Result { return Result{kind: resultGoto, step: step} }
+
+// Stay — остаться на шаге и показать его заново (например, после листания календаря)
+func Stay() Result { return Result{kind: resultStay} }
+
+// Retry — ввод не принят; message объясняет, что не так
+func Retry(message string) Result { return Result{kind: resultRetry, message: message} }
+
+// Ignore — ничего не изменилось, перерисовывать шаг не нужно
+func Ignore() Result { return Result{kind: resultIgnore} }
+
+// Notify добавляет короткое уведомление к принятому вводу (всплывает у кнопки)
+func (r Result) Notify(message string) Result {
+	r.message = message
+	return r
+}
+
+// Step — объявление шага диалога. Обязательны Name и Prompt.
+type Step[S State] struct {
+	Name   string
+	Prompt func(s S) string
+	// Keyboard — кнопки ввода значения; строка навигации добавляется движком
+	Keyboard func(s S) messenger.Keyboard
+	// Summary — строка сводки над подсказкой, когда шаг уже пройден
+	Summary func(s S) string
+	// Text проверяет текстовый ввод и сохраняет значение в s. nil — только кнопки.
+	Text func(s S, text string) Result
+	// Buttons — обработчики callback-действий шага по имени действия
+	Buttons map[string]func(s S, args []string) Result
+	// Skip — шаг не нужен для этого состояния и проходится без вопроса
+	Skip func(s S) bool
+	// Skippable — показать кнопку «Пропустить»: значение шага уже есть
+	Skippable func(s S) bool
+}
+
+// Outcome — итог обработки ввода для вызывающего кода
+type Outcome int
+
+const (
+	Continue  Outcome = iota // диалог продолжается: показать и сохранить текущий шаг
+	Unchanged                // ничего не изменилось
+	Rejected                 // ввод не принят, шаг прежний
+	Finished                 // все шаги пройдены
+	Cancelled                // пользователь прервал диалог
+	Left                     // «Назад» с первого шага (см. Dialog.BackFromStart)
+	Broken                   // состояние не относится к этому диалогу или шаг неизвестен
+)
+
+// Dialog — объявление диалога: упорядоченные шаги и общие настройки
+type Dialog[S State] struct {
+	Name  string
+	Title string // первая строка сообщения диалога
+	Steps []Step[S]
+	// Timeout — сколько диалог ждёт ответа; 0 — без ограничения
+	Timeout time.Duration
+	// BackFromStart показывает «Назад» и на первом шаге: выход из диалога
+	// туда, откуда он начат (Outcome Left)
+	BackFromStart bool
+}
+
+// Start начинает диалог с первого нужного шага
+func (d *Dialog[S]) Start(s S, now time.Time) Outcome {
+	c := s.DialogCursor()
+	*c = Cursor{Dialog: d.Name, Touched: now}
+	i := d.nextIndex(s, 0)
+	if i < 0 {
+		return Finished
+	}
+	c.Step = d.Steps[i].Name
+	return Continue
+}
+
+// Current — текущий шаг состояния s
+func (d *Dialog[S]) Current(s S) (*Step[S], bool) {
+	c := s.DialogCursor()
+	if c.Dialog != d.Name {
+		return nil, false
+	}
+	i := d.index(c.Step)
+	if i < 0 {
+		return nil, false
+	}
+	return &d.Steps[i], true
+}
+
+// Expired сообщает, что ответа ждали дольше Timeout
+func (d *Dialog[S]) Expired(s S, now time.Time) bool {
+	touched := s.DialogCursor().Touched
+	return d.Timeout > 0 && !touched.IsZero() && now.Sub(touched) > d.Timeout
+}
+
+// HandleText передаёт текст обработчику текущего шага.
+// Возвращаемая строка — пояснение к отказу или уведомление.
+func (d *Dialog[S]) HandleText(s S, text string, now time.Time) (Outcome, string) {
+	step, ok := d.Current(s)
+	if !ok {
+		return Broken, ""
+	}
+	if step.Text == nil {
+		return Rejected, "Выберите вариант кнопкой под сообщением."
+	}
+	return d.apply(s, step, step.Text(s, text), now)
+}
+
+// HandleButton обрабатывает callback-действие: навигацию или кнопку текущего шага.
+// Кнопка, которой у шага нет (например, из старого сообщения), отклоняется
+// с пустым пояснением.
+func (d *Dialog[S]) HandleButton(s S, action string, args []string, now time.Time) (Outcome, string) {
+	step, ok := d.Current(s)
+	if !ok {
+		return Broken, ""
+	}
+	if action == NavAction {
+		if len(args) != 1 {
+			return Rejected, ""
+		}
+		switch args[0] {
+		case NavBack:
+			return d.Back(s, now), ""
+		case NavSkip:
+			if step.Skippable == nil || !step.Skippable(s) {
+				return Rejected, ""
+			}
+			return d.apply(s, step, Next(), now)
+		case NavCancel:
+			return Cancelled, ""
+		}
+		return Rejected, ""
+	}
+
+	handler, ok := step.Buttons[action]
+	if !ok {
+		return Rejected, ""
+	}
+	return d.apply(s, step, handler(s, args), now)
+}
+
+// Back возвращает к предыдущему пройденному шагу. Введённые значения
+// сохраняются, поэтому на нём их можно оставить или поменять.
+func (d *Dialog[S]) Back(s S, now time.Time) Outcome {
+	if _, ok := d.Current(s); !ok {
+		return Broken
+	}
+	c := s.DialogCursor()
+	if len(c.History) == 0 {
+		if d.BackFromStart {
+			return Left
+		}
+		return Rejected
+	}
+	c.Step = c.History[len(c.History)-1]
+	c.History = c.History[:len(c.History)-1]
+	c.Touched = now
+	return Continue
+}
+
+// Render — текст сообщения диалога (заголовок, сводка пройденных шагов,
+// подсказка текущего шага) и клавиатура шага со строкой навигации
+func (d *Dialog[S]) Render(s S) (string, messenger.Keyboard) {
+	step, ok := d.Current(s)
+	if !ok {
+		return d.Title, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(d.Title + "\n")
+	for _, name := range s.DialogCursor().History {
+		if i := d.index(name); i >= 0 && d.Steps[i].Summary != nil {
+			sb.WriteString(d.Steps[i].Summary(s) + "\n")
+		}
+	}
+	sb.WriteString("\n" + step.Prompt(s))
+
+	var keyboard messenger.Keyboard
+	if step.Keyboard != nil {
+		keyboard = append(keyboard, step.Keyboard(s)...)
+	}
+	return sb.String(), append(keyboard, d.navRow(s, step))
+}
+
+// navRow — строка «Назад» / «Пропустить» / «Отмена» под клавиатурой шага
+func (d *Dialog[S]) navRow(s S, step *Step[S]) []messenger.Button {
+	nav := func(label, arg string) messenger.Button {
+		return messenger.NewButton(label, NavAction+":"+arg)
+	}
+	var row []messenger.Button
+	if len(s.DialogCursor().History) > 0 || d.BackFromStart {
+		row = append(row, nav("« Назад", NavBack))
+	}
+	if step.Skippable != nil && step.Skippable(s) {
+		row = append(row, nav("Пропустить", NavSkip))
+	}
+	return append(row, nav("Отмена", NavCancel))
+}
+
+// apply выполняет переход, который вернул обработчик шага
+func (d *Dialog[S]) apply(s S, step *Step[S], r Result, now time.Time) (Outcome, string) {
+	c := s.DialogCursor()
+	switch r.kind {
+	case resultIgnore:
+		return Unchanged, r.message
+	case resultRetry:
+		return Rejected, r.message
+	case resultStay:
+		c.Touched = now
+		return Continue, r.message
+	case resultGoto:
+		if d.index(r.step) < 0 {
+			return Broken, ""
+		}
+		c.History = append(c.History, step.Name)
+		c.Step = r.step
+		c.Touched = now
+		return Continue, r.message
+	}
+
+	c.History = append(c.History, step.Name)
+	c.Touched = now
+	i := d.nextIndex(s, d.index(step.Name)+1)
+	if i < 0 {
+		return Finished, r.message
+	}
+	c.Step = d.Steps[i].Name
+	return Continue, r.message
+}
+
+// nextIndex — первый шаг начиная с from, который не пропускается; -1 — шагов нет
+func (d *Dialog[S]) nextIndex(s S, from int) int {
+	for i := from; i < len(d.Steps); i++ {
+		if skip := d.Steps[i].Skip; skip == nil || !skip(s) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *Dialog[S]) index(name string) int {
+	for i := range d.Steps {
+		if d.Steps[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,232 @@
+package dialog
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+)
+
+// signup — небольшой диалог для проверки движка: имя, возраст, подтверждение
+type signup struct {
+	cursor    Cursor
+	Name      string
+	Age       int
+	Confirmed bool
+}
+
+func (s *signup) DialogCursor() *Cursor { return &s.cursor }
+
+func signupDialog() *Dialog[*signup] {
+	return &Dialog[*signup]{
+		Name:    "signup",
+		Title:   "Регистрация.",
+		Timeout: time.Hour,
+		Steps: []Step[*signup]{
+			{
+				Name:    "name",
+				Prompt:  func(*signup) string { return "Имя?" },
+				Summary: func(s *signup) string { return "Имя: " + s.Name },
+				Text: func(s *signup, text string) Result {
+					if text == "" {
+						return Retry("Имя не может быть пустым.")
+					}
+					s.Name = text
+					return Next()
+				},
+			},
+			{
+				Name:      "age",
+				Prompt:    func(*signup) string { return "Возраст?" },
+				Summary:   func(s *signup) string { return "Возраст: " + strconv.Itoa(s.Age) },
+				Skippable: func(s *signup) bool { return s.Age > 0 },
+				Text: func(s *signup, text string) Result {
+					age, err := strconv.Atoi(text)
+					if err != nil || age <= 0 {
+						return Retry("Введите число.")
+					}
+					s.Age = age
+					return Next()
+				},
+			},
+			{
+				Name:   "confirm",
+				Prompt: func(*signup) string { return "Всё верно?" },
+				Skip:   func(s *signup) bool { return s.Age < 18 },
+				Keyboard: func(*signup) messenger.Keyboard {
+					return messenger.NewKeyboard(messenger.NewRow(
+						messenger.NewButton("Да", "ok:yes")))
+				},
+				Buttons: map[string]func(*signup, []string) Result{
+					"ok": func(s *signup, args []string) Result {
+						if len(args) != 1 {
+							return Ignore()
+						}
+						s.Confirmed = args[0] == "yes"
+						return Next().Notify("Готово")
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestDialogFlow(t *testing.T) {
+	d := signupDialog()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := &signup{}
+
+	if got := d.Start(s, now); got != Continue || s.cursor.Step != "name" || s.cursor.Dialog != "signup" {
+		t.Fatalf("Start = %v, курсор %+v", got, s.cursor)
+	}
+	if got, msg := d.HandleText(s, "", now); got != Rejected || msg != "Имя не может быть пустым." {
+		t.Fatalf("пустое имя: %v, %q", got, msg)
+	}
+	if got, _ := d.HandleText(s, "Аня", now); got != Continue || s.cursor.Step != "age" {
+		t.Fatalf("после имени: %v, шаг %q", got, s.cursor.Step)
+	}
+	if got, _ := d.HandleText(s, "abc", now); got != Rejected || s.cursor.Step != "age" {
+		t.Fatalf("неверный возраст: %v, шаг %q", got, s.cursor.Step)
+	}
+	if got, _ := d.HandleText(s, "30", now); got != Continue || s.cursor.Step != "confirm" {
+		t.Fatalf("после возраста: %v, шаг %q", got, s.cursor.Step)
+	}
+
+	// На шаге только с кнопками текст не принимается, а чужие кнопки отклоняются
+	if got, _ := d.HandleText(s, "да", now); got != Rejected {
+		t.Errorf("текст на шаге с кнопками: %v", got)
+	}
+	if got, _ := d.HandleButton(s, "cal", []string{"noop"}, now); got != Rejected {
+		t.Errorf("чужая кнопка: %v", got)
+	}
+	if got, _ := d.HandleButton(s, "ok", nil, now); got != Unchanged {
+		t.Errorf("Ignore: %v", got)
+	}
+
+	got, msg := d.HandleButton(s, "ok", []string{"yes"}, now)
+	if got != Finished || msg != "Готово" || !s.Confirmed {
+		t.Fatalf("подтверждение: %v, %q, %+v", got, msg, s)
+	}
+}
+
+func TestDialogSkipWhenNotNeeded(t *testing.T) {
+	d := signupDialog()
+	s := &signup{}
+	now := time.Now()
+	d.Start(s, now)
+	d.HandleText(s, "Петя", now)
+	// Шаг подтверждения пропускается: диалог завершается сразу после возраста
+	if got, _ := d.HandleText(s, "12", now); got != Finished {
+		t.Fatalf("ожидалось завершение, получено %v", got)
+	}
+}
+
+func TestDialogBackAndSkipButton(t *testing.T) {
+	d := signupDialog()
+	s := &signup{}
+	now := time.Now()
+	d.Start(s, now)
+
+	if got := d.Back(s, now); got != Rejected {
+		t.Errorf("«Назад» с первого шага: %v", got)
+	}
+	d.HandleText(s, "Аня", now)
+	d.HandleText(s, "30", now)
+
+	if got, _ := d.HandleButton(s, NavAction, []string{NavBack}, now); got != Continue || s.cursor.Step != "age" {
+		t.Fatalf("«Назад»: %v, шаг %q", got, s.cursor.Step)
+	}
+	if len(s.cursor.History) != 1 || s.Age != 30 {
+		t.Errorf("после «Назад»: история %v, возраст %d", s.cursor.History, s.Age)
+	}
+
+	// Возраст уже введён — шаг можно пропустить
+	if _, kb := d.Render(s); !hasButton(kb, "wz:skip") {
+		t.Error("нет кнопки «Пропустить»")
+	}
+	if got, _ := d.HandleButton(s, NavAction, []string{NavSkip}, now); got != Continue || s.cursor.Step != "confirm" {
+		t.Fatalf("«Пропустить»: %v, шаг %q", got, s.cursor.Step)
+	}
+
+	// Имя не введено — пропустить нельзя
+	fresh := &signup{}
+	d.Start(fresh, now)
+	if got, _ := d.HandleButton(fresh, NavAction, []string{NavSkip}, now); got != Rejected {
+		t.Errorf("пропуск обязательного шага: %v", got)
+	}
+	if got, _ := d.HandleButton(fresh, NavAction, []string{NavCancel}, now); got != Cancelled {
+		t.Errorf("«Отмена»: %v", got)
+	}
+}
+
+func TestDialogBackFromStart(t *testing.T) {
+	d := signupDialog()
+	d.BackFromStart = true
+	s := &signup{}
+	d.Start(s, time.Now())
+	if _, kb := d.Render(s); !hasButton(kb, "wz:back") {
+		t.Error("нет кнопки «Назад» на первом шаге")
+	}
+	if got := d.Back(s, time.Now()); got != Left {
+		t.Errorf("Back = %v, ожидалось Left", got)
+	}
+}
+
+func TestDialogRender(t *testing.T) {
+	d := signupDialog()
+	s := &signup{}
+	now := time.Now()
+	d.Start(s, now)
+
+	_, kb := d.Render(s)
+	nav := kb[len(kb)-1]
+	if len(nav) != 1 || nav[0].Data != "wz:cancel" {
+		t.Errorf("первый шаг: навигация %v, ожидалась только «Отмена»", nav)
+	}
+
+	d.HandleText(s, "Аня", now)
+	d.HandleText(s, "30", now)
+	text, kb := d.Render(s)
+	if text != "Регистрация.\nИмя: Аня\nВозраст: 30\n\nВсё верно?" {
+		t.Errorf("текст: %q", text)
+	}
+	if len(kb) != 2 || !hasButton(kb, "ok:yes") || !hasButton(kb, "wz:back") {
+		t.Errorf("клавиатура: %+v", kb)
+	}
+}
+
+func TestDialogTimeoutAndBroken(t *testing.T) {
+	d := signupDialog()
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := &signup{}
+	d.Start(s, start)
+	d.HandleText(s, "Аня", start.Add(50*time.Minute))
+
+	if d.Expired(s, start.Add(100*time.Minute)) {
+		t.Error("тайм-аут отсчитывается от последнего ответа")
+	}
+	if !d.Expired(s, start.Add(111*time.Minute)) {
+		t.Error("диалог не истёк")
+	}
+
+	other := &signup{cursor: Cursor{Dialog: "other", Step: "name"}}
+	if got, _ := d.HandleText(other, "x", start); got != Broken {
+		t.Errorf("чужой диалог: %v", got)
+	}
+	unknown := &signup{cursor: Cursor{Dialog: "signup", Step: "email"}}
+	if got, _ := d.HandleButton(unknown, NavAction, []string{NavBack}, start); got != Broken {
+		t.Errorf("неизвестный шаг: %v", got)
+	}
+}
+
+func hasButton(kb messenger.Keyboard, data string) bool {
+	for _, row := range kb {
+		for _, b := range row {
+			if b.Data == data {
+				return true
+			}
+		}
+	}
+	return false
+}
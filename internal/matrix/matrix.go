@@ -0,0 +1,365 @@
+// Package matrix — адаптер Matrix (client-server API). Бот — обычный пользователь
+// homeserver-а: сообщения получает через /sync, отвечает сообщениями m.text и правит
+// их через m.replace. Inline-кнопок в Matrix нет, поэтому клавиатура печатается
+// нумерованным списком под текстом, а ответ «#N» нажимает кнопку N.
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+)
+
+// Platform — имя платформы в messenger.ChatDirectory
+const Platform = "matrix"
+
+// DefaultSyncTimeout — сколько homeserver держит запрос /sync, если нет событий
+const DefaultSyncTimeout = 30 * time.Second
+
+// requestTimeout ограничивает один запрос к homeserver-у, кроме ожидания в /sync
+const requestTimeout = 30 * time.Second
+
+// maxMessages — сколько последних сообщений бот помнит, чтобы править их и
+// принимать нажатия их кнопок; сообщения старше забываются
+const maxMessages = 1000
+
+// Options — подключение к homeserver-у
+type Options struct {
+	// Homeserver — адрес client-server API, например https://matrix.example.org
+	Homeserver string
+	// Token — access token пользователя-бота
+	Token string
+	// Chats хранит числовые ID комнат
+	Chats messenger.ChatDirectory
+	// SyncTimeout — ожидание событий в /sync; 0 — DefaultSyncTimeout
+	SyncTimeout time.Duration
+	// RetryDelay — пауза перед повтором /sync после ошибки; 0 — 5 секунд
+	RetryDelay time.Duration
+	// HTTPClient — nil означает http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// Error — ответ homeserver-а с ошибкой, например M_FORBIDDEN
+type Error struct {
+	Status  int
+	Code    string `json:"errcode"`
+	Message string `json:"error"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("matrix: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// Is сопоставляет ответ 403 с messenger.ErrForbidden: бота выгнали из комнаты
+// или заблокировали
+func (e *Error) Is(target error) bool {
+	return target == messenger.ErrForbidden && e.Status == http.StatusForbidden
+}
+
+// Client — Messenger и источник апдейтов поверх одного пользователя Matrix
+type Client struct {
+	homeserver  string
+	token       string
+	chats       messenger.ChatDirectory
+	syncTimeout time.Duration
+	retryDelay  time.Duration
+	http        *http.Client
+	userID      string
+
+	// txnPrefix и txn дают уникальные ID транзакций отправки: повтор запроса
+	// с тем же ID homeserver не превратит во второе сообщение
+	txnPrefix string
+	txn       atomic.Int64
+
+	mu       sync.Mutex
+	rooms    map[int64]string
+	chatIDs  map[string]int64
+	members  map[string]int
+	lastID   int
+	messages map[int]*message
+	buttons  map[int64]*messenger.ButtonNumbers
+}
+
+// message — отправленное ботом сообщение в текущем виде
+type message struct {
+	chatID   int64
+	room     string
+	eventID  string
+	text     string
+	keyboard messenger.Keyboard
+}
+
+var _ messenger.Messenger = (*Client)(nil)
+
+// Connect проверяет токен (whoami) и возвращает клиента
+func Connect(ctx context.Context, opts Options) (*Client, error) {
+	if opts.Chats == nil {
+		return nil, errors.New("matrix: не задан ChatDirectory")
+	}
+	c := &Client{
+		homeserver:  strings.TrimRight(opts.Homeserver, "/"),
+		token:       opts.Token,
+		chats:       opts.Chats,
+		syncTimeout: opts.SyncTimeout,
+		retryDelay:  opts.RetryDelay,
+		http:        opts.HTTPClient,
+		txnPrefix:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		rooms:       map[int64]string{},
+		chatIDs:     map[string]int64{},
+		members:     map[string]int{},
+		messages:    map[int]*message{},
+		buttons:     map[int64]*messenger.ButtonNumbers{},
+	}
+	if c.syncTimeout <= 0 {
+		c.syncTimeout = DefaultSyncTimeout
+	}
+	if c.retryDelay <= 0 {
+		c.retryDelay = 5 * time.Second
+	}
+	if c.http == nil {
+		c.http = http.DefaultClient
+	}
+
+	var whoami struct {
+		UserID string `json:"user_id"`
+	}
+	if err := c.request(ctx, http.MethodGet, "/account/whoami", nil, nil, &whoami); err != nil {
+		return nil, fmt.Errorf("whoami: %w", err)
+	}
+	c.userID = whoami.UserID
+	return c, nil
+}
+
+// UserID — пользователь Matrix, от имени которого работает бот
+func (c *Client) UserID() string {
+	return c.userID
+}
+
+// content — содержимое события m.room.message
+type content struct {
+	MsgType    string    `json:"msgtype"`
+	Body       string    `json:"body"`
+	NewContent *content  `json:"m.new_content,omitempty"`
+	RelatesTo  *relation `json:"m.relates_to,omitempty"`
+}
+
+type relation struct {
+	RelType string `json:"rel_type,omitempty"`
+	EventID string `json:"event_id,omitempty"`
+}
+
+// SendMessage отправляет сообщение в комнату чата; кнопки печатаются списком под текстом
+func (c *Client) SendMessage(chatID int64, text string, keyboard messenger.Keyboard) (int, error) {
+	room, err := c.room(chatID)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	c.lastID++
+	id := c.lastID
+	body := c.render(chatID, id, text, keyboard)
+	c.mu.Unlock()
+
+	eventID, err := c.send(room, content{MsgType: "m.text", Body: body})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.numbers(chatID).Assign(id, nil)
+		return 0, err
+	}
+	c.remember(id, &message{chatID: chatID, room: room, eventID: eventID, text: text, keyboard: keyboard})
+	return id, nil
+}
+
+// EditMessage заменяет сообщение правкой m.replace; кнопки получают новые номера
+func (c *Client) EditMessage(chatID int64, messageID int, text string, keyboard messenger.Keyboard) error {
+	c.mu.Lock()
+	m, ok := c.messages[messageID]
+	if !ok || m.chatID != chatID {
+		c.mu.Unlock()
+		return fmt.Errorf("сообщение %d не найдено", messageID)
+	}
+	if m.text == text && messenger.SameKeyboard(m.keyboard, keyboard) {
+		c.mu.Unlock()
+		return nil
+	}
+	body := c.render(chatID, messageID, text, keyboard)
+	room, eventID := m.room, m.eventID
+	c.mu.Unlock()
+
+	_, err := c.send(room, content{
+		MsgType:    "m.text",
+		Body:       "* " + body,
+		NewContent: &content{MsgType: "m.text", Body: body},
+		RelatesTo:  &relation{RelType: "m.replace", EventID: eventID},
+	})
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	m.text, m.keyboard = text, keyboard
+	c.mu.Unlock()
+	return nil
+}
+
+// AnswerCallback отправляет непустой text уведомлением m.notice: всплывающих
+// подсказок в Matrix нет, а уведомления клиенты показывают неброско и без звука
+func (c *Client) AnswerCallback(callbackID, text string) error {
+	if text == "" {
+		return nil
+	}
+	chat, _, _ := strings.Cut(callbackID, " ")
+	chatID, err := strconv.ParseInt(chat, 10, 64)
+	if err != nil {
+		return fmt.Errorf("некорректный ID нажатия %q", callbackID)
+	}
+	room, err := c.room(chatID)
+	if err != nil {
+		return err
+	}
+	_, err = c.send(room, content{MsgType: "m.notice", Body: text})
+	return err
+}
+
+// SetCommands ничего не делает: меню команд в Matrix нет
+func (c *Client) SetCommands([]messenger.Command) error {
+	return nil
+}
+
+// render нумерует кнопки сообщения и дописывает их под текстом; вызывается под c.mu
+func (c *Client) render(chatID int64, messageID int, text string, keyboard messenger.Keyboard) string {
+	lines := c.numbers(chatID).Assign(messageID, keyboard)
+	if len(lines) == 0 {
+		return text
+	}
+	return text + "\n\n" + strings.Join(lines, "\n")
+}
+
+// numbers — нумерация кнопок чата; у каждой комнаты своя. Вызывается под c.mu.
+func (c *Client) numbers(chatID int64) *messenger.ButtonNumbers {
+	n, ok := c.buttons[chatID]
+	if !ok {
+		n = &messenger.ButtonNumbers{}
+		c.buttons[chatID] = n
+	}
+	return n
+}
+
+// remember сохраняет сообщение и забывает то, что старше maxMessages; вызывается под c.mu
+func (c *Client) remember(id int, m *message) {
+	c.messages[id] = m
+	if old, ok := c.messages[id-maxMessages]; ok {
+		c.numbers(old.chatID).Assign(id-maxMessages, nil)
+		delete(c.messages, id-maxMessages)
+	}
+}
+
+// room — комната чата chatID
+func (c *Client) room(chatID int64) (string, error) {
+	c.mu.Lock()
+	room, ok := c.rooms[chatID]
+	c.mu.Unlock()
+	if ok {
+		return room, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	room, err := c.chats.ExternalChatID(ctx, Platform, chatID)
+	if err != nil {
+		return "", err
+	}
+	c.cacheChat(chatID, room)
+	return room, nil
+}
+
+// chatID — числовой ID комнаты room
+func (c *Client) chatID(ctx context.Context, room string) (int64, error) {
+	c.mu.Lock()
+	chatID, ok := c.chatIDs[room]
+	c.mu.Unlock()
+	if ok {
+		return chatID, nil
+	}
+
+	chatID, err := c.chats.ChatID(ctx, Platform, room)
+	if err != nil {
+		return 0, err
+	}
+	c.cacheChat(chatID, room)
+	return chatID, nil
+}
+
+func (c *Client) cacheChat(chatID int64, room string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rooms[chatID] = room
+	c.chatIDs[room] = chatID
+}
+
+// send отправляет событие m.room.message и возвращает его ID
+func (c *Client) send(room string, msg content) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	txn := fmt.Sprintf("%s.%d", c.txnPrefix, c.txn.Add(1))
+	path := "/rooms/" + url.PathEscape(room) + "/send/m.room.message/" + url.PathEscape(txn)
+	var resp struct {
+		EventID string `json:"event_id"`
+	}
+	if err := c.request(ctx, http.MethodPut, path, nil, msg, &resp); err != nil {
+		return "", err
+	}
+	return resp.EventID, nil
+}
+
+// request выполняет запрос к /_matrix/client/v3; ответ с ошибкой возвращается как *Error
+func (c *Client) request(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	link := c.homeserver + "/_matrix/client/v3" + path
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, link, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &Error{Status: resp.StatusCode}
+		json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(apiErr)
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
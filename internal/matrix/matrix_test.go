@@ -0,0 +1,253 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/matrixtest"
+	"github.com/natindo/CalVigil/internal/messenger"
+)
+
+const (
+	alice   = "@alice:test.local"
+	dm      = "!dm:test.local"
+	timeout = 5 * time.Second
+)
+
+// receiver — клиент с запущенным Receive; апдейты складываются в канал
+type receiver struct {
+	*Client
+	updates chan messenger.Update
+	stop    func() error
+	// done закрывается, когда Receive вернулся; err — его результат
+	done chan struct{}
+	err  error
+}
+
+func connect(t *testing.T, srv *matrixtest.Server, chats messenger.ChatDirectory) *Client {
+	t.Helper()
+	c, err := Connect(context.Background(), Options{
+		Homeserver:  srv.URL(),
+		Token:       matrixtest.Token,
+		Chats:       chats,
+		SyncTimeout: time.Second,
+		RetryDelay:  10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func startReceive(t *testing.T, c *Client) *receiver {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &receiver{Client: c, updates: make(chan messenger.Update, 16), done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		r.err = c.Receive(ctx, func(u messenger.Update) bool {
+			r.updates <- u
+			return true
+		})
+	}()
+	r.stop = func() error {
+		cancel()
+		<-r.done
+		return r.err
+	}
+	t.Cleanup(func() { r.stop() })
+	return r
+}
+
+func (r *receiver) next(t *testing.T) messenger.Update {
+	t.Helper()
+	select {
+	case u := <-r.updates:
+		return u
+	case <-time.After(timeout):
+		t.Fatal("апдейт не пришёл")
+		return messenger.Update{}
+	}
+}
+
+// join приглашает бота в комнату и ждёт, пока он войдёт
+func join(t *testing.T, srv *matrixtest.Server, room string, members int) {
+	t.Helper()
+	srv.Invite(room, members)
+	deadline := time.Now().Add(timeout)
+	for !srv.Joined(room) {
+		if time.Now().After(deadline) {
+			t.Fatalf("бот не вошёл в %s", room)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMessagesAndButtons(t *testing.T) {
+	srv := matrixtest.NewServer(t)
+	chats := matrixtest.NewChats()
+	r := startReceive(t, connect(t, srv, chats))
+	if r.UserID() != matrixtest.BotUserID {
+		t.Errorf("UserID = %q", r.UserID())
+	}
+	join(t, srv, dm, 2)
+
+	srv.Say(dm, alice, "/add завтра созвон")
+	msg := r.next(t).Message
+	if msg == nil || msg.Command() != "add" || msg.CommandArguments() != "завтра созвон" || !msg.Private {
+		t.Fatalf("команда: %+v", msg)
+	}
+	if room, _ := chats.ExternalChatID(context.Background(), Platform, msg.ChatID); room != dm {
+		t.Errorf("чат %d сопоставлен комнате %q", msg.ChatID, room)
+	}
+	chatID := msg.ChatID
+
+	keyboard := messenger.NewKeyboard(
+		messenger.NewRow(messenger.NewButton("Да", "ok:yes"), messenger.NewButton("Нет", "ok:no")),
+		messenger.NewRow(messenger.NewButton("Отмена", "wz:cancel")),
+	)
+	id, err := r.SendMessage(chatID, "Всё верно?", keyboard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := srv.Messages(dm)
+	if len(sent) != 1 || sent[0].Text != "Всё верно?\n\n[1] Да  [2] Нет\n[3] Отмена" {
+		t.Fatalf("отправлено: %+v", sent)
+	}
+
+	srv.Say(dm, alice, "#2")
+	cb := r.next(t).Callback
+	if cb == nil || cb.Data != "ok:no" || cb.MessageID != id || cb.MessageText != "Всё верно?" || cb.ChatID != chatID {
+		t.Fatalf("нажатие: %+v", cb)
+	}
+	if err := r.AnswerCallback(cb.ID, "Принято"); err != nil {
+		t.Fatal(err)
+	}
+	srv.WaitMessage(t, dm, timeout, func(m matrixtest.Message) bool { return m.Notice && m.Text == "Принято" })
+
+	// Правка заменяет текст и перенумеровывает кнопки; старые номера больше не работают
+	edited := messenger.NewKeyboard(messenger.NewRow(messenger.NewButton("Понятно", "ack")))
+	for i := 0; i < 2; i++ {
+		if err := r.EditMessage(chatID, id, "Готово", edited); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msgs := srv.Messages(dm)
+	if len(msgs) != 2 || !msgs[0].Edited || msgs[0].Text != "Готово\n\n[4] Понятно" {
+		t.Fatalf("после правки: %+v", msgs)
+	}
+	if err := r.EditMessage(chatID, id+100, "x", nil); err == nil {
+		t.Error("правка неизвестного сообщения прошла без ошибки")
+	}
+	srv.Say(dm, alice, "#1")
+	srv.WaitMessage(t, dm, timeout, func(m matrixtest.Message) bool { return m.Notice && m.Text == "Кнопки #1 нет." })
+
+	// Ответ на сообщение бота приходит с цитатой, она отбрасывается; хэштег — не кнопка
+	srv.Say(dm, alice, "> <@calvigil:test.local> Готово\n\n#4")
+	if cb := r.next(t).Callback; cb == nil || cb.Data != "ack" {
+		t.Errorf("нажатие ответом: %+v", cb)
+	}
+	srv.Say(dm, alice, "#созвон завтра")
+	if msg := r.next(t).Message; msg == nil || msg.Text != "#созвон завтра" {
+		t.Errorf("хэштег: %+v", msg)
+	}
+
+	join(t, srv, "!team:test.local", 5)
+	srv.Say("!team:test.local", alice, "/list")
+	if msg := r.next(t).Message; msg == nil || msg.Private || msg.ChatID == chatID {
+		t.Errorf("групповая комната: %+v", msg)
+	}
+
+	// Свои сообщения и уведомления бот не получает
+	select {
+	case u := <-r.updates:
+		t.Errorf("лишний апдейт: %+v %+v", u.Message, u.Callback)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestReceiveSkipsHistory(t *testing.T) {
+	srv := matrixtest.NewServer(t)
+	chats := matrixtest.NewChats()
+	first := startReceive(t, connect(t, srv, chats))
+	join(t, srv, dm, 2)
+	if err := first.stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Пока бот остановлен
+	srv.Say(dm, alice, "/list")
+	syncs := srv.Syncs()
+	second := startReceive(t, connect(t, srv, chats))
+	for srv.Syncs() < syncs+2 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	srv.Say(dm, alice, "/help")
+	if msg := second.next(t).Message; msg == nil || msg.Command() != "help" {
+		t.Errorf("первый апдейт после перезапуска: %+v", msg)
+	}
+
+	// Числовой ID комнаты сохраняется, поэтому notifier пишет туда и после перезапуска
+	chatID, _ := chats.ChatID(context.Background(), Platform, dm)
+	if _, err := second.SendMessage(chatID, "Напоминание", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.SendMessage(chatID+1, "в никуда", nil); err == nil {
+		t.Error("отправка в неизвестный чат прошла без ошибки")
+	}
+}
+
+func TestReceiveErrors(t *testing.T) {
+	srv := matrixtest.NewServer(t)
+	r := startReceive(t, connect(t, srv, matrixtest.NewChats()))
+	join(t, srv, dm, 2)
+
+	// Сбой homeserver-а повторяется, сообщение не теряется
+	srv.Fail("sync", http.StatusBadGateway, "M_UNKNOWN")
+	srv.Say(dm, alice, "/start")
+	if msg := r.next(t).Message; msg == nil || msg.Command() != "start" {
+		t.Errorf("после сбоя: %+v", msg)
+	}
+
+	// Отозванный токен останавливает Receive
+	srv.Fail("sync", http.StatusUnauthorized, "M_UNKNOWN_TOKEN")
+	srv.Say(dm, alice, "/help")
+	select {
+	case <-r.done:
+	case <-time.After(timeout):
+		t.Fatal("Receive не остановился")
+	}
+	var apiErr *Error
+	if !errors.As(r.err, &apiErr) || apiErr.Code != "M_UNKNOWN_TOKEN" {
+		t.Errorf("Receive = %v, ожидалась ошибка токена", r.err)
+	}
+
+	srv.Fail("send", http.StatusForbidden, "M_FORBIDDEN")
+	chatID, _ := r.chatID(context.Background(), dm)
+	_, err := r.SendMessage(chatID, "привет", nil)
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusForbidden || !errors.Is(err, messenger.ErrForbidden) {
+		t.Errorf("SendMessage = %v, ожидалась ошибка 403", err)
+	}
+
+	if _, err := Connect(context.Background(), Options{Homeserver: srv.URL(), Token: "wrong", Chats: matrixtest.NewChats()}); err == nil ||
+		!strings.Contains(err.Error(), "M_UNKNOWN_TOKEN") {
+		t.Errorf("Connect с чужим токеном: %v", err)
+	}
+}
+
+func TestStripReplyFallback(t *testing.T) {
+	tests := map[string]string{
+		"/list":                      "/list",
+		"> <@bot:x> Текст\n\n#3":     "#3",
+		"> <@bot:x> А\n> Б\n\nответ": "ответ",
+		">не цитата":                 ">не цитата",
+	}
+	for in, want := range tests {
+		if got := stripReplyFallback(in); got != want {
+			t.Errorf("stripReplyFallback(%q) = %q, ожидалось %q", in, got, want)
+		}
+	}
+}
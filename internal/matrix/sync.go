@@ -0,0 +1,180 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+)
+
+// syncFilter оставляет в /sync только сообщения комнат: остальное боту не нужно
+const syncFilter = `{"presence":{"not_types":["*"]},"account_data":{"not_types":["*"]},` +
+	`"room":{"timeline":{"types":["m.room.message"]},"ephemeral":{"not_types":["*"]},"account_data":{"not_types":["*"]}}}`
+
+// syncResponse — нужная боту часть ответа /sync
+type syncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Summary struct {
+				JoinedMembers *int `json:"m.joined_member_count"`
+			} `json:"summary"`
+			Timeline struct {
+				Events []event `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Invite map[string]struct{} `json:"invite"`
+	} `json:"rooms"`
+}
+
+// event — событие из ленты комнаты
+type event struct {
+	Type    string `json:"type"`
+	EventID string `json:"event_id"`
+	Sender  string `json:"sender"`
+	Content struct {
+		MsgType   string    `json:"msgtype"`
+		Body      string    `json:"body"`
+		RelatesTo *relation `json:"m.relates_to"`
+	} `json:"content"`
+}
+
+// Receive получает события через /sync и передаёт их в dispatch, пока не отменён ctx.
+// Подходит как bot.Receiver. История комнат, включая сообщения, пришедшие пока бот
+// был остановлен, пропускается; в комнаты, куда бота пригласили, он входит сам.
+// Сетевые ошибки повторяются после паузы, неверный токен (401) возвращается.
+func (c *Client) Receive(ctx context.Context, dispatch func(messenger.Update) bool) error {
+	since := ""
+	for {
+		resp, err := c.sync(ctx, since)
+		if ctx.Err() != nil {
+			return nil
+		}
+		var apiErr *Error
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusUnauthorized {
+			return err
+		}
+		if err != nil {
+			log.Printf("Matrix /sync: %v", err)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(c.retryDelay):
+			}
+			continue
+		}
+
+		for room := range resp.Rooms.Invite {
+			c.join(ctx, room)
+		}
+		for room, joined := range resp.Rooms.Join {
+			if joined.Summary.JoinedMembers != nil {
+				c.mu.Lock()
+				c.members[room] = *joined.Summary.JoinedMembers
+				c.mu.Unlock()
+			}
+			if since == "" {
+				continue
+			}
+			for _, ev := range joined.Timeline.Events {
+				update, ok := c.convert(ctx, room, ev)
+				if ok && !dispatch(update) {
+					return nil
+				}
+			}
+		}
+		since = resp.NextBatch
+	}
+}
+
+// sync выполняет один запрос /sync; первый (since пуст) — без ожидания
+func (c *Client) sync(ctx context.Context, since string) (*syncResponse, error) {
+	query := url.Values{"filter": {syncFilter}, "timeout": {"0"}}
+	timeout := requestTimeout
+	if since != "" {
+		query.Set("since", since)
+		query.Set("timeout", strconv.FormatInt(c.syncTimeout.Milliseconds(), 10))
+		timeout += c.syncTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var resp syncResponse
+	if err := c.request(ctx, http.MethodGet, "/sync", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// join принимает приглашение в комнату
+func (c *Client) join(ctx context.Context, room string) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	if err := c.request(ctx, http.MethodPost, "/join/"+url.PathEscape(room), nil, struct{}{}, nil); err != nil {
+		log.Printf("Matrix: не удалось войти в комнату %s: %v", room, err)
+	}
+}
+
+// convert переводит текстовое сообщение пользователя в апдейт: «#N» — нажатие
+// кнопки N, остальное — сообщение. Свои сообщения, правки, уведомления других ботов
+// и не текст пропускаются.
+func (c *Client) convert(ctx context.Context, room string, ev event) (messenger.Update, bool) {
+	if ev.Type != "m.room.message" || ev.Sender == c.userID || ev.Content.MsgType != "m.text" ||
+		ev.Content.RelatesTo != nil && ev.Content.RelatesTo.RelType == "m.replace" {
+		return messenger.Update{}, false
+	}
+	chatID, err := c.chatID(ctx, room)
+	if err != nil {
+		log.Printf("Matrix: ID чата для комнаты %s: %v", room, err)
+		return messenger.Update{}, false
+	}
+	text := stripReplyFallback(ev.Content.Body)
+
+	c.mu.Lock()
+	messageID, data, isPress, ok := c.numbers(chatID).Press(text)
+	if isPress && !ok {
+		c.mu.Unlock()
+		if _, err := c.send(room, content{MsgType: "m.notice", Body: fmt.Sprintf("Кнопки %s нет.", text)}); err != nil {
+			log.Printf("Matrix: %v", err)
+		}
+		return messenger.Update{}, false
+	}
+	defer c.mu.Unlock()
+	if isPress {
+		return messenger.Update{Callback: &messenger.Callback{
+			ID:          fmt.Sprintf("%d %s", chatID, ev.EventID),
+			ChatID:      chatID,
+			MessageID:   messageID,
+			MessageText: c.messages[messageID].text,
+			Data:        data,
+		}}, true
+	}
+	c.lastID++
+	return messenger.Update{Message: &messenger.Message{
+		ID:      c.lastID,
+		ChatID:  chatID,
+		Text:    text,
+		Private: c.members[room] == 2,
+	}}, true
+}
+
+// stripReplyFallback убирает цитату, которую клиенты вставляют в начало ответа
+// на сообщение: строки «> …» и пустую строку после них
+func stripReplyFallback(body string) string {
+	if !strings.HasPrefix(body, "> ") {
+		return body
+	}
+	lines := strings.Split(body, "\n")
+	i := 0
+	for i < len(lines) && strings.HasPrefix(lines[i], ">") {
+		i++
+	}
+	return strings.TrimSpace(strings.Join(lines[i:], "\n"))
+}
@@ -0,0 +1,48 @@
+package matrixtest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+)
+
+// Chats — messenger.ChatDirectory в памяти, вместо таблицы platform_chats.
+// ID выдаются с 1<<62, как в БД.
+type Chats struct {
+	mu       sync.Mutex
+	ids      map[[2]string]int64
+	external map[int64][2]string
+	last     int64
+}
+
+var _ messenger.ChatDirectory = (*Chats)(nil)
+
+// NewChats создаёт пустой справочник
+func NewChats() *Chats {
+	return &Chats{ids: map[[2]string]int64{}, external: map[int64][2]string{}, last: 1<<62 - 1}
+}
+
+func (c *Chats) ChatID(_ context.Context, platform, externalID string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := [2]string{platform, externalID}
+	if id, ok := c.ids[key]; ok {
+		return id, nil
+	}
+	c.last++
+	c.ids[key] = c.last
+	c.external[c.last] = key
+	return c.last, nil
+}
+
+func (c *Chats) ExternalChatID(_ context.Context, platform string, chatID int64) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key, ok := c.external[chatID]
+	if !ok || key[0] != platform {
+		return "", fmt.Errorf("чат %d не найден на платформе %s", chatID, platform)
+	}
+	return key[1], nil
+}
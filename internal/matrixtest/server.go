@@ -0,0 +1,384 @@
+// Package matrixtest — поддельный homeserver Matrix для тестов. Он отвечает на нужную
+// боту часть client-server API (whoami, sync, join, send), хранит ленты комнат и
+// позволяет писать в них от имени пользователей и приглашать бота в комнаты.
+package matrixtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Token — access token бота
+const Token = "syt_calvigil_test"
+
+// BotUserID — пользователь, которому принадлежит Token
+const BotUserID = "@calvigil:test.local"
+
+// Message — сообщение бота в комнате в его текущем виде, с учётом правок
+type Message struct {
+	EventID string
+	Room    string
+	Text    string
+	// Notice — уведомление (m.notice), а не обычное сообщение
+	Notice bool
+	Edited bool
+}
+
+// buttonRe — кнопка «[N] Подпись» в тексте сообщения
+var buttonRe = regexp.MustCompile(`\[(\d+)\] (.+?)(?:  |$)`)
+
+// Button возвращает ответ «#N», нажимающий кнопку с подписью label
+func (m Message) Button(label string) (string, bool) {
+	for _, line := range strings.Split(m.Text, "\n") {
+		for _, match := range buttonRe.FindAllStringSubmatch(line, -1) {
+			if match[2] == label {
+				return "#" + match[1], true
+			}
+		}
+	}
+	return "", false
+}
+
+// event — событие в ленте комнаты
+type event struct {
+	Room    string         `json:"-"`
+	Type    string         `json:"type"`
+	EventID string         `json:"event_id"`
+	Sender  string         `json:"sender"`
+	Content map[string]any `json:"content"`
+}
+
+// apiError — ответ с ошибкой, который сервер вернёт вместо очередного запроса
+type apiError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"errcode"`
+	Message string `json:"error"`
+}
+
+// Server — поддельный homeserver. Методы безопасны для вызова из нескольких горутин.
+type Server struct {
+	srv  *httptest.Server
+	done chan struct{}
+
+	mu       sync.Mutex
+	events   []event
+	members  map[string]int
+	invites  map[string]bool
+	joined   map[string]bool
+	txns     map[string]string
+	failures map[string][]apiError
+	syncs    int
+	// wake закрывается, когда в ленте или приглашениях что-то появилось
+	wake chan struct{}
+}
+
+// NewServer запускает сервер; он останавливается вместе с тестом
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		done:     make(chan struct{}),
+		members:  map[string]int{},
+		invites:  map[string]bool{},
+		joined:   map[string]bool{},
+		txns:     map[string]string{},
+		failures: map[string][]apiError{},
+		wake:     make(chan struct{}),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Close останавливает сервер, прерывая ожидающие /sync
+func (s *Server) Close() {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	close(s.done)
+	s.srv.Close()
+}
+
+// URL — адрес homeserver-а
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// Invite приглашает бота в комнату room, где вместе с ботом будет members участников
+func (s *Server) Invite(room string, members int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.invites[room] = true
+	s.members[room] = members
+	s.notify()
+}
+
+// Joined — бот вошёл в комнату room
+func (s *Server) Joined(room string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.joined[room]
+}
+
+// Say пишет в комнату room текст от имени sender
+func (s *Server) Say(room, sender, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.append(room, sender, map[string]any{"msgtype": "m.text", "body": text})
+}
+
+// Messages возвращает сообщения бота в комнате в порядке отправки
+func (s *Server) Messages(room string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var msgs []Message
+	index := map[string]int{}
+	for _, ev := range s.events {
+		if ev.Room != room || ev.Sender != BotUserID {
+			continue
+		}
+		if rel, _ := ev.Content["m.relates_to"].(map[string]any); rel["rel_type"] == "m.replace" {
+			if i, ok := index[fmt.Sprint(rel["event_id"])]; ok {
+				newContent, _ := ev.Content["m.new_content"].(map[string]any)
+				msgs[i].Text, msgs[i].Edited = fmt.Sprint(newContent["body"]), true
+			}
+			continue
+		}
+		index[ev.EventID] = len(msgs)
+		msgs = append(msgs, Message{
+			EventID: ev.EventID,
+			Room:    room,
+			Text:    fmt.Sprint(ev.Content["body"]),
+			Notice:  ev.Content["msgtype"] == "m.notice",
+		})
+	}
+	return msgs
+}
+
+// WaitMessage ждёт, пока в комнате появится сообщение бота, для которого match вернёт
+// true, и возвращает последнее такое сообщение. Через timeout тест завершается с ошибкой.
+func (s *Server) WaitMessage(t testing.TB, room string, timeout time.Duration, match func(Message) bool) Message {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		msgs := s.Messages(room)
+		for i := len(msgs) - 1; i >= 0; i-- {
+			if match(msgs[i]) {
+				return msgs[i]
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("за %s в комнате %s не появилось ожидаемого сообщения; сообщения: %s",
+				timeout, room, describe(msgs))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Syncs — сколько запросов /sync получил сервер; клиент, отправивший второй,
+// уже пропустил историю и ждёт новых событий
+func (s *Server) Syncs() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.syncs
+}
+
+// Fail заставляет следующий запрос endpoint ("sync", "send", "join", "whoami")
+// вернуть ошибку status с кодом errcode
+func (s *Server) Fail(endpoint string, status int, errcode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[endpoint] = append(s.failures[endpoint], apiError{Status: status, Code: errcode, Message: "matrixtest"})
+}
+
+// append добавляет событие в ленту; вызывается под s.mu
+func (s *Server) append(room, sender string, content map[string]any) string {
+	id := fmt.Sprintf("$%d", len(s.events)+1)
+	s.events = append(s.events, event{Room: room, Type: "m.room.message", EventID: id, Sender: sender, Content: content})
+	s.notify()
+	return id
+}
+
+// notify будит ожидающие /sync; вызывается под s.mu
+func (s *Server) notify() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+func describe(msgs []Message) string {
+	var b strings.Builder
+	for _, m := range msgs {
+		fmt.Fprintf(&b, "\n%s %q", m.EventID, m.Text)
+	}
+	if b.Len() == 0 {
+		return "нет"
+	}
+	return b.String()
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+Token {
+		writeJSON(w, http.StatusUnauthorized, apiError{Code: "M_UNKNOWN_TOKEN", Message: "Invalid access token"})
+		return
+	}
+	// Сегменты пути после /_matrix/client/v3/, раскодированные
+	rest, ok := strings.CutPrefix(r.URL.EscapedPath(), "/_matrix/client/v3/")
+	if !ok {
+		writeJSON(w, http.StatusNotFound, apiError{Code: "M_UNRECOGNIZED", Message: "Unrecognized request"})
+		return
+	}
+	var path []string
+	for _, seg := range strings.Split(rest, "/") {
+		p, err := url.PathUnescape(seg)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, apiError{Code: "M_INVALID_PARAM", Message: err.Error()})
+			return
+		}
+		path = append(path, p)
+	}
+
+	var endpoint string
+	switch {
+	case r.Method == http.MethodGet && len(path) == 2 && path[0] == "account" && path[1] == "whoami":
+		endpoint = "whoami"
+	case r.Method == http.MethodGet && len(path) == 1 && path[0] == "sync":
+		endpoint = "sync"
+	case r.Method == http.MethodPost && len(path) == 2 && path[0] == "join":
+		endpoint = "join"
+	case r.Method == http.MethodPut && len(path) == 5 && path[0] == "rooms" && path[2] == "send":
+		endpoint = "send"
+	default:
+		writeJSON(w, http.StatusNotFound, apiError{Code: "M_UNRECOGNIZED", Message: "Unrecognized request"})
+		return
+	}
+
+	s.mu.Lock()
+	if endpoint == "sync" {
+		s.syncs++
+	}
+	if queue := s.failures[endpoint]; len(queue) > 0 {
+		s.failures[endpoint] = queue[1:]
+		s.mu.Unlock()
+		writeJSON(w, queue[0].Status, queue[0])
+		return
+	}
+	s.mu.Unlock()
+
+	switch endpoint {
+	case "whoami":
+		writeJSON(w, http.StatusOK, map[string]string{"user_id": BotUserID})
+	case "sync":
+		s.sync(r.Context(), w, r.URL.Query())
+	case "join":
+		s.join(w, path[1])
+	case "send":
+		s.send(w, r, path[1], path[3], path[4])
+	}
+}
+
+// sync отдаёт события после since, ожидая их не дольше timeout миллисекунд
+func (s *Server) sync(ctx context.Context, w http.ResponseWriter, query url.Values) {
+	since, _ := strconv.Atoi(strings.TrimPrefix(query.Get("since"), "s"))
+	timeout, _ := strconv.Atoi(query.Get("timeout"))
+	timer := time.NewTimer(time.Duration(timeout) * time.Millisecond)
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		resp, pending := s.syncResponse(since, query.Get("since") == "")
+		wake := s.wake
+		s.mu.Unlock()
+
+		if pending {
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+		select {
+		case <-wake:
+			continue
+		case <-timer.C:
+		case <-ctx.Done():
+		case <-s.done:
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+}
+
+// syncResponse собирает ответ /sync; pending — в нём есть новые события или
+// приглашения. Вызывается под s.mu.
+func (s *Server) syncResponse(since int, initial bool) (map[string]any, bool) {
+	join := map[string]any{}
+	invite := map[string]any{}
+	pending := initial
+	for room := range s.invites {
+		invite[room] = map[string]any{"invite_state": map[string]any{"events": []any{}}}
+		pending = true
+	}
+	timelines := map[string][]event{}
+	for _, ev := range s.events[min(since, len(s.events)):] {
+		if s.joined[ev.Room] {
+			timelines[ev.Room] = append(timelines[ev.Room], ev)
+			pending = true
+		}
+	}
+	for room := range s.joined {
+		join[room] = map[string]any{
+			"summary":  map[string]any{"m.joined_member_count": s.members[room]},
+			"timeline": map[string]any{"events": append([]event{}, timelines[room]...)},
+		}
+	}
+	return map[string]any{
+		"next_batch": fmt.Sprintf("s%d", len(s.events)),
+		"rooms":      map[string]any{"join": join, "invite": invite},
+	}, pending
+}
+
+func (s *Server) join(w http.ResponseWriter, room string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.invites[room] && !s.joined[room] {
+		writeJSON(w, http.StatusForbidden, apiError{Code: "M_FORBIDDEN", Message: "You are not invited to this room."})
+		return
+	}
+	delete(s.invites, room)
+	s.joined[room] = true
+	writeJSON(w, http.StatusOK, map[string]string{"room_id": room})
+}
+
+// send добавляет в ленту событие бота; повтор с тем же txn возвращает то же событие
+func (s *Server) send(w http.ResponseWriter, r *http.Request, room, eventType, txn string) {
+	var content map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&content); err != nil || eventType != "m.room.message" {
+		writeJSON(w, http.StatusBadRequest, apiError{Code: "M_BAD_JSON", Message: "bad event"})
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.joined[room] {
+		writeJSON(w, http.StatusForbidden, apiError{Code: "M_FORBIDDEN", Message: "User not in room"})
+		return
+	}
+	id, ok := s.txns[txn]
+	if !ok {
+		id = s.append(room, BotUserID, content)
+		s.txns[txn] = id
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"event_id": id})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
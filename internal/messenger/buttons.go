@@ -0,0 +1,80 @@
+package messenger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ButtonNumbers нумерует кнопки для платформ, где кнопок нет, а есть только текст
+// (консоль, Matrix): кнопки печатаются как «[N] Текст», и ответ «#N» нажимает кнопку N.
+// Номера идут подряд, поэтому можно нажать и кнопку под старым сообщением.
+// Не потокобезопасен: вызывающий держит свою блокировку.
+type ButtonNumbers struct {
+	last     int
+	buttons  map[int]numberedButton
+	messages map[int][]int
+}
+
+type numberedButton struct {
+	messageID int
+	data      string
+}
+
+// Assign нумерует клавиатуру сообщения messageID и возвращает строки вида
+// «[1] Назад  [2] Отмена». Прежние номера кнопок этого сообщения перестают действовать.
+func (n *ButtonNumbers) Assign(messageID int, keyboard Keyboard) []string {
+	if n.buttons == nil {
+		n.buttons = map[int]numberedButton{}
+		n.messages = map[int][]int{}
+	}
+	for _, number := range n.messages[messageID] {
+		delete(n.buttons, number)
+	}
+	delete(n.messages, messageID)
+
+	var lines []string
+	for _, row := range keyboard {
+		labels := make([]string, 0, len(row))
+		for _, btn := range row {
+			n.last++
+			n.buttons[n.last] = numberedButton{messageID: messageID, data: btn.Data}
+			n.messages[messageID] = append(n.messages[messageID], n.last)
+			labels = append(labels, fmt.Sprintf("[%d] %s", n.last, btn.Text))
+		}
+		if len(labels) > 0 {
+			lines = append(lines, strings.Join(labels, "  "))
+		}
+	}
+	return lines
+}
+
+// Press разбирает ответ пользователя. isPress — текст имеет вид «#N» (а не, например,
+// хэштег); ok — кнопка N есть, тогда возвращаются её сообщение и данные.
+func (n *ButtonNumbers) Press(text string) (messageID int, data string, isPress, ok bool) {
+	rest, found := strings.CutPrefix(strings.TrimSpace(text), "#")
+	number, err := strconv.Atoi(rest)
+	if !found || err != nil {
+		return 0, "", false, false
+	}
+	btn, ok := n.buttons[number]
+	return btn.messageID, btn.data, true, ok
+}
+
+// SameKeyboard — клавиатуры совпадают кнопка в кнопку; nil и пустая равны
+func SameKeyboard(a, b Keyboard) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,131 @@
+// Package messenger — платформенно-независимое ядро переписки: апдейты, сообщения,
+// кнопки и интерфейс Messenger. Обработчики и notifier работают только с этими
+// типами, а адаптеры (Telegram, Matrix, консоль) переводят их в API своей платформы.
+package messenger
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Messenger — то, что бот делает с чатом: отправляет и редактирует сообщения,
+// отвечает на нажатия кнопок и регистрирует список команд.
+type Messenger interface {
+	// SendMessage отправляет сообщение с клавиатурой (nil — без неё) и возвращает его ID
+	SendMessage(chatID int64, text string, keyboard Keyboard) (int, error)
+	// EditMessage заменяет текст и клавиатуру сообщения; nil убирает клавиатуру.
+	// Правка, которая ничего не меняет, ошибкой не считается.
+	EditMessage(chatID int64, messageID int, text string, keyboard Keyboard) error
+	// AnswerCallback подтверждает нажатие кнопки; непустой text показывается пользователю
+	AnswerCallback(callbackID, text string) error
+	// SetCommands регистрирует меню команд бота, если платформа его поддерживает
+	SetCommands(commands []Command) error
+}
+
+// ErrForbidden — платформа запретила боту писать в чат: пользователь заблокировал бота,
+// бота удалили из группы или комнаты. Повторять отправку бесполезно; адаптеры
+// оборачивают в неё такие ошибки, проверять — через errors.Is.
+var ErrForbidden = errors.New("бот не может писать в этот чат")
+
+// Button — кнопка под сообщением; Data возвращается в Callback при нажатии
+type Button struct {
+	Text string
+	Data string
+}
+
+// Keyboard — кнопки под сообщением по строкам
+type Keyboard [][]Button
+
+// NewButton создаёт кнопку с данными data
+func NewButton(text, data string) Button {
+	return Button{Text: text, Data: data}
+}
+
+// NewRow собирает строку кнопок
+func NewRow(buttons ...Button) []Button {
+	return buttons
+}
+
+// NewKeyboard собирает клавиатуру из строк
+func NewKeyboard(rows ...[]Button) Keyboard {
+	return rows
+}
+
+// Command — пункт меню команд бота
+type Command struct {
+	Name        string
+	Description string
+}
+
+// Update — событие от пользователя: сообщение или нажатие кнопки
+type Update struct {
+	Message  *Message
+	Callback *Callback
+}
+
+// ChatID — чат, к которому относится апдейт; апдейты одного чата обрабатываются по порядку
+func (u Update) ChatID() int64 {
+	switch {
+	case u.Message != nil:
+		return u.Message.ChatID
+	case u.Callback != nil:
+		return u.Callback.ChatID
+	}
+	return 0
+}
+
+// Message — входящее сообщение пользователя
+type Message struct {
+	ID     int
+	ChatID int64
+	Text   string
+	// Private — личный чат с ботом: только там свободный текст создаёт событие
+	Private bool
+}
+
+// IsCommand — сообщение начинается с «/команды»
+func (m *Message) IsCommand() bool {
+	return len(m.Text) > 1 && m.Text[0] == '/' && m.Text[1] != ' '
+}
+
+// Command — имя команды без «/» и без «@имя_бота» (в группах Telegram команда
+// может быть адресована конкретному боту); пусто, если это не команда
+func (m *Message) Command() string {
+	if !m.IsCommand() {
+		return ""
+	}
+	command, _, _ := strings.Cut(m.Text[1:], " ")
+	command, _, _ = strings.Cut(command, "@")
+	return command
+}
+
+// CommandArguments — текст после команды
+func (m *Message) CommandArguments() string {
+	if !m.IsCommand() {
+		return ""
+	}
+	_, args, _ := strings.Cut(m.Text, " ")
+	return args
+}
+
+// Callback — нажатие кнопки под сообщением бота
+type Callback struct {
+	// ID передаётся в AnswerCallback
+	ID        string
+	ChatID    int64
+	MessageID int
+	// MessageText — текст сообщения с нажатой кнопкой
+	MessageText string
+	Data        string
+}
+
+// ChatDirectory сопоставляет чатам платформ со строковыми ID (комнаты Matrix)
+// числовые ID ядра. Соответствие хранится постоянно: по числовому ID notifier
+// отправляет напоминания и после перезапуска.
+type ChatDirectory interface {
+	// ChatID возвращает ID ядра для чата externalID платформы platform, заводя его при первом обращении
+	ChatID(ctx context.Context, platform, externalID string) (int64, error)
+	// ExternalChatID — обратное соответствие; ошибка, если такого чата нет
+	ExternalChatID(ctx context.Context, platform string, chatID int64) (string, error)
+}
@@ -0,0 +1,64 @@
+package messenger
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMessageCommand(t *testing.T) {
+	tests := []struct {
+		text, command, args string
+	}{
+		{"/list", "list", ""},
+		{"/add завтра 10:00 созвон", "add", "завтра 10:00 созвон"},
+		{"/add@CalVigilBot завтра", "add", "завтра"},
+		{"/ не команда", "", ""},
+		{"/", "", ""},
+		{"просто текст", "", ""},
+	}
+	for _, tt := range tests {
+		m := &Message{Text: tt.text}
+		if m.Command() != tt.command || m.CommandArguments() != tt.args || m.IsCommand() != (tt.command != "") {
+			t.Errorf("%q: команда %q, аргументы %q", tt.text, m.Command(), m.CommandArguments())
+		}
+	}
+}
+
+func TestButtonNumbers(t *testing.T) {
+	var n ButtonNumbers
+	lines := n.Assign(10, NewKeyboard(
+		NewRow(NewButton("Да", "ok:yes"), NewButton("Нет", "ok:no")),
+		NewRow(NewButton("Отмена", "wz:cancel")),
+	))
+	if want := []string{"[1] Да  [2] Нет", "[3] Отмена"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("строки: %q", lines)
+	}
+	n.Assign(11, NewKeyboard(NewRow(NewButton("Понятно", "ack"))))
+
+	if id, data, isPress, ok := n.Press(" #2 "); id != 10 || data != "ok:no" || !isPress || !ok {
+		t.Errorf("#2: %d %q %v %v", id, data, isPress, ok)
+	}
+	// Правка сообщения 10 перенумеровывает его кнопки, кнопки сообщения 11 остаются
+	n.Assign(10, nil)
+	if _, _, isPress, ok := n.Press("#2"); !isPress || ok {
+		t.Error("старый номер кнопки действует после правки")
+	}
+	if id, _, _, ok := n.Press("#4"); !ok || id != 11 {
+		t.Error("кнопка другого сообщения потерялась")
+	}
+	for _, text := range []string{"#созвон", "4", "# 4"} {
+		if _, _, isPress, _ := n.Press(text); isPress {
+			t.Errorf("%q принят за нажатие", text)
+		}
+	}
+}
+
+func TestSameKeyboard(t *testing.T) {
+	a := NewKeyboard(NewRow(NewButton("Да", "ok:yes")))
+	if !SameKeyboard(a, NewKeyboard(NewRow(NewButton("Да", "ok:yes")))) || !SameKeyboard(nil, Keyboard{}) {
+		t.Error("одинаковые клавиатуры различаются")
+	}
+	if SameKeyboard(a, NewKeyboard(NewRow(NewButton("Да", "ok:no")))) || SameKeyboard(a, nil) {
+		t.Error("разные клавиатуры совпали")
+	}
+}
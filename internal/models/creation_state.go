@@ -1,14 +1,36 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/natindo/CalVigil/internal/dialog"
+	"github.com/natindo/CalVigil/internal/recurrence"
+)
 
 // CreationState описывает пошаговое создание/редактирование события.
-// Может храниться в памяти, а при желании - в отдельной таблице в БД.
+// Хранится в БД (services.StateStore), поэтому диалог переживает перезапуск бота.
+// Шаги диалога объявлены в пакете bot, Cursor ведёт движок dialog.
 type CreationState struct {
-    Step          int
-    SelectedDate  time.Time
-    SelectedStart time.Time
-    Duration      time.Duration
-    NotifyBefore  int
-    Title         string
-}
\ No newline at end of file
+	Cursor        dialog.Cursor
+	SelectedDate  time.Time
+	SelectedStart time.Time
+	Duration      time.Duration
+	Reminders     []time.Duration // смещения напоминаний относительно начала
+	Recurrence    *recurrence.Rule
+	Nag           *NagPolicy
+	Title         string
+	MessageID     int            // сообщение мастера, которое редактируется на каждом шаге
+	Location      *time.Location // часовой пояс чата: в нём вводятся дата и время
+	CalendarMonth time.Time      // месяц, открытый в календаре; нулевой — месяц выбранной даты
+
+	// Заполняются при редактировании существующего события
+	EditEventID     int       // 0 — создание нового события
+	EditScope       string    // services.ScopeThis / ScopeFollowing / ScopeAll
+	OccurrenceStart time.Time // редактируемое повторение серии
+	EditField       string    // поле из карточки редактирования; пусто — мастер целиком
+}
+
+// DialogCursor реализует dialog.State
+func (s *CreationState) DialogCursor() *dialog.Cursor {
+	return &s.Cursor
+}
@@ -1,14 +1,170 @@
 package models
 
-import "time"
+import (
+	"sort"
+	"time"
 
-// Event хранит данные о событии в календаре
+	"github.com/natindo/CalVigil/internal/recurrence"
+)
+
+// Event хранит данные о событии в календаре.
+// Для повторяющегося события StartTime/EndTime задают первое повторение,
+// а Recurrence — правило, по которому строятся остальные.
 type Event struct {
-    ID           int
-    ChatID       int64
-    Title        string
-    StartTime    time.Time
-    EndTime      time.Time
-    NotifyBefore int
-    Notified     bool
-}
\ No newline at end of file
+	ID         int
+	ChatID     int64
+	Title      string
+	StartTime  time.Time
+	EndTime    time.Time
+	Reminders  []Reminder       // напоминания, у каждого своё состояние доставки
+	Recurrence *recurrence.Rule // nil — событие без повторений
+	Exceptions []EventException // отменённые и перенесённые повторения серии
+	Nag        *NagPolicy       // nil — каждое напоминание отправляется один раз
+
+	// OccurrenceStart — начало повторения по правилу (до переноса).
+	// Заполняется только у экземпляров, полученных из Occurrences.
+	OccurrenceStart time.Time
+}
+
+// NagPolicy — режим «напоминать, пока не подтвердят»: после каждого напоминания
+// оно повторяется раз в Interval, пока пользователь не нажмёт «Понятно», но не более MaxRepeats раз.
+type NagPolicy struct {
+	Interval   time.Duration
+	MaxRepeats int
+}
+
+// EventException описывает отмену или изменение одного повторения серии.
+type EventException struct {
+	OccurrenceStart time.Time // исходное начало повторения по правилу
+	Cancelled       bool
+	StartTime       time.Time // новое начало (если не отменено)
+	EndTime         time.Time // новое окончание (если не отменено)
+	Title           string    // новое название, пустое — как у серии
+}
+
+// ReminderOffsets возвращает смещения напоминаний события.
+func (e Event) ReminderOffsets() []time.Duration {
+	offsets := make([]time.Duration, 0, len(e.Reminders))
+	for _, r := range e.Reminders {
+		offsets = append(offsets, r.Offset)
+	}
+	return offsets
+}
+
+// IsRecurring сообщает, повторяется ли событие.
+func (e Event) IsRecurring() bool {
+	return e.Recurrence != nil
+}
+
+// OccurrenceKey — начало повторения, по которому различаются экземпляры серии
+// (доставка напоминаний, отложенные напоминания): для серии — исходное время по правилу
+// до переноса, для одиночного события — его начало.
+func (e Event) OccurrenceKey() time.Time {
+	if e.IsRecurring() {
+		return e.OccurrenceStart
+	}
+	return e.StartTime
+}
+
+// Occurrences разворачивает событие в отдельные экземпляры, начинающиеся в [from, to).
+// У каждого экземпляра тот же ID, а StartTime/EndTime сдвинуты на время повторения.
+// Отменённые повторения пропускаются, перенесённые попадают в выборку по новому времени.
+func (e Event) Occurrences(from, to time.Time) []Event {
+	if !e.IsRecurring() {
+		if !e.StartTime.Before(from) && e.StartTime.Before(to) {
+			return []Event{e}
+		}
+		return nil
+	}
+
+	duration := e.EndTime.Sub(e.StartTime)
+	var result []Event
+	for _, start := range e.Recurrence.Between(e.StartTime, from, to) {
+		if e.exceptionFor(start) != nil {
+			continue
+		}
+		occ := e
+		occ.StartTime = start
+		occ.EndTime = start.Add(duration)
+		occ.OccurrenceStart = start
+		result = append(result, occ)
+	}
+
+	for _, ex := range e.Exceptions {
+		if ex.Cancelled || ex.StartTime.Before(from) || !ex.StartTime.Before(to) {
+			continue
+		}
+		occ := e
+		occ.StartTime = ex.StartTime.In(e.StartTime.Location())
+		occ.EndTime = ex.EndTime.In(e.StartTime.Location())
+		occ.OccurrenceStart = ex.OccurrenceStart.In(e.StartTime.Location())
+		if ex.Title != "" {
+			occ.Title = ex.Title
+		}
+		result = append(result, occ)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].StartTime.Before(result[j].StartTime)
+	})
+	return result
+}
+
+// OccurrenceOn возвращает повторение серии (с учётом переносов), которое начинается
+// в тот же календарный день, что и day. Для одиночного события — само событие.
+func (e Event) OccurrenceOn(day time.Time) (Event, bool) {
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	occs := e.Occurrences(from, from.AddDate(0, 0, 1))
+	if len(occs) == 0 {
+		return Event{}, false
+	}
+	return occs[0], true
+}
+
+// NextOccurrence возвращает ближайшее повторение, которое начинается не раньше after.
+func (e Event) NextOccurrence(after time.Time) (Event, bool) {
+	if !e.IsRecurring() {
+		if e.StartTime.Before(after) {
+			return Event{}, false
+		}
+		return e, true
+	}
+	// Ищем расширяющимися окнами, чтобы не разворачивать всю серию
+	for window := 31 * 24 * time.Hour; window <= 10*366*24*time.Hour; window *= 4 {
+		if occs := e.Occurrences(after, after.Add(window)); len(occs) > 0 {
+			return occs[0], true
+		}
+	}
+	return Event{}, false
+}
+
+func (e Event) exceptionFor(occurrenceStart time.Time) *EventException {
+	for i := range e.Exceptions {
+		if e.Exceptions[i].OccurrenceStart.Equal(occurrenceStart) {
+			return &e.Exceptions[i]
+		}
+	}
+	return nil
+}
+
+// OccurrenceCancelled сообщает, отменено ли повторение серии с исходным началом occurrenceStart.
+func (e Event) OccurrenceCancelled(occurrenceStart time.Time) bool {
+	ex := e.exceptionFor(occurrenceStart)
+	return ex != nil && ex.Cancelled
+}
+
+// Occurrence возвращает повторение серии по его исходному началу с учётом переноса.
+// Отменено ли повторение, проверяет OccurrenceCancelled.
+func (e Event) Occurrence(occurrenceStart time.Time) Event {
+	occ := e
+	occ.OccurrenceStart = occurrenceStart
+	occ.StartTime = occurrenceStart
+	occ.EndTime = occurrenceStart.Add(e.EndTime.Sub(e.StartTime))
+	if ex := e.exceptionFor(occurrenceStart); ex != nil && !ex.Cancelled {
+		occ.StartTime, occ.EndTime = ex.StartTime, ex.EndTime
+		if ex.Title != "" {
+			occ.Title = ex.Title
+		}
+	}
+	return occ
+}
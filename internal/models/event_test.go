@@ -0,0 +1,99 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/recurrence"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skip("нет базы часовых поясов:", err)
+	}
+	return loc
+}
+
+func dailyAt9(t *testing.T, loc *time.Location) Event {
+	t.Helper()
+	rule, err := recurrence.Parse("FREQ=DAILY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, time.March, 28, 9, 0, 0, 0, loc)
+	return Event{ID: 1, Title: "стендап", StartTime: start, EndTime: start.Add(15 * time.Minute), Recurrence: rule}
+}
+
+func TestOccurrencesKeepLocalTimeAcrossDST(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	ev := dailyAt9(t, berlin)
+
+	from := time.Date(2025, time.March, 28, 0, 0, 0, 0, berlin)
+	occs := ev.Occurrences(from, from.AddDate(0, 0, 4))
+	if len(occs) != 4 {
+		t.Fatalf("got %d occurrences, want 4", len(occs))
+	}
+	for _, occ := range occs {
+		if occ.StartTime.Hour() != 9 || occ.StartTime.Minute() != 0 {
+			t.Errorf("occurrence %v: want 09:00 local", occ.StartTime)
+		}
+		if d := occ.EndTime.Sub(occ.StartTime); d != 15*time.Minute {
+			t.Errorf("occurrence %v: duration %v", occ.StartTime, d)
+		}
+	}
+	// До перевода часов 09:00 CET = 08:00 UTC, после — 09:00 CEST = 07:00 UTC
+	if h := occs[0].StartTime.UTC().Hour(); h != 8 {
+		t.Errorf("28 March: %d:00 UTC, want 8:00", h)
+	}
+	if h := occs[3].StartTime.UTC().Hour(); h != 7 {
+		t.Errorf("31 March: %d:00 UTC, want 7:00", h)
+	}
+}
+
+func TestOccurrencesFollowChatZone(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	moscow := mustLoad(t, "Europe/Moscow")
+
+	// Та же серия, прочитанная для чата в Москве (без перевода часов),
+	// повторяется в 11:00 по Москве и не сдвигается вслед за Берлином
+	ev := dailyAt9(t, berlin)
+	ev.StartTime = ev.StartTime.In(moscow)
+	ev.EndTime = ev.EndTime.In(moscow)
+
+	from := time.Date(2025, time.March, 28, 0, 0, 0, 0, moscow)
+	for _, occ := range ev.Occurrences(from, from.AddDate(0, 0, 4)) {
+		if occ.StartTime.Hour() != 11 {
+			t.Errorf("occurrence %v: want 11:00 Moscow", occ.StartTime)
+		}
+	}
+}
+
+func TestOccurrenceExceptionAcrossDST(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	ev := dailyAt9(t, berlin)
+
+	// Повторение в день перевода часов перенесено на 10:00, следующее отменено
+	moved := time.Date(2025, time.March, 30, 9, 0, 0, 0, berlin)
+	cancelled := time.Date(2025, time.March, 31, 9, 0, 0, 0, berlin)
+	newStart := time.Date(2025, time.March, 30, 10, 0, 0, 0, berlin)
+	ev.Exceptions = []EventException{
+		{OccurrenceStart: moved.UTC(), StartTime: newStart.UTC(), EndTime: newStart.Add(time.Hour).UTC()},
+		{OccurrenceStart: cancelled.UTC(), Cancelled: true},
+	}
+
+	day, _ := ev.OccurrenceOn(moved)
+	if !day.StartTime.Equal(newStart) || !day.OccurrenceStart.Equal(moved) {
+		t.Errorf("moved occurrence = %v (key %v), want %v", day.StartTime, day.OccurrenceStart, newStart)
+	}
+	if day.StartTime.Location() != berlin {
+		t.Errorf("moved occurrence location = %v, want Europe/Berlin", day.StartTime.Location())
+	}
+	if _, ok := ev.OccurrenceOn(cancelled); ok {
+		t.Errorf("cancelled occurrence is still returned")
+	}
+	if !ev.OccurrenceCancelled(cancelled) || ev.OccurrenceCancelled(moved) {
+		t.Errorf("OccurrenceCancelled: cancelled=%v, moved=%v", ev.OccurrenceCancelled(cancelled), ev.OccurrenceCancelled(moved))
+	}
+}
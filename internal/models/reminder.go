@@ -0,0 +1,34 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Reminder — одно напоминание о событии: за сколько до начала его отправить.
+type Reminder struct {
+	ID     int
+	Offset time.Duration
+}
+
+// FormatOffset возвращает смещение напоминания в виде «1 д 2 ч 10 мин».
+func FormatOffset(d time.Duration) string {
+	if d <= 0 {
+		return "0 мин"
+	}
+	mins := int(d.Round(time.Minute) / time.Minute)
+	var parts []string
+	if days := mins / (24 * 60); days > 0 {
+		parts = append(parts, fmt.Sprintf("%d д", days))
+		mins %= 24 * 60
+	}
+	if hours := mins / 60; hours > 0 {
+		parts = append(parts, fmt.Sprintf("%d ч", hours))
+		mins %= 60
+	}
+	if mins > 0 {
+		parts = append(parts, fmt.Sprintf("%d мин", mins))
+	}
+	return strings.Join(parts, " ")
+}
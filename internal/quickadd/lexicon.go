@@ -0,0 +1,100 @@
+package quickadd
+
+import "time"
+
+// Словари распознаваемых слов. Все формы хранятся в нижнем регистре, «ё» заменена на «е».
+
+// durationUnits — единицы длительности (после числа или слитно с ним: "45м", "1h30m")
+var durationUnits = map[string]time.Duration{
+	"м": time.Minute, "мин": time.Minute, "минута": time.Minute, "минуту": time.Minute,
+	"минуты": time.Minute, "минут": time.Minute,
+	"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+
+	"ч": time.Hour, "час": time.Hour, "часа": time.Hour, "часов": time.Hour,
+	"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour,
+
+	"д": day, "дн": day, "день": day, "дня": day, "дней": day,
+	"d": day, "day": day, "days": day,
+
+	"н": week, "нед": week, "неделя": week, "неделю": week, "недели": week, "недель": week,
+	"w": week, "wk": week, "week": week, "weeks": week,
+}
+
+// bareDurations — длительности, записанные одним словом без числа.
+// Распознаются только после предлогов ("через час", "на полчаса", "in an hour").
+var bareDurations = map[string]time.Duration{
+	"минуту": time.Minute, "minute": time.Minute,
+	"полчаса": 30 * time.Minute,
+	"час":     time.Hour, "hour": time.Hour,
+	"день": day, "сутки": day, "day": day,
+	"неделю": week, "week": week,
+}
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+)
+
+// weekdays — названия дней недели во всех формах, которые встречаются после «в»/«on»
+var weekdays = map[string]time.Weekday{
+	"понедельник": time.Monday, "пн": time.Monday, "monday": time.Monday, "mon": time.Monday,
+	"вторник": time.Tuesday, "вт": time.Tuesday, "tuesday": time.Tuesday, "tue": time.Tuesday,
+	"среду": time.Wednesday, "среда": time.Wednesday, "ср": time.Wednesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"четверг": time.Thursday, "чт": time.Thursday, "thursday": time.Thursday, "thu": time.Thursday,
+	"пятницу": time.Friday, "пятница": time.Friday, "пт": time.Friday, "friday": time.Friday, "fri": time.Friday,
+	"субботу": time.Saturday, "суббота": time.Saturday, "сб": time.Saturday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+	"воскресенье": time.Sunday, "вс": time.Sunday, "sunday": time.Sunday, "sun": time.Sunday,
+}
+
+// nextWords — «следующий» перед днём недели: день на следующей календарной неделе
+var nextWords = map[string]bool{
+	"следующий": true, "следующую": true, "следующее": true, "следующая": true, "next": true,
+}
+
+// months — названия месяцев в родительном падеже (ru) и в английском написании
+var months = map[string]time.Month{
+	"января": time.January, "january": time.January, "jan": time.January,
+	"февраля": time.February, "february": time.February, "feb": time.February,
+	"марта": time.March, "march": time.March, "mar": time.March,
+	"апреля": time.April, "april": time.April, "apr": time.April,
+	"мая": time.May, "may": time.May,
+	"июня": time.June, "june": time.June, "jun": time.June,
+	"июля": time.July, "july": time.July, "jul": time.July,
+	"августа": time.August, "august": time.August, "aug": time.August,
+	"сентября": time.September, "september": time.September, "sep": time.September, "sept": time.September,
+	"октября": time.October, "october": time.October, "oct": time.October,
+	"ноября": time.November, "november": time.November, "nov": time.November,
+	"декабря": time.December, "december": time.December, "dec": time.December,
+}
+
+// relativeDays — слова, задающие дату относительно сегодняшнего дня
+var relativeDays = map[string]int{
+	"сегодня": 0, "today": 0,
+	"завтра": 1, "tomorrow": 1,
+	"послезавтра": 2,
+}
+
+// dayPeriods — уточнения времени суток после часа: «в 7 вечера», «at 7 pm»
+var dayPeriods = map[string]string{
+	"утра": "am", "am": "am", "a.m.": "am",
+	"дня": "pm", "вечера": "pm", "pm": "pm", "p.m.": "pm",
+	"ночи": "night",
+}
+
+// Служебные слова
+var (
+	timePrefixes     = map[string]bool{"в": true, "во": true, "к": true, "at": true, "by": true}
+	weekdayPrefixes  = map[string]bool{"в": true, "во": true, "on": true}
+	relativePrefixes = map[string]bool{"через": true, "in": true}
+	durationPrefixes = map[string]bool{"на": true, "for": true}
+	remindWords      = map[string]bool{
+		"напомни": true, "напомнить": true, "напоминание": true, "напоминания": true,
+		"remind": true, "reminder": true, "reminders": true,
+	}
+	remindFillers  = map[string]bool{"мне": true, "me": true, "за": true}
+	remindSuffixes = map[string]bool{"до": true, "заранее": true, "before": true, "prior": true}
+	listSeparators = map[string]bool{"и": true, "and": true}
+	articles       = map[string]bool{"a": true, "an": true}
+)
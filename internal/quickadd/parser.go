@@ -0,0 +1,621 @@
+// Package quickadd разбирает описание события одной строкой на русском или английском:
+//
+//	завтра в 15:00 созвон с командой 45м напомни за 10м
+//	next monday at 9am standup 15 min remind 1h, 10m before
+//
+// Распознаются относительные и явные даты, время, длительность, напоминания
+// и «весь день»; всё остальное становится названием события.
+package quickadd
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDuration — длительность события, если она не указана
+const DefaultDuration = time.Hour
+
+var (
+	// ErrNoTitle — в строке не осталось слов для названия события
+	ErrNoTitle = errors.New("не указано название события")
+	// ErrNoDateTime — в строке нет ни даты, ни времени
+	ErrNoDateTime = errors.New("не удалось определить дату или время события")
+)
+
+// Result — разобранное событие
+type Result struct {
+	Title     string
+	Start     time.Time
+	Duration  time.Duration
+	AllDay    bool
+	Reminders []time.Duration // nil — напоминания не указаны; от большего к меньшему
+}
+
+var (
+	clockRe      = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+	isoDateRe    = regexp.MustCompile(`^(\d{4})-(\d{2})-(\d{2})$`)
+	dotDateRe    = regexp.MustCompile(`^(\d{1,2})\.(\d{1,2})(?:\.(\d{2,4}))?$`)
+	numberRe     = regexp.MustCompile(`^\d+(?:[.,]\d+)?$`)
+	durationPart = regexp.MustCompile(`(\d+(?:[.,]\d+)?)([a-zа-я]+)`)
+)
+
+// token — слово исходной строки: raw сохраняет регистр для названия,
+// norm используется для сопоставления со словарями
+type token struct {
+	raw  string
+	norm string
+}
+
+func tokenize(text string) []token {
+	var tokens []token
+	for _, f := range strings.Fields(text) {
+		// Запятая — самостоятельный разделитель (важно для списков напоминаний)
+		trailingComma := strings.HasSuffix(f, ",")
+		f = strings.TrimSuffix(f, ",")
+		if f != "" {
+			norm := strings.ToLower(strings.ReplaceAll(f, "ё", "е"))
+			norm = strings.ReplaceAll(norm, "Ё", "е")
+			norm = strings.Trim(norm, "!?;«»\"()")
+			norm = strings.TrimSuffix(norm, ".")
+			tokens = append(tokens, token{raw: f, norm: norm})
+		}
+		if trailingComma {
+			tokens = append(tokens, token{raw: ",", norm: ","})
+		}
+	}
+	return tokens
+}
+
+// parser хранит состояние разбора одной строки
+type parser struct {
+	tokens []token
+	used   []bool
+	now    time.Time
+
+	date        *time.Time     // выбранный день (полночь)
+	clock       *time.Duration // время суток от полуночи
+	absolute    *time.Time     // «через 2 часа» задаёт сразу дату и время
+	duration    *time.Duration
+	allDay      bool
+	reminders   []time.Duration
+	hasReminder bool
+}
+
+// Parse разбирает строку относительно момента now; даты и время трактуются в now.Location().
+func Parse(text string, now time.Time) (*Result, error) {
+	p := &parser{tokens: tokenize(text), now: now}
+	p.used = make([]bool, len(p.tokens))
+
+	matchers := []func(int) int{
+		p.matchReminders,
+		p.matchRelative,
+		p.matchAllDay,
+		p.matchRelativeDay,
+		p.matchWeekday,
+		p.matchExplicitDate,
+		p.matchClock,
+		p.matchDuration,
+	}
+	for i := 0; i < len(p.tokens); {
+		consumed := 0
+		for _, m := range matchers {
+			if consumed = m(i); consumed > 0 {
+				break
+			}
+		}
+		if consumed == 0 {
+			i++
+			continue
+		}
+		for j := i; j < i+consumed; j++ {
+			p.used[j] = true
+		}
+		i += consumed
+	}
+
+	return p.result()
+}
+
+func (p *parser) result() (*Result, error) {
+	res := &Result{Title: p.title()}
+	if res.Title == "" {
+		return nil, ErrNoTitle
+	}
+
+	loc := p.now.Location()
+	today := time.Date(p.now.Year(), p.now.Month(), p.now.Day(), 0, 0, 0, 0, loc)
+
+	switch {
+	case p.absolute != nil && !p.allDay:
+		res.Start = *p.absolute
+	case p.allDay || (p.date != nil && p.clock == nil):
+		day := today
+		if p.date != nil {
+			day = *p.date
+		} else if p.absolute != nil {
+			day = dayOf(*p.absolute)
+		}
+		res.Start = day
+		res.AllDay = true
+	case p.date != nil:
+		res.Start = atClock(*p.date, *p.clock)
+	case p.clock != nil:
+		// Только время: сегодня, а если оно уже прошло — завтра
+		res.Start = atClock(today, *p.clock)
+		if !res.Start.After(p.now) {
+			res.Start = atClock(today.AddDate(0, 0, 1), *p.clock)
+		}
+	default:
+		return nil, ErrNoDateTime
+	}
+
+	switch {
+	case res.AllDay:
+		res.Duration = day
+		if p.duration != nil && *p.duration >= day {
+			res.Duration = *p.duration
+		}
+	case p.duration != nil:
+		res.Duration = *p.duration
+	default:
+		res.Duration = DefaultDuration
+	}
+
+	if p.hasReminder {
+		res.Reminders = dedupeDesc(p.reminders)
+	}
+	return res, nil
+}
+
+// title собирает название из нераспознанных слов
+func (p *parser) title() string {
+	var words []string
+	for i, t := range p.tokens {
+		if p.used[i] || t.norm == "," {
+			continue
+		}
+		words = append(words, t.raw)
+	}
+	title := strings.Join(words, " ")
+	return strings.Trim(title, " ,.;:-—")
+}
+
+func (p *parser) norm(i int) string {
+	if i < 0 || i >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[i].norm
+}
+
+// -------------------------------------------------------------------
+// Напоминания: «напомни за 1ч и 10м», «за 10 минут», «remind me 1h, 10m before»
+// -------------------------------------------------------------------
+
+func (p *parser) matchReminders(i int) int {
+	j := i
+	switch {
+	case remindWords[p.norm(j)]:
+		j++
+		for remindFillers[p.norm(j)] {
+			j++
+		}
+	case p.norm(j) == "за":
+		j++
+	default:
+		return 0
+	}
+
+	var offsets []time.Duration
+	for {
+		d, n := p.durationAt(j, true)
+		if n == 0 {
+			break
+		}
+		offsets = append(offsets, d)
+		j += n
+		if sep := p.norm(j); sep == "," || listSeparators[sep] {
+			if _, next := p.durationAt(j+1, true); next > 0 {
+				j++
+				continue
+			}
+		}
+		break
+	}
+	if len(offsets) == 0 {
+		return 0
+	}
+	if remindSuffixes[p.norm(j)] {
+		j++
+	}
+
+	p.reminders = append(p.reminders, offsets...)
+	p.hasReminder = true
+	return j - i
+}
+
+// -------------------------------------------------------------------
+// Относительное время: «через 3 дня», «через 2 часа», «in 2 weeks», «через полчаса»
+// -------------------------------------------------------------------
+
+func (p *parser) matchRelative(i int) int {
+	if !relativePrefixes[p.norm(i)] {
+		return 0
+	}
+	d, n := p.durationAt(i+1, true)
+	if n == 0 {
+		return 0
+	}
+
+	if d%day == 0 {
+		// Целые дни и недели сдвигают только дату, время задаётся отдельно
+		date := dayOf(p.now).AddDate(0, 0, int(d/day))
+		p.date = &date
+	} else {
+		at := p.now.Add(d).Truncate(time.Minute)
+		p.absolute = &at
+	}
+	return n + 1
+}
+
+// -------------------------------------------------------------------
+// Даты
+// -------------------------------------------------------------------
+
+func (p *parser) matchAllDay(i int) int {
+	a, b := p.norm(i), p.norm(i+1)
+	if (a == "весь" || a == "целый") && b == "день" {
+		p.allDay = true
+		return 2
+	}
+	if a == "all" && b == "day" {
+		p.allDay = true
+		return 2
+	}
+	if a == "all-day" || a == "allday" {
+		p.allDay = true
+		return 1
+	}
+	return 0
+}
+
+func (p *parser) matchRelativeDay(i int) int {
+	if p.norm(i) == "day" && p.norm(i+1) == "after" && p.norm(i+2) == "tomorrow" {
+		p.setDate(dayOf(p.now).AddDate(0, 0, 2))
+		return 3
+	}
+	offset, ok := relativeDays[p.norm(i)]
+	if !ok {
+		return 0
+	}
+	p.setDate(dayOf(p.now).AddDate(0, 0, offset))
+	return 1
+}
+
+// matchWeekday распознаёт «в пятницу», «во вторник», «в следующий понедельник»,
+// «on friday», «next monday». Без «следующий» выбирается ближайший такой день после
+// сегодняшнего, со «следующий» — такой день на следующей календарной неделе.
+func (p *parser) matchWeekday(i int) int {
+	j := i
+	if weekdayPrefixes[p.norm(j)] {
+		j++
+	}
+	next := false
+	if nextWords[p.norm(j)] {
+		next = true
+		j++
+	}
+	wd, ok := weekdays[p.norm(j)]
+	if !ok {
+		return 0
+	}
+
+	today := dayOf(p.now)
+	var date time.Time
+	if next {
+		// Понедельник следующей недели + смещение до нужного дня
+		toMonday := (8 - int(today.Weekday())) % 7
+		if toMonday == 0 {
+			toMonday = 7
+		}
+		monday := today.AddDate(0, 0, toMonday)
+		date = monday.AddDate(0, 0, (int(wd)+6)%7)
+	} else {
+		ahead := (int(wd) - int(today.Weekday()) + 7) % 7
+		if ahead == 0 {
+			ahead = 7
+		}
+		date = today.AddDate(0, 0, ahead)
+	}
+	p.setDate(date)
+	return j - i + 1
+}
+
+// matchExplicitDate распознаёт 2025-01-31, 31.01, 31.01.2025, «31 января», «jan 31»
+func (p *parser) matchExplicitDate(i int) int {
+	loc := p.now.Location()
+	s := p.norm(i)
+
+	if m := isoDateRe.FindStringSubmatch(s); m != nil {
+		y, _ := strconv.Atoi(m[1])
+		mo, _ := strconv.Atoi(m[2])
+		d, _ := strconv.Atoi(m[3])
+		if date, ok := validDate(y, mo, d, loc); ok {
+			p.setDate(date)
+			return 1
+		}
+		return 0
+	}
+
+	if m := dotDateRe.FindStringSubmatch(s); m != nil {
+		d, _ := strconv.Atoi(m[1])
+		mo, _ := strconv.Atoi(m[2])
+		if m[3] == "" {
+			if date, ok := p.upcomingDate(time.Month(mo), d); ok {
+				p.setDate(date)
+				return 1
+			}
+			return 0
+		}
+		y, _ := strconv.Atoi(m[3])
+		if y < 100 {
+			y += 2000
+		}
+		if date, ok := validDate(y, mo, d, loc); ok {
+			p.setDate(date)
+			return 1
+		}
+		return 0
+	}
+
+	// «31 января» / «31 jan»
+	if d, err := strconv.Atoi(s); err == nil {
+		if mo, ok := months[p.norm(i+1)]; ok {
+			if date, ok := p.upcomingDate(mo, d); ok {
+				p.setDate(date)
+				return 2
+			}
+		}
+		return 0
+	}
+	// «jan 31»
+	if mo, ok := months[s]; ok {
+		if d, err := strconv.Atoi(p.norm(i + 1)); err == nil {
+			if date, ok := p.upcomingDate(mo, d); ok {
+				p.setDate(date)
+				return 2
+			}
+		}
+	}
+	return 0
+}
+
+// upcomingDate — ближайшая дата с указанными днём и месяцем, не раньше сегодняшней
+func (p *parser) upcomingDate(mo time.Month, d int) (time.Time, bool) {
+	loc := p.now.Location()
+	date, ok := validDate(p.now.Year(), int(mo), d, loc)
+	if !ok {
+		return time.Time{}, false
+	}
+	if date.Before(dayOf(p.now)) {
+		return validDate(p.now.Year()+1, int(mo), d, loc)
+	}
+	return date, true
+}
+
+func (p *parser) setDate(date time.Time) {
+	p.date = &date
+}
+
+// -------------------------------------------------------------------
+// Время: «в 15:00», «в 15», «at 3pm», «3:30 pm», «в 7 вечера», «в полдень»
+// -------------------------------------------------------------------
+
+func (p *parser) matchClock(i int) int {
+	j := i
+	prefixed := false
+	if timePrefixes[p.norm(j)] {
+		prefixed = true
+		j++
+	}
+
+	switch p.norm(j) {
+	case "полдень", "noon":
+		p.setClock(12, 0)
+		return j - i + 1
+	case "полночь", "midnight":
+		p.setClock(0, 0)
+		return j - i + 1
+	}
+
+	m := clockRe.FindStringSubmatch(p.norm(j))
+	if m == nil {
+		return 0
+	}
+	hour, _ := strconv.Atoi(m[1])
+	minute := 0
+	if m[2] != "" {
+		minute, _ = strconv.Atoi(m[2])
+	}
+	period := m[3]
+	consumed := j - i + 1
+	if period == "" {
+		if pp, ok := dayPeriods[p.norm(j+1)]; ok {
+			period = pp
+			consumed++
+		}
+	}
+
+	// Голое число без двоеточия — время только с предлогом или уточнением («в 15», «3 pm»)
+	if m[2] == "" && m[3] == "" && !prefixed && consumed == j-i+1 {
+		return 0
+	}
+	// «в 15» перед единицей длительности — это не время («в 15 минутах»)
+	if m[2] == "" && period == "" {
+		if _, isUnit := durationUnits[p.norm(j+1)]; isUnit {
+			return 0
+		}
+		if _, isMonth := months[p.norm(j+1)]; isMonth {
+			return 0
+		}
+	}
+
+	switch period {
+	case "am":
+		if hour == 12 {
+			hour = 0
+		}
+	case "pm":
+		if hour < 12 {
+			hour += 12
+		}
+	case "night":
+		if hour == 12 {
+			hour = 0
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return 0
+	}
+	p.setClock(hour, minute)
+	return consumed
+}
+
+func (p *parser) setClock(hour, minute int) {
+	c := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute
+	p.clock = &c
+}
+
+// -------------------------------------------------------------------
+// Длительность: «45м», «1ч30м», «на 2 часа», «на полчаса», «for 45 min»
+// -------------------------------------------------------------------
+
+func (p *parser) matchDuration(i int) int {
+	j := i
+	prefixed := false
+	if durationPrefixes[p.norm(j)] {
+		prefixed = true
+		j++
+	}
+	d, n := p.durationAt(j, prefixed)
+	if n == 0 {
+		return 0
+	}
+	p.duration = &d
+	return j - i + n
+}
+
+// durationAt разбирает длительность, начинающуюся с i-го слова:
+// слитную ("45м", "1h30m"), число + единицу ("45 минут", "1.5 hours")
+// или, если allowBare, одно слово ("час", "полчаса", "an hour").
+// Возвращает длительность и число занятых слов.
+func (p *parser) durationAt(i int, allowBare bool) (time.Duration, int) {
+	s := p.norm(i)
+	if s == "" {
+		return 0, 0
+	}
+
+	if d, ok := compactDuration(s); ok {
+		return d, 1
+	}
+
+	if numberRe.MatchString(s) {
+		if unit, ok := durationUnits[p.norm(i+1)]; ok {
+			return scale(s, unit), 2
+		}
+		return 0, 0
+	}
+
+	if !allowBare {
+		return 0, 0
+	}
+	if articles[s] {
+		if p.norm(i+1) == "half" && articles[p.norm(i+2)] && p.norm(i+3) == "hour" {
+			return 30 * time.Minute, 4
+		}
+		if d, ok := bareDurations[p.norm(i+1)]; ok {
+			return d, 2
+		}
+		return 0, 0
+	}
+	if s == "half" && articles[p.norm(i+1)] && p.norm(i+2) == "hour" {
+		return 30 * time.Minute, 3
+	}
+	if d, ok := bareDurations[s]; ok {
+		return d, 1
+	}
+	return 0, 0
+}
+
+// compactDuration разбирает слитную запись вида "45м", "1ч30м", "1.5h"
+func compactDuration(s string) (time.Duration, bool) {
+	parts := durationPart.FindAllStringSubmatchIndex(s, -1)
+	if len(parts) == 0 {
+		return 0, false
+	}
+	var total time.Duration
+	pos := 0
+	for _, m := range parts {
+		if m[0] != pos {
+			return 0, false
+		}
+		unit, ok := durationUnits[s[m[4]:m[5]]]
+		if !ok {
+			return 0, false
+		}
+		total += scale(s[m[2]:m[3]], unit)
+		pos = m[1]
+	}
+	if pos != len(s) || total <= 0 {
+		return 0, false
+	}
+	return total, true
+}
+
+// scale умножает единицу на число (допускается дробная часть: "1.5", "1,5")
+func scale(number string, unit time.Duration) time.Duration {
+	f, err := strconv.ParseFloat(strings.Replace(number, ",", ".", 1), 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(f * float64(unit)).Round(time.Minute)
+}
+
+// -------------------------------------------------------------------
+// Вспомогательные функции
+// -------------------------------------------------------------------
+
+func dayOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// atClock — момент времени в день day (полночь) со временем суток clock.
+// Использует time.Date, поэтому корректно работает в дни перехода на летнее время.
+func atClock(day time.Time, clock time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(),
+		int(clock/time.Hour), int(clock%time.Hour/time.Minute), 0, 0, day.Location())
+}
+
+func validDate(y, mo, d int, loc *time.Location) (time.Time, bool) {
+	date := time.Date(y, time.Month(mo), d, 0, 0, 0, 0, loc)
+	if date.Year() != y || int(date.Month()) != mo || date.Day() != d {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+func dedupeDesc(ds []time.Duration) []time.Duration {
+	seen := make(map[time.Duration]bool)
+	result := make([]time.Duration, 0, len(ds))
+	for _, d := range ds {
+		if !seen[d] {
+			seen[d] = true
+			result = append(result, d)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] > result[j] })
+	return result
+}
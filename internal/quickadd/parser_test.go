@@ -0,0 +1,178 @@
+package quickadd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var msk = time.FixedZone("MSK", 3*60*60)
+
+// now — среда, 15 января 2025, 10:30
+var now = time.Date(2025, time.January, 15, 10, 30, 0, 0, msk)
+
+func at(y int, m time.Month, d, hh, mm int) time.Time {
+	return time.Date(y, m, d, hh, mm, 0, 0, msk)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in        string
+		title     string
+		start     time.Time
+		duration  time.Duration
+		allDay    bool
+		reminders []time.Duration
+	}{
+		// Пример из описания команды
+		{"завтра в 15:00 созвон с командой 45м", "созвон с командой", at(2025, 1, 16, 15, 0), 45 * time.Minute, false, nil},
+
+		// Относительные дни
+		{"сегодня в 18:00 спортзал", "спортзал", at(2025, 1, 15, 18, 0), time.Hour, false, nil},
+		{"послезавтра в 9 планёрка", "планёрка", at(2025, 1, 17, 9, 0), time.Hour, false, nil},
+		{"Tomorrow at 3pm dentist", "dentist", at(2025, 1, 16, 15, 0), time.Hour, false, nil},
+		{"day after tomorrow at 9am standup", "standup", at(2025, 1, 17, 9, 0), time.Hour, false, nil},
+
+		// Дни недели: ближайший после сегодняшнего и на следующей неделе
+		{"в пятницу в 19:00 кино", "кино", at(2025, 1, 17, 19, 0), time.Hour, false, nil},
+		{"во вторник в 10 ретро", "ретро", at(2025, 1, 21, 10, 0), time.Hour, false, nil},
+		{"в среду в 12:00 обед", "обед", at(2025, 1, 22, 12, 0), time.Hour, false, nil},
+		{"в следующую пятницу в 19:00 бар", "бар", at(2025, 1, 24, 19, 0), time.Hour, false, nil},
+		{"next monday 9:00 sprint planning", "sprint planning", at(2025, 1, 20, 9, 0), time.Hour, false, nil},
+		{"on friday at noon lunch", "lunch", at(2025, 1, 17, 12, 0), time.Hour, false, nil},
+
+		// Явные даты
+		{"2025-02-03 14:00 отчёт", "отчёт", at(2025, 2, 3, 14, 0), time.Hour, false, nil},
+		{"20.01 в 11:00 встреча", "встреча", at(2025, 1, 20, 11, 0), time.Hour, false, nil},
+		{"10.01 в 11:00 встреча", "встреча", at(2026, 1, 10, 11, 0), time.Hour, false, nil},
+		{"01.03.2025 в 8 утра поезд", "поезд", at(2025, 3, 1, 8, 0), time.Hour, false, nil},
+		{"8 марта в 7 вечера ужин", "ужин", at(2025, 3, 8, 19, 0), time.Hour, false, nil},
+		{"feb 14 at 8pm dinner", "dinner", at(2025, 2, 14, 20, 0), time.Hour, false, nil},
+
+		// Время без даты: сегодня, если ещё не прошло, иначе завтра
+		{"в 15:00 созвон", "созвон", at(2025, 1, 15, 15, 0), time.Hour, false, nil},
+		{"в 9:00 зарядка", "зарядка", at(2025, 1, 16, 9, 0), time.Hour, false, nil},
+		{"в 10:30 стендап", "стендап", at(2025, 1, 16, 10, 30), time.Hour, false, nil},
+		{"в полдень обед", "обед", at(2025, 1, 15, 12, 0), time.Hour, false, nil},
+		{"в 2 дня звонок", "звонок", at(2025, 1, 15, 14, 0), time.Hour, false, nil},
+		{"в 12 ночи сон", "сон", at(2025, 1, 16, 0, 0), time.Hour, false, nil},
+		{"at 12am backup", "backup", at(2025, 1, 16, 0, 0), time.Hour, false, nil},
+		{"at 12pm lunch", "lunch", at(2025, 1, 15, 12, 0), time.Hour, false, nil},
+
+		// Относительное время
+		{"через 2 часа позвонить маме", "позвонить маме", at(2025, 1, 15, 12, 30), time.Hour, false, nil},
+		{"через полчаса чай", "чай", at(2025, 1, 15, 11, 0), time.Hour, false, nil},
+		{"in an hour call Bob", "call Bob", at(2025, 1, 15, 11, 30), time.Hour, false, nil},
+		{"in 45 min review", "review", at(2025, 1, 15, 11, 15), time.Hour, false, nil},
+		{"через 3 дня в 10:00 врач", "врач", at(2025, 1, 18, 10, 0), time.Hour, false, nil},
+		{"через неделю в 9 отчёт", "отчёт", at(2025, 1, 22, 9, 0), time.Hour, false, nil},
+
+		// Длительность
+		{"завтра в 10 тренировка 1ч30м", "тренировка", at(2025, 1, 16, 10, 0), 90 * time.Minute, false, nil},
+		{"завтра в 10 тренировка на 2 часа", "тренировка", at(2025, 1, 16, 10, 0), 2 * time.Hour, false, nil},
+		{"завтра в 10 тренировка на полчаса", "тренировка", at(2025, 1, 16, 10, 0), 30 * time.Minute, false, nil},
+		{"завтра в 10 тренировка 45 минут", "тренировка", at(2025, 1, 16, 10, 0), 45 * time.Minute, false, nil},
+		{"tomorrow 10:00 workshop for 1.5 hours", "workshop", at(2025, 1, 16, 10, 0), 90 * time.Minute, false, nil},
+		{"tomorrow 10:00 sync 15m", "sync", at(2025, 1, 16, 10, 0), 15 * time.Minute, false, nil},
+
+		// Весь день
+		{"завтра день рождения Пети", "день рождения Пети", at(2025, 1, 16, 0, 0), 24 * time.Hour, true, nil},
+		{"в субботу весь день дача", "дача", at(2025, 1, 18, 0, 0), 24 * time.Hour, true, nil},
+		{"all day offsite", "offsite", at(2025, 1, 15, 0, 0), 24 * time.Hour, true, nil},
+		{"31 декабря новый год на 2 дня", "новый год", at(2025, 12, 31, 0, 0), 48 * time.Hour, true, nil},
+
+		// Напоминания
+		{"завтра в 15:00 созвон напомни за 10м", "созвон", at(2025, 1, 16, 15, 0), time.Hour, false,
+			[]time.Duration{10 * time.Minute}},
+		{"завтра в 15:00 созвон напомни мне за 1ч и 10 минут", "созвон", at(2025, 1, 16, 15, 0), time.Hour, false,
+			[]time.Duration{time.Hour, 10 * time.Minute}},
+		{"завтра в 15:00 созвон за 15м", "созвон", at(2025, 1, 16, 15, 0), time.Hour, false,
+			[]time.Duration{15 * time.Minute}},
+		{"завтра в 15:00 созвон напомнить за день, за час", "созвон", at(2025, 1, 16, 15, 0), time.Hour, false,
+			[]time.Duration{24 * time.Hour, time.Hour}},
+		{"friday 9am demo remind me 1d, 1h and 10m before", "demo", at(2025, 1, 17, 9, 0), time.Hour, false,
+			[]time.Duration{24 * time.Hour, time.Hour, 10 * time.Minute}},
+		{"завтра в 15 созвон 30м напомни за 10м и 10м", "созвон", at(2025, 1, 16, 15, 0), 30 * time.Minute, false,
+			[]time.Duration{10 * time.Minute}},
+
+		// Числа в названии не принимаются за время
+		{"завтра в 18:00 встреча 5 человек", "встреча 5 человек", at(2025, 1, 16, 18, 0), time.Hour, false, nil},
+		{"завтра созвон по проекту X", "созвон по проекту X", at(2025, 1, 16, 0, 0), 24 * time.Hour, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			res, err := Parse(tt.in, now)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if res.Title != tt.title {
+				t.Errorf("Title = %q, want %q", res.Title, tt.title)
+			}
+			if !res.Start.Equal(tt.start) {
+				t.Errorf("Start = %v, want %v", res.Start, tt.start)
+			}
+			if res.Duration != tt.duration {
+				t.Errorf("Duration = %v, want %v", res.Duration, tt.duration)
+			}
+			if res.AllDay != tt.allDay {
+				t.Errorf("AllDay = %v, want %v", res.AllDay, tt.allDay)
+			}
+			if !reflect.DeepEqual(res.Reminders, tt.reminders) {
+				t.Errorf("Reminders = %v, want %v", res.Reminders, tt.reminders)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		err error
+	}{
+		{"", ErrNoTitle},
+		{"завтра в 15:00", ErrNoTitle},
+		{"завтра в 15:00 45м напомни за 10м", ErrNoTitle},
+		{"созвон с командой", ErrNoDateTime},
+		{"купить молоко 2 литра", ErrNoDateTime},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			_, err := Parse(tt.in, now)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseInvalidDates(t *testing.T) {
+	// Несуществующие даты остаются в названии, а не превращаются в соседние дни
+	for _, in := range []string{"31.02 в 10 встреча", "2025-13-01 в 10 встреча"} {
+		res, err := Parse(in, now)
+		if err != nil {
+			t.Fatalf("%q: Parse: %v", in, err)
+		}
+		if res.Start.Day() == 3 || res.Start.Month() != time.January {
+			t.Errorf("%q: Start = %v, invalid date must be ignored", in, res.Start)
+		}
+	}
+}
+
+func TestParseDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("нет базы часовых поясов:", err)
+	}
+	// 30 марта 2025 в Берлине переводят часы; завтра в 9 — это 09:00 по местному времени
+	before := time.Date(2025, time.March, 29, 12, 0, 0, 0, berlin)
+	res, err := Parse("завтра в 9 бег", before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2025, time.March, 30, 9, 0, 0, 0, berlin)
+	if !res.Start.Equal(want) {
+		t.Errorf("Start = %v, want %v", res.Start, want)
+	}
+}
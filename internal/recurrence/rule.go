@@ -0,0 +1,405 @@
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency — частота повторения (FREQ в терминах RFC 5545).
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// maxPeriods ограничивает перебор периодов, чтобы «бесконечное» правило
+// не зациклило сервис.
+const maxPeriods = 100000
+
+// WeekdayNum — элемент BYDAY: день недели с необязательным порядковым номером.
+// N == 0 означает «каждый такой день», N > 0 — N-й с начала периода,
+// N < 0 — N-й с конца (например, -1FR — последняя пятница месяца).
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+// Rule описывает правило повторения события (подмножество RRULE).
+type Rule struct {
+	Freq     Frequency
+	Interval int          // шаг повторения, по умолчанию 1
+	ByDay    []WeekdayNum // BYDAY
+	Count    int          // COUNT, 0 — без ограничения
+	Until    time.Time    // UNTIL, нулевое значение — без ограничения
+}
+
+var weekdayCodes = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+var weekdayNames = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Parse разбирает строку вида "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=10".
+// Префикс "RRULE:" допускается.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(strings.ToUpper(s), "RRULE:")
+	if s == "" {
+		return nil, errors.New("пустое правило повторения")
+	}
+
+	r := &Rule{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("некорректная часть правила %q", part)
+		}
+		switch key {
+		case "FREQ":
+			switch f := Frequency(value); f {
+			case Daily, Weekly, Monthly, Yearly:
+				r.Freq = f
+			default:
+				return nil, fmt.Errorf("неподдерживаемая частота %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("некорректный INTERVAL %q", value)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("некорректный COUNT %q", value)
+			}
+			r.Count = n
+		case "UNTIL":
+			t, err := parseUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			r.Until = t
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				wd, err := parseWeekdayNum(code)
+				if err != nil {
+					return nil, err
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "WKST":
+			// Неделя всегда начинается с понедельника, другие значения не поддерживаем
+			if value != "MO" {
+				return nil, fmt.Errorf("неподдерживаемый WKST %q", value)
+			}
+		default:
+			return nil, fmt.Errorf("неподдерживаемый параметр %q", key)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, errors.New("в правиле не указан FREQ")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, errors.New("COUNT и UNTIL нельзя указывать одновременно")
+	}
+	for _, wd := range r.ByDay {
+		if wd.N != 0 && r.Freq != Monthly && r.Freq != Yearly {
+			return nil, errors.New("порядковый BYDAY допустим только для MONTHLY и YEARLY")
+		}
+	}
+	return r, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				// Дата без времени — включаем весь день
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("некорректный UNTIL %q", value)
+}
+
+func parseWeekdayNum(code string) (WeekdayNum, error) {
+	code = strings.TrimSpace(code)
+	if len(code) < 2 {
+		return WeekdayNum{}, fmt.Errorf("некорректный BYDAY %q", code)
+	}
+	day, ok := weekdayCodes[code[len(code)-2:]]
+	if !ok {
+		return WeekdayNum{}, fmt.Errorf("некорректный день недели %q", code)
+	}
+	wd := WeekdayNum{Day: day}
+	if prefix := code[:len(code)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n > 53 || n < -53 {
+			return WeekdayNum{}, fmt.Errorf("некорректный номер дня %q", code)
+		}
+		wd.N = n
+	}
+	return wd, nil
+}
+
+// String возвращает правило в формате RRULE (без префикса "RRULE:").
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		codes := make([]string, 0, len(r.ByDay))
+		for _, wd := range r.ByDay {
+			code := weekdayNames[wd.Day]
+			if wd.N != 0 {
+				code = strconv.Itoa(wd.N) + code
+			}
+			codes = append(codes, code)
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Between возвращает начала повторений с from <= t < to.
+// dtstart — начало первого повторения; время суток и часовой пояс берутся из него,
+// поэтому переходы на летнее/зимнее время не сдвигают «часы на стене».
+func (r *Rule) Between(dtstart, from, to time.Time) []time.Time {
+	var result []time.Time
+	r.iterate(dtstart, to, func(t time.Time) {
+		if !t.Before(from) {
+			result = append(result, t)
+		}
+	})
+	return result
+}
+
+// Last возвращает момент, позже которого повторений нет: начало последнего повторения
+// для правила с COUNT, UNTIL — для правила с UNTIL. ok = false, если правило бесконечно.
+func (r *Rule) Last(dtstart time.Time) (last time.Time, ok bool) {
+	switch {
+	case !r.Until.IsZero():
+		return r.Until, true
+	case r.Count > 0:
+		last = dtstart
+		r.iterate(dtstart, time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC), func(t time.Time) {
+			last = t
+		})
+		return last, true
+	}
+	return time.Time{}, false
+}
+
+// iterate перебирает повторения по порядку, пока они начинаются раньше to.
+func (r *Rule) iterate(dtstart, to time.Time, fn func(time.Time)) {
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+	emitted := 0
+	for i := 0; i < maxPeriods; i++ {
+		periodStart, candidates := r.period(dtstart, i*interval)
+		if !periodStart.Before(to) {
+			return
+		}
+		for _, t := range candidates {
+			if t.Before(dtstart) {
+				continue
+			}
+			if !r.Until.IsZero() && t.After(r.Until) {
+				return
+			}
+			if !t.Before(to) {
+				return
+			}
+			fn(t)
+			emitted++
+			if r.Count > 0 && emitted >= r.Count {
+				return
+			}
+		}
+	}
+}
+
+// period возвращает начало n-го периода (в днях/неделях/месяцах/годах от dtstart)
+// и отсортированный список кандидатов-повторений внутри него.
+func (r *Rule) period(dtstart time.Time, n int) (time.Time, []time.Time) {
+	loc := dtstart.Location()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, loc)
+	}
+	y, m, d := dtstart.Date()
+
+	var periodStart time.Time
+	var days []time.Time // даты кандидатов (полночь)
+
+	switch r.Freq {
+	case Daily:
+		day := time.Date(y, m, d+n, 0, 0, 0, 0, loc)
+		periodStart = day
+		if r.matchesWeekday(day.Weekday()) {
+			days = append(days, day)
+		}
+
+	case Weekly:
+		// Понедельник недели, в которую попадает dtstart
+		offset := (int(dtstart.Weekday()) + 6) % 7
+		monday := time.Date(y, m, d-offset+7*n, 0, 0, 0, 0, loc)
+		periodStart = monday
+		if len(r.ByDay) == 0 {
+			days = append(days, monday.AddDate(0, 0, offset))
+			break
+		}
+		for i := 0; i < 7; i++ {
+			day := monday.AddDate(0, 0, i)
+			if r.matchesWeekday(day.Weekday()) {
+				days = append(days, day)
+			}
+		}
+
+	case Monthly:
+		first := time.Date(y, m+time.Month(n), 1, 0, 0, 0, 0, loc)
+		periodStart = first
+		last := first.AddDate(0, 1, -1)
+		if len(r.ByDay) == 0 {
+			// Если в месяце нет такого числа (31-е), повторение пропускается
+			if d <= last.Day() {
+				days = append(days, time.Date(first.Year(), first.Month(), d, 0, 0, 0, 0, loc))
+			}
+			break
+		}
+		days = expandByDay(r.ByDay, first, last)
+
+	case Yearly:
+		first := time.Date(y+n, time.January, 1, 0, 0, 0, 0, loc)
+		periodStart = first
+		if len(r.ByDay) == 0 {
+			day := time.Date(y+n, m, d, 0, 0, 0, 0, loc)
+			// 29 февраля в невисокосный год пропускается
+			if day.Month() == m {
+				days = append(days, day)
+			}
+			break
+		}
+		days = expandByDay(r.ByDay, first, time.Date(y+n, time.December, 31, 0, 0, 0, 0, loc))
+	}
+
+	result := make([]time.Time, 0, len(days))
+	for _, day := range days {
+		result = append(result, at(day.Year(), day.Month(), day.Day()))
+	}
+	return periodStart, result
+}
+
+func (r *Rule) matchesWeekday(wd time.Weekday) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, b := range r.ByDay {
+		if b.Day == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// expandByDay возвращает даты в диапазоне [first, last], подходящие под BYDAY.
+func expandByDay(byDay []WeekdayNum, first, last time.Time) []time.Time {
+	seen := make(map[time.Time]bool)
+	var days []time.Time
+	add := func(t time.Time) {
+		if !seen[t] {
+			seen[t] = true
+			days = append(days, t)
+		}
+	}
+
+	for _, b := range byDay {
+		var matches []time.Time
+		for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+			if day.Weekday() == b.Day {
+				matches = append(matches, day)
+			}
+		}
+		switch {
+		case b.N == 0:
+			for _, t := range matches {
+				add(t)
+			}
+		case b.N > 0 && b.N <= len(matches):
+			add(matches[b.N-1])
+		case b.N < 0 && -b.N <= len(matches):
+			add(matches[len(matches)+b.N])
+		}
+	}
+
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days
+}
+
+var weekdayShortRu = [...]string{"вс", "пн", "вт", "ср", "чт", "пт", "сб"}
+
+// Describe возвращает краткое описание правила по-русски для сообщений бота.
+func (r *Rule) Describe() string {
+	var sb strings.Builder
+	unit := map[Frequency]string{Daily: "дн.", Weekly: "нед.", Monthly: "мес.", Yearly: "г."}[r.Freq]
+	if r.Interval > 1 {
+		sb.WriteString(fmt.Sprintf("раз в %d %s", r.Interval, unit))
+	} else {
+		sb.WriteString(map[Frequency]string{
+			Daily:   "каждый день",
+			Weekly:  "каждую неделю",
+			Monthly: "каждый месяц",
+			Yearly:  "каждый год",
+		}[r.Freq])
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, 0, len(r.ByDay))
+		for _, wd := range r.ByDay {
+			name := weekdayShortRu[wd.Day]
+			switch {
+			case wd.N == -1:
+				name = "последн. " + name
+			case wd.N > 0:
+				name = fmt.Sprintf("%d-й %s", wd.N, name)
+			case wd.N < 0:
+				name = fmt.Sprintf("%d-й с конца %s", -wd.N, name)
+			}
+			days = append(days, name)
+		}
+		sb.WriteString(": " + strings.Join(days, ", "))
+	}
+	if r.Count > 0 {
+		sb.WriteString(fmt.Sprintf(", %d раз", r.Count))
+	}
+	if !r.Until.IsZero() {
+		sb.WriteString(", до " + r.Until.Format("2006-01-02"))
+	}
+	return sb.String()
+}
@@ -0,0 +1,204 @@
+package recurrence
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skip("нет базы часовых поясов:", err)
+	}
+	return loc
+}
+
+// format записывает повторения местным временем, чтобы сравнивать их строкой
+func format(times []time.Time) string {
+	s := make([]string, 0, len(times))
+	for _, t := range times {
+		s = append(s, t.Format("2006-01-02 15:04"))
+	}
+	return strings.Join(s, ", ")
+}
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		dtstart time.Time
+		want    string
+	}{
+		{"DAILY с шагом", "FREQ=DAILY;INTERVAL=2;COUNT=3",
+			time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC),
+			"2025-01-01 09:00, 2025-01-03 09:00, 2025-01-05 09:00"},
+		{"DAILY по будням", "FREQ=DAILY;BYDAY=MO,WE,FR;COUNT=4",
+			time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC),
+			"2025-01-01 09:00, 2025-01-03 09:00, 2025-01-06 09:00, 2025-01-08 09:00"},
+		{"WEEKLY по дню начала", "FREQ=WEEKLY;COUNT=3",
+			time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC),
+			"2025-01-01 09:00, 2025-01-08 09:00, 2025-01-15 09:00"},
+		{"WEEKLY с BYDAY", "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4",
+			time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC),
+			"2025-01-01 09:00, 2025-01-06 09:00, 2025-01-08 09:00, 2025-01-13 09:00"},
+		{"WEEKLY раз в две недели", "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH;COUNT=4",
+			time.Date(2025, 1, 7, 18, 0, 0, 0, time.UTC),
+			"2025-01-07 18:00, 2025-01-09 18:00, 2025-01-21 18:00, 2025-01-23 18:00"},
+		{"MONTHLY 31-го пропускает короткие месяцы", "FREQ=MONTHLY;COUNT=4",
+			time.Date(2025, 1, 31, 10, 0, 0, 0, time.UTC),
+			"2025-01-31 10:00, 2025-03-31 10:00, 2025-05-31 10:00, 2025-07-31 10:00"},
+		{"MONTHLY последняя пятница", "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3",
+			time.Date(2025, 1, 31, 17, 0, 0, 0, time.UTC),
+			"2025-01-31 17:00, 2025-02-28 17:00, 2025-03-28 17:00"},
+		{"MONTHLY второй понедельник", "FREQ=MONTHLY;BYDAY=2MO;COUNT=3",
+			time.Date(2025, 1, 13, 10, 0, 0, 0, time.UTC),
+			"2025-01-13 10:00, 2025-02-10 10:00, 2025-03-10 10:00"},
+		{"YEARLY 29 февраля", "FREQ=YEARLY;COUNT=2",
+			time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC),
+			"2024-02-29 12:00, 2028-02-29 12:00"},
+		{"YEARLY первый понедельник года", "FREQ=YEARLY;BYDAY=1MO;COUNT=2",
+			time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC),
+			"2025-01-06 09:00, 2026-01-05 09:00"},
+		{"UNTIL включает последнее повторение", "FREQ=DAILY;UNTIL=20250103T090000Z",
+			time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC),
+			"2025-01-01 09:00, 2025-01-02 09:00, 2025-01-03 09:00"},
+		{"UNTIL датой включает весь день", "FREQ=DAILY;UNTIL=20250102",
+			time.Date(2025, 1, 1, 23, 0, 0, 0, time.UTC),
+			"2025-01-01 23:00, 2025-01-02 23:00"},
+		{"COUNT считает только повторения после начала", "FREQ=WEEKLY;BYDAY=MO,FR;COUNT=2",
+			time.Date(2025, 1, 8, 9, 0, 0, 0, time.UTC),
+			"2025-01-10 09:00, 2025-01-13 09:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := rule.Between(tt.dtstart, tt.dtstart, tt.dtstart.AddDate(10, 0, 0))
+			if format(got) != tt.want {
+				t.Errorf("%s:\n got %s\nwant %s", tt.rule, format(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestBetweenWindow(t *testing.T) {
+	rule, err := Parse("FREQ=DAILY;COUNT=5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dtstart := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+	// from включается, to — нет; COUNT отсчитывается от начала серии, а не окна
+	got := rule.Between(dtstart, time.Date(2025, 1, 3, 9, 0, 0, 0, time.UTC), time.Date(2025, 1, 10, 9, 0, 0, 0, time.UTC))
+	if want := "2025-01-03 09:00, 2025-01-04 09:00, 2025-01-05 09:00"; format(got) != want {
+		t.Errorf("got %s, want %s", format(got), want)
+	}
+	if got := rule.Between(dtstart, dtstart, dtstart); len(got) != 0 {
+		t.Errorf("пустое окно: %s", format(got))
+	}
+}
+
+func TestBetweenAcrossDST(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	tests := []struct {
+		name    string
+		rule    string
+		dtstart time.Time
+		want    string
+	}{
+		// 30 марта 2025 часы переводятся вперёд, 26 октября — назад
+		{"DAILY через переход на летнее время", "FREQ=DAILY;COUNT=3",
+			time.Date(2025, 3, 29, 9, 30, 0, 0, berlin),
+			"2025-03-29 09:30, 2025-03-30 09:30, 2025-03-31 09:30"},
+		{"WEEKLY через переход на зимнее время", "FREQ=WEEKLY;BYDAY=SU;COUNT=2",
+			time.Date(2025, 10, 19, 9, 0, 0, 0, berlin),
+			"2025-10-19 09:00, 2025-10-26 09:00"},
+		{"несуществующее время сдвигается только в день перехода", "FREQ=DAILY;COUNT=3",
+			time.Date(2025, 3, 29, 2, 30, 0, 0, berlin),
+			"2025-03-29 02:30, 2025-03-30 03:30, 2025-03-31 02:30"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := rule.Between(tt.dtstart, tt.dtstart, tt.dtstart.AddDate(1, 0, 0))
+			if format(got) != tt.want {
+				t.Errorf("%s:\n got %s\nwant %s", tt.rule, format(got), tt.want)
+			}
+			for _, occ := range got {
+				if occ.Location() != berlin {
+					t.Errorf("повторение %v не в поясе серии", occ)
+				}
+			}
+		})
+	}
+
+	// Между повторениями через переход проходит 23 и 25 часов, а не 24
+	rule, _ := Parse("FREQ=DAILY;COUNT=2")
+	spring := rule.Between(time.Date(2025, 3, 29, 9, 0, 0, 0, berlin), time.Time{}, time.Date(2026, 1, 1, 0, 0, 0, 0, berlin))
+	autumn := rule.Between(time.Date(2025, 10, 25, 9, 0, 0, 0, berlin), time.Time{}, time.Date(2026, 1, 1, 0, 0, 0, 0, berlin))
+	if len(spring) != 2 || spring[1].Sub(spring[0]) != 23*time.Hour ||
+		len(autumn) != 2 || autumn[1].Sub(autumn[0]) != 25*time.Hour {
+		t.Errorf("весна: %s, осень: %s", format(spring), format(autumn))
+	}
+}
+
+func TestLast(t *testing.T) {
+	dtstart := time.Date(2025, 1, 31, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		rule string
+		want string // пусто — серия бесконечна
+	}{
+		{"FREQ=MONTHLY;COUNT=3", "2025-05-31 10:00"},
+		{"FREQ=DAILY;UNTIL=20250205T100000Z", "2025-02-05 10:00"},
+		{"FREQ=WEEKLY", ""},
+	}
+	for _, tt := range tests {
+		rule, err := Parse(tt.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		last, ok := rule.Last(dtstart)
+		if got := format([]time.Time{last}); ok != (tt.want != "") || ok && got != tt.want {
+			t.Errorf("%s: Last = %s, %v; want %q", tt.rule, got, ok, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=10",
+		"FREQ=MONTHLY;BYDAY=-1FR;UNTIL=20251231T210000Z",
+		"FREQ=YEARLY",
+	} {
+		rule, err := Parse("RRULE:" + strings.ToLower(s))
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if rule.String() != s {
+			t.Errorf("String() = %s, want %s", rule.String(), s)
+		}
+	}
+
+	for _, s := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;COUNT=3;UNTIL=20250101",
+		"FREQ=WEEKLY;BYDAY=2MO",
+		"FREQ=MONTHLY;BYDAY=XX",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;WKST=SU",
+		"FREQ=DAILY;BYMONTH=1",
+	} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("%q: ошибка не обнаружена", s)
+		}
+	}
+}
@@ -2,106 +2,573 @@ package services
 
 import (
 	"context"
+	"errors"
+	"sort"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 
 	"github.com/natindo/CalVigil/internal/models"
+	"github.com/natindo/CalVigil/internal/recurrence"
 )
 
-// InsertEvent вставляет новое событие в БД и возвращает его ID
-func InsertEvent(conn *pgx.Conn, ev models.Event) (int, error) {
-    var newID int
-    err := conn.QueryRow(context.Background(), `
-INSERT INTO events (chat_id, title, start_time, end_time, notify_before, notified)
-VALUES ($1, $2, $3, $4, $5, $6)
+// eventColumns — общий список колонок для выборок событий (см. scanEvent).
+// Последняя колонка — часовой пояс чата: время события переводится в него при чтении.
+const eventColumns = `id, chat_id, title, start_time, end_time, rrule, nag_interval_minutes, nag_max,
+    (SELECT timezone FROM chat_settings s WHERE s.chat_id = events.chat_id)`
+
+// eventColumnsE — те же колонки с префиксом e. для запросов с JOIN
+const eventColumnsE = `e.id, e.chat_id, e.title, e.start_time, e.end_time, e.rrule, e.nag_interval_minutes, e.nag_max,
+    (SELECT timezone FROM chat_settings s WHERE s.chat_id = e.chat_id)`
+
+// querier — общее подмножество методов *pgxpool.Pool и pgx.Tx
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// eventRow — буфер для сканирования колонок eventColumns.
+// Позволяет дописать колонки события к другим колонкам в запросах с JOIN.
+type eventRow struct {
+	e           models.Event
+	rrule       *string
+	nagInterval *int
+	nagMax      int
+	timezone    *string
+}
+
+func (r *eventRow) targets() []any {
+	return []any{
+		&r.e.ID,
+		&r.e.ChatID,
+		&r.e.Title,
+		&r.e.StartTime,
+		&r.e.EndTime,
+		&r.rrule,
+		&r.nagInterval,
+		&r.nagMax,
+		&r.timezone,
+	}
+}
+
+// event собирает models.Event из отсканированных значений.
+// Время переводится в пояс чата, чтобы повторения разворачивались по его местному времени.
+func (r *eventRow) event() (models.Event, error) {
+	e := r.e
+	loc := locationOrDefault(r.timezone)
+	e.StartTime = e.StartTime.In(loc)
+	e.EndTime = e.EndTime.In(loc)
+	if r.rrule != nil {
+		rule, err := recurrence.Parse(*r.rrule)
+		if err != nil {
+			return e, err
+		}
+		e.Recurrence = rule
+	}
+	if r.nagInterval != nil && r.nagMax > 0 {
+		e.Nag = &models.NagPolicy{
+			Interval:   time.Duration(*r.nagInterval) * time.Minute,
+			MaxRepeats: r.nagMax,
+		}
+	}
+	return e, nil
+}
+
+// scanEvent читает строку с колонками eventColumns
+func scanEvent(row pgx.Row) (models.Event, error) {
+	var r eventRow
+	if err := row.Scan(r.targets()...); err != nil {
+		return r.e, err
+	}
+	return r.event()
+}
+
+// nagValues возвращает значения колонок nag_interval_minutes и nag_max
+func nagValues(nag *models.NagPolicy) (*int, int) {
+	if nag == nil {
+		return nil, 0
+	}
+	mins := int(nag.Interval / time.Minute)
+	return &mins, nag.MaxRepeats
+}
+
+func scanEvents(rows pgx.Rows) ([]models.Event, error) {
+	defer rows.Close()
+
+	var result []models.Event
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, e)
+	}
+	return result, rows.Err()
+}
+
+// rruleValue возвращает значение для колонки rrule (NULL для одиночных событий)
+func rruleValue(r *recurrence.Rule) *string {
+	if r == nil {
+		return nil
+	}
+	s := r.String()
+	return &s
+}
+
+// seriesEndValue возвращает значение для колонки series_end: позже него у серии нет
+// повторений по правилу (NULL для бесконечной серии и одиночного события)
+func seriesEndValue(ev models.Event) *time.Time {
+	if !ev.IsRecurring() {
+		return nil
+	}
+	if last, ok := ev.Recurrence.Last(ev.StartTime); ok {
+		return &last
+	}
+	return nil
+}
+
+// InsertEvent вставляет новое событие вместе с напоминаниями в БД и возвращает его ID
+func (repo *PgRepository) InsertEvent(ctx context.Context, ev models.Event) (int, error) {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := repo.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	newID, err := insertEvent(ctx, tx, ev)
+	if err != nil {
+		return 0, err
+	}
+	if err := announceChanges(ctx, tx); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	repo.wakeNotifiers()
+	return newID, nil
+}
+
+// insertEvent вставляет событие и его напоминания; вызывается внутри транзакции
+func insertEvent(ctx context.Context, q querier, ev models.Event) (int, error) {
+	var newID int
+	nagInterval, nagMax := nagValues(ev.Nag)
+	err := q.QueryRow(ctx, `
+INSERT INTO events (chat_id, title, start_time, end_time, rrule, series_end, nag_interval_minutes, nag_max)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 RETURNING id
-`, ev.ChatID, ev.Title, ev.StartTime, ev.EndTime, ev.NotifyBefore, ev.Notified).Scan(&newID)
-    if err != nil {
-        return 0, err
-    }
-    return newID, nil
+`, ev.ChatID, ev.Title, ev.StartTime, ev.EndTime, rruleValue(ev.Recurrence), seriesEndValue(ev), nagInterval, nagMax).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, r := range ev.Reminders {
+		_, err := q.Exec(ctx, `
+INSERT INTO event_reminders (event_id, offset_minutes)
+VALUES ($1, $2)
+ON CONFLICT (event_id, offset_minutes) DO NOTHING
+`, newID, int(r.Offset/time.Minute))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return newID, nil
 }
 
 // DeleteEvent удаляет событие по ID (только если chat_id совпадает)
-func DeleteEvent(conn *pgx.Conn, chatID int64, eventID int) error {
-    _, err := conn.Exec(context.Background(), `
+func (repo *PgRepository) DeleteEvent(ctx context.Context, chatID int64, eventID int) error {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	_, err := repo.pool.Exec(ctx, `
 DELETE FROM events
 WHERE chat_id = $1 AND id = $2
 `, chatID, eventID)
-    return err
+	return err
+}
+
+// UpdateEvent изменяет событие на месте, не меняя его ID: apply получает текущее
+// состояние события (вместе с напоминаниями) и правит нужные поля. Чтение и запись
+// выполняются в одной транзакции под блокировкой строки.
+//
+// Если меняется время начала, состояние уведомлений сбрасывается: доставки напоминаний,
+// ещё не сработавшие отложенные напоминания и повторы «пока не подтвердят».
+// Исключения серии (отмены и переносы) сдвигаются вместе с повторениями (shiftExceptions).
+// Напоминания с неизменным смещением сохраняют свою историю доставки.
+func (repo *PgRepository) UpdateEvent(ctx context.Context, chatID int64, eventID int, apply func(ev *models.Event)) (*models.Event, error) {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := repo.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	old, err := lockSeries(ctx, tx, chatID, eventID)
+	if err != nil {
+		return nil, err
+	}
+	events := []models.Event{old}
+	if err := attachReminders(ctx, tx, events); err != nil {
+		return nil, err
+	}
+	old = events[0]
+
+	ev := old
+	ev.Reminders = append([]models.Reminder(nil), old.Reminders...)
+	apply(&ev)
+
+	nagInterval, nagMax := nagValues(ev.Nag)
+	_, err = tx.Exec(ctx, `
+UPDATE events
+SET title = $2, start_time = $3, end_time = $4, rrule = $5, series_end = $6, nag_interval_minutes = $7, nag_max = $8
+WHERE id = $1
+`, eventID, ev.Title, ev.StartTime, ev.EndTime, rruleValue(ev.Recurrence), seriesEndValue(ev), nagInterval, nagMax)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syncReminders(ctx, tx, eventID, ev.ReminderOffsets()); err != nil {
+		return nil, err
+	}
+
+	if !ev.StartTime.Equal(old.StartTime) {
+		if err := resetNotifications(ctx, tx, eventID); err != nil {
+			return nil, err
+		}
+		if err := shiftExceptions(ctx, tx, old, ev); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := announceChanges(ctx, tx); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	repo.wakeNotifiers()
+	return repo.GetEventByID(ctx, chatID, eventID)
+}
+
+// syncReminders приводит напоминания события к списку смещений:
+// лишние удаляются (вместе с историей доставки), недостающие добавляются.
+func syncReminders(ctx context.Context, q querier, eventID int, offsets []time.Duration) error {
+	mins := make([]int, 0, len(offsets))
+	for _, o := range offsets {
+		mins = append(mins, int(o/time.Minute))
+	}
+
+	_, err := q.Exec(ctx, `
+DELETE FROM event_reminders
+WHERE event_id = $1 AND NOT (offset_minutes = ANY($2))
+`, eventID, mins)
+	if err != nil {
+		return err
+	}
+	for _, m := range mins {
+		_, err := q.Exec(ctx, `
+INSERT INTO event_reminders (event_id, offset_minutes)
+VALUES ($1, $2)
+ON CONFLICT (event_id, offset_minutes) DO NOTHING
+`, eventID, m)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resetNotifications забывает, о каких повторениях события уже напоминали,
+// чтобы напоминания пришли заново к новому времени.
+func resetNotifications(ctx context.Context, q querier, eventID int) error {
+	queries := []string{
+		`DELETE FROM reminder_deliveries
+WHERE reminder_id IN (SELECT id FROM event_reminders WHERE event_id = $1)`,
+		`DELETE FROM snoozes WHERE event_id = $1 AND sent_at IS NULL`,
+		`DELETE FROM nag_states WHERE event_id = $1`,
+	}
+	for _, sql := range queries {
+		if _, err := q.Exec(ctx, sql, eventID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shiftExceptions переносит исключения серии old на повторения изменённой серии ev:
+// повторение, которое было в день D в старое время, теперь в день D+сдвиг дат
+// в новое время суток, поэтому отменённое повторение остаётся отменённым, а перенесённое —
+// перенесённым. Сдвиг считается по местному времени, как и сами повторения.
+// Исключения, которым в новой серии не соответствует ни одно повторение, удаляются.
+// Время переноса (start_time, end_time) задано пользователем явно и не меняется.
+func shiftExceptions(ctx context.Context, q querier, old, ev models.Event) error {
+	if !old.IsRecurring() {
+		return nil
+	}
+	events := []models.Event{old}
+	if err := attachExceptions(ctx, q, events); err != nil {
+		return err
+	}
+	exceptions := events[0].Exceptions
+	if len(exceptions) == 0 {
+		return nil
+	}
+
+	// Ключи меняются все сразу, поэтому исключения пересоздаются: иначе новый ключ
+	// одного мог бы совпасть со старым ключом другого
+	if _, err := q.Exec(ctx, `DELETE FROM event_exceptions WHERE event_id = $1`, old.ID); err != nil {
+		return err
+	}
+	if ev.Recurrence == nil {
+		return nil
+	}
+	for _, ex := range exceptions {
+		key := shiftOccurrence(ex.OccurrenceStart, old.StartTime, ev.StartTime)
+		if occs := ev.Recurrence.Between(ev.StartTime, key, key.Add(time.Second)); len(occs) == 0 || !occs[0].Equal(key) {
+			continue
+		}
+
+		var start, end *time.Time
+		var title *string
+		if !ex.Cancelled && !ex.StartTime.IsZero() {
+			start, end = &ex.StartTime, &ex.EndTime
+		}
+		if ex.Title != "" {
+			title = &ex.Title
+		}
+		_, err := q.Exec(ctx, `
+INSERT INTO event_exceptions (event_id, occurrence_start, cancelled, start_time, end_time, title)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (event_id, occurrence_start) DO NOTHING
+`, old.ID, key, ex.Cancelled, start, end, title)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shiftOccurrence — начало повторения occ после переноса начала серии с oldStart
+// на newStart: дата сдвигается на столько же дней, время суток становится новым.
+// Всё считается по местному времени серии (пояс oldStart).
+func shiftOccurrence(occ, oldStart, newStart time.Time) time.Time {
+	loc := oldStart.Location()
+	newStart = newStart.In(loc)
+	oy, om, od := oldStart.Date()
+	ny, nm, nd := newStart.Date()
+	days := int(time.Date(ny, nm, nd, 0, 0, 0, 0, time.UTC).Sub(time.Date(oy, om, od, 0, 0, 0, 0, time.UTC)) / (24 * time.Hour))
+
+	y, m, d := occ.In(loc).Date()
+	return time.Date(y, m, d+days, newStart.Hour(), newStart.Minute(), newStart.Second(), 0, loc)
 }
 
 // GetEventByID возвращает событие, если оно принадлежит chatID
-func GetEventByID(conn *pgx.Conn, chatID int64, eventID int) (*models.Event, error) {
-    row := conn.QueryRow(context.Background(), `
-SELECT id, chat_id, title, start_time, end_time, notify_before, notified
+func (repo *PgRepository) GetEventByID(ctx context.Context, chatID int64, eventID int) (*models.Event, error) {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	row := repo.pool.QueryRow(ctx, `
+SELECT `+eventColumns+`
 FROM events
 WHERE chat_id = $1 AND id = $2
 `, chatID, eventID)
 
-    var e models.Event
-    err := row.Scan(
-        &e.ID,
-        &e.ChatID,
-        &e.Title,
-        &e.StartTime,
-        &e.EndTime,
-        &e.NotifyBefore,
-        &e.Notified,
-    )
-    if err != nil {
-        if err.Error() == "no rows in result set" {
-            return nil, nil
-        }
-        return nil, err
-    }
-    return &e, nil
-}
-
-// GetEventsForToday возвращает события, которые начинаются в течение текущих суток
-func GetEventsForToday(conn *pgx.Conn, chatID int64, now time.Time) ([]models.Event, error) {
-    startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-    endOfDay := startOfDay.Add(24 * time.Hour)
-
-    rows, err := conn.Query(context.Background(), `
-SELECT id, chat_id, title, start_time, end_time, notify_before, notified
+	e, err := scanEvent(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	events := []models.Event{e}
+	if err := attachExceptions(ctx, repo.pool, events); err != nil {
+		return nil, err
+	}
+	if err := attachReminders(ctx, repo.pool, events); err != nil {
+		return nil, err
+	}
+	return &events[0], nil
+}
+
+// attachReminders загружает напоминания для событий
+func attachReminders(ctx context.Context, q querier, events []models.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	byID := make(map[int][]*models.Event)
+	ids := make([]int, 0, len(events))
+	for i := range events {
+		if _, ok := byID[events[i].ID]; !ok {
+			ids = append(ids, events[i].ID)
+		}
+		byID[events[i].ID] = append(byID[events[i].ID], &events[i])
+	}
+
+	rows, err := q.Query(ctx, `
+SELECT id, event_id, offset_minutes
+FROM event_reminders
+WHERE event_id = ANY($1)
+ORDER BY offset_minutes DESC
+`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.Reminder
+		var eventID, mins int
+		if err := rows.Scan(&r.ID, &eventID, &mins); err != nil {
+			return err
+		}
+		r.Offset = time.Duration(mins) * time.Minute
+		for _, ev := range byID[eventID] {
+			ev.Reminders = append(ev.Reminders, r)
+		}
+	}
+	return rows.Err()
+}
+
+// attachExceptions загружает исключения (отмены и переносы) для повторяющихся событий
+func attachExceptions(ctx context.Context, q querier, events []models.Event) error {
+	byID := make(map[int]*models.Event)
+	var ids []int
+	for i := range events {
+		if events[i].IsRecurring() {
+			byID[events[i].ID] = &events[i]
+			ids = append(ids, events[i].ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := q.Query(ctx, `
+SELECT event_id, occurrence_start, cancelled, start_time, end_time, title
+FROM event_exceptions
+WHERE event_id = ANY($1)
+ORDER BY occurrence_start
+`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var eventID int
+		var ex models.EventException
+		var start, end *time.Time
+		var title *string
+		if err := rows.Scan(&eventID, &ex.OccurrenceStart, &ex.Cancelled, &start, &end, &title); err != nil {
+			return err
+		}
+		ev := byID[eventID]
+		loc := ev.StartTime.Location()
+		ex.OccurrenceStart = ex.OccurrenceStart.In(loc)
+		if start != nil && end != nil {
+			ex.StartTime, ex.EndTime = start.In(loc), end.In(loc)
+		}
+		if title != nil {
+			ex.Title = *title
+		}
+		ev.Exceptions = append(ev.Exceptions, ex)
+	}
+	return rows.Err()
+}
+
+// GetEventsForToday возвращает события, которые идут в течение текущих суток
+// (в том числе начавшиеся накануне и переходящие через полночь).
+// Границы суток считаются в поясе now — передавайте время в поясе чата.
+// Повторяющиеся события разворачиваются: каждое сегодняшнее повторение — отдельный элемент.
+func (repo *PgRepository) GetEventsForToday(ctx context.Context, chatID int64, now time.Time) ([]models.Event, error) {
+	startOfDay, endOfDay := DayBounds(now)
+	return repo.GetEventsInRange(ctx, chatID, startOfDay, endOfDay)
+}
+
+// GetEventsInRange возвращает события и повторения серий, пересекающиеся с [from, to):
+// начавшиеся раньше from, но ещё идущие к его моменту, тоже попадают в выборку.
+// Результат отсортирован по началу.
+func (repo *PgRepository) GetEventsInRange(ctx context.Context, chatID int64, from, to time.Time) ([]models.Event, error) {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := repo.pool.Query(ctx, `
+SELECT `+eventColumns+`
 FROM events
 WHERE chat_id = $1
-  AND start_time >= $2
-  AND start_time <  $3
+  AND (
+        (rrule IS NULL AND start_time < $3 AND (end_time > $2 OR start_time >= $2))
+     OR (rrule IS NOT NULL AND start_time < $3
+         AND (series_end IS NULL OR series_end + (end_time - start_time) >= $2))
+     OR EXISTS (
+            SELECT 1 FROM event_exceptions x
+            WHERE x.event_id = events.id
+              AND NOT x.cancelled
+              AND x.start_time < $3 AND x.end_time > $2
+        )
+  )
 ORDER BY start_time
-`, chatID, startOfDay, endOfDay)
-    if err != nil {
-        return nil, err
-    }
-    defer rows.Close()
-
-    var result []models.Event
-    for rows.Next() {
-        var e models.Event
-        if err := rows.Scan(
-            &e.ID, &e.ChatID, &e.Title,
-            &e.StartTime, &e.EndTime,
-            &e.NotifyBefore, &e.Notified,
-        ); err != nil {
-            return nil, err
-        }
-        result = append(result, e)
-    }
-    return result, nil
-}
-
-// DeleteAllToday пример удаления всех сегодняшних событий
-func DeleteAllToday(conn *pgx.Conn, chatID int64, now time.Time) error {
-    startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-    endOfDay := startOfDay.Add(24 * time.Hour)
-
-    _, err := conn.Exec(context.Background(), `
+`, chatID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := attachExceptions(ctx, repo.pool, events); err != nil {
+		return nil, err
+	}
+
+	var result []models.Event
+	for _, e := range events {
+		if !e.IsRecurring() {
+			result = append(result, e)
+			continue
+		}
+		// Разворачиваем в поясе запроса, чтобы время суток совпадало с исходным
+		e.StartTime = e.StartTime.In(from.Location())
+		e.EndTime = e.EndTime.In(from.Location())
+
+		// Повторения, начавшиеся до from, ищем с запасом на самую длинную длительность
+		longest := e.EndTime.Sub(e.StartTime)
+		for _, ex := range e.Exceptions {
+			longest = max(longest, ex.EndTime.Sub(ex.StartTime))
+		}
+		for _, occ := range e.Occurrences(from.Add(-longest), to) {
+			if occ.EndTime.After(from) || !occ.StartTime.Before(from) {
+				result = append(result, occ)
+			}
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].StartTime.Before(result[j].StartTime)
+	})
+	return result, nil
+}
+
+// DeleteAllToday пример удаления всех сегодняшних событий.
+// Повторяющиеся серии не затрагиваются — их удаляют по ID.
+// Границы суток считаются в поясе now.
+func (repo *PgRepository) DeleteAllToday(ctx context.Context, chatID int64, now time.Time) error {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	startOfDay, endOfDay := DayBounds(now)
+
+	_, err := repo.pool.Exec(ctx, `
 DELETE FROM events
 WHERE chat_id = $1
+  AND rrule IS NULL
   AND start_time >= $2
   AND start_time <  $3
 `, chatID, startOfDay, endOfDay)
-    return err
-}
\ No newline at end of file
+	return err
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// notifierLockKey — ключ advisory-блокировки, которую держит лидер среди notifier-ов
+const notifierLockKey int64 = 0x43616c5669676c01
+
+// leaderRetry — как часто резервный экземпляр пытается стать лидером и лидер проверяет,
+// что его соединение с базой живо
+const leaderRetry = 10 * time.Second
+
+// advisoryLock — сессионная advisory-блокировка PostgreSQL на выделенном соединении.
+// Она держится, пока соединение открыто: если процесс упадёт или связь с базой
+// прервётся, сервер снимет её сам.
+type advisoryLock struct {
+	conn *pgxpool.Conn
+	key  int64
+}
+
+// tryAdvisoryLock берёт блокировку key, не дожидаясь её; nil без ошибки — блокировку
+// держит кто-то другой
+func (repo *PgRepository) tryAdvisoryLock(ctx context.Context, key int64) (*advisoryLock, error) {
+	conn, err := repo.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	qctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	var locked bool
+	if err := conn.QueryRow(qctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&locked); err != nil {
+		conn.Release()
+		return nil, err
+	}
+	if !locked {
+		conn.Release()
+		return nil, nil
+	}
+	return &advisoryLock{conn: conn, key: key}, nil
+}
+
+// hold проверяет соединение блокировки каждые interval и возвращается, когда оно
+// потеряно (и вместе с ним блокировка) или отменён ctx
+func (l *advisoryLock) hold(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		pctx, cancel := context.WithTimeout(ctx, interval)
+		err := l.conn.Ping(pctx)
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			log.Println("Соединение с блокировкой лидера потеряно:", err)
+			return
+		}
+	}
+}
+
+// release снимает блокировку и возвращает соединение в пул. Если снять не удалось,
+// соединение закрывается: иначе блокировка осталась бы за соединением в пуле.
+func (l *advisoryLock) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultQueryTimeout)
+	defer cancel()
+	if _, err := l.conn.Exec(ctx, `SELECT pg_advisory_unlock($1)`, l.key); err != nil {
+		l.conn.Conn().Close(ctx)
+	}
+	l.conn.Release()
+}
+
+// runElected выполняет run, только пока этот экземпляр держит блокировку key, — так из
+// нескольких экземпляров с одной базой работает один. Остальные пытаются взять блокировку
+// каждые retry и подхватывают работу, когда лидер останавливается или теряет соединение.
+// run получает контекст, который отменяется при потере лидерства. Возвращается после
+// отмены ctx.
+func runElected(ctx context.Context, repo *PgRepository, key int64, retry time.Duration, run func(ctx context.Context)) {
+	for {
+		lock, err := repo.tryAdvisoryLock(ctx, key)
+		if err != nil && ctx.Err() == nil {
+			log.Println("Ошибка выбора лидера:", err)
+		}
+		if lock != nil {
+			leaderCtx, cancel := context.WithCancel(ctx)
+			held := make(chan struct{})
+			go func() {
+				defer close(held)
+				lock.hold(leaderCtx, retry)
+				cancel()
+			}()
+			run(leaderCtx)
+			cancel()
+			<-held
+			lock.release()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
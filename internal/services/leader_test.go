@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRunElected — из нескольких экземпляров работает один, а после остановки лидера
+// работу подхватывает другой
+func TestRunElected(t *testing.T) {
+	repo := testRepository(t)
+	key := time.Now().UnixNano()
+
+	var mu sync.Mutex
+	active, maxActive := map[int]bool{}, 0
+	leader := func() (int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		for i := range active {
+			return i, len(active)
+		}
+		return -1, 0
+	}
+
+	const instances = 3
+	cancels := make([]context.CancelFunc, instances)
+	var wg sync.WaitGroup
+	for i := 0; i < instances; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancels[i] = cancel
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			runElected(ctx, repo, key, 20*time.Millisecond, func(ctx context.Context) {
+				mu.Lock()
+				active[i] = true
+				maxActive = max(maxActive, len(active))
+				mu.Unlock()
+				<-ctx.Done()
+				mu.Lock()
+				delete(active, i)
+				mu.Unlock()
+			})
+		}(i)
+	}
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+		wg.Wait()
+	}()
+
+	waitLeader := func(not int) int {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if i, n := leader(); n == 1 && i != not {
+				return i
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatal("лидер не выбран")
+		return -1
+	}
+
+	first := waitLeader(-1)
+	time.Sleep(100 * time.Millisecond)
+	cancels[first]()
+	second := waitLeader(first)
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if maxActive != 1 {
+		t.Errorf("одновременно работали %d экземпляра", maxActive)
+	}
+	if !active[second] {
+		t.Errorf("лидер %d перестал работать", second)
+	}
+}
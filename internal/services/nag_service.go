@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/models"
+)
+
+// startNagging (пере)запускает повторы напоминания о повторении события с режимом Nag.
+// Состояние хранится в nag_states, поэтому переживает перезапуск. Вызывается в той же
+// транзакции, что ставит напоминание в очередь: иначе доставленное напоминание могло
+// остаться без повторов.
+func startNagging(ctx context.Context, q querier, ev models.Event, now time.Time) error {
+	if ev.Nag == nil {
+		return nil
+	}
+	_, err := q.Exec(ctx, `
+INSERT INTO nag_states (event_id, occurrence_start, next_at, sent_count)
+VALUES ($1, $2, $3, 0)
+ON CONFLICT (event_id, occurrence_start)
+DO UPDATE SET next_at = EXCLUDED.next_at, sent_count = 0, acknowledged_at = NULL
+`, ev.ID, ev.OccurrenceKey(), now.Add(ev.Nag.Interval))
+	return err
+}
+
+// AcknowledgeOccurrence останавливает повторы напоминания о повторении события.
+func (repo *PgRepository) AcknowledgeOccurrence(ctx context.Context, chatID int64, eventID int, occurrenceStart time.Time) error {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	_, err := repo.pool.Exec(ctx, `
+UPDATE nag_states
+SET acknowledged_at = now()
+WHERE event_id = $2
+  AND occurrence_start = $3
+  AND acknowledged_at IS NULL
+  AND EXISTS (SELECT 1 FROM events WHERE id = $2 AND chat_id = $1)
+`, chatID, eventID, occurrenceStart)
+	return err
+}
+
+// dueNag — наступивший повтор напоминания
+type dueNag struct {
+	Event     models.Event // повторение, о котором напоминаем
+	SentCount int          // сколько повторов уже отправлено
+}
+
+// findDueNags возвращает неподтверждённые повторения чата chatID (allChats — всех чатов),
+// которым пора напомнить ещё раз: from <= next_at <= now. Отменённые повторения пропускаются.
+func (repo *PgRepository) findDueNags(ctx context.Context, from, now time.Time, chatID int64) ([]dueNag, error) {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := repo.pool.Query(ctx, `
+SELECT n.occurrence_start, n.sent_count, `+eventColumnsE+`
+FROM nag_states n
+JOIN events e ON e.id = n.event_id
+WHERE n.acknowledged_at IS NULL
+  AND n.next_at BETWEEN $1 AND $2
+  AND e.nag_interval_minutes IS NOT NULL
+  AND n.sent_count < e.nag_max
+  AND ($3::bigint = 0 OR e.chat_id = $3)
+  AND NOT `+occurrenceCancelled("n")+`
+ORDER BY n.next_at
+`, from, now, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []time.Time
+	var counts []int
+	var events []models.Event
+	for rows.Next() {
+		var occStart time.Time
+		var count int
+		var er eventRow
+		if err := rows.Scan(append([]any{&occStart, &count}, er.targets()...)...); err != nil {
+			return nil, err
+		}
+		e, err := er.event()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, occStart)
+		counts = append(counts, count)
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := attachExceptions(ctx, repo.pool, events); err != nil {
+		return nil, err
+	}
+
+	result := make([]dueNag, 0, len(events))
+	for i, e := range events {
+		occ := e
+		if e.IsRecurring() {
+			occ = e.Occurrence(keys[i].In(e.StartTime.Location()))
+		}
+		result = append(result, dueNag{Event: occ, SentCount: counts[i]})
+	}
+	return result, nil
+}
+
+// claimNag учитывает повтор и назначает следующий. false — повтор уже учёл кто-то
+// другой или напоминание успели подтвердить.
+func claimNag(ctx context.Context, q querier, n dueNag, now time.Time) (bool, error) {
+	tag, err := q.Exec(ctx, `
+UPDATE nag_states
+SET sent_count = sent_count + 1, next_at = $4
+WHERE event_id = $1 AND occurrence_start = $2
+  AND sent_count = $3 AND acknowledged_at IS NULL
+`, n.Event.ID, n.Event.OccurrenceKey(), n.SentCount, now.Add(n.Event.Nag.Interval))
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
@@ -6,82 +6,458 @@ import (
 	"log"
 	"time"
 
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/jackc/pgx/v5"
-
+	"github.com/natindo/CalVigil/internal/messenger"
 	"github.com/natindo/CalVigil/internal/models"
 )
 
-// StartNotifier запускает горутину, которая каждые 60 секунд проверяет события.
-// Если (start_time - now) <= notify_before и notified=false, отправляем уведомление.
-func StartNotifier(bot *tgbotapi.BotAPI, conn *pgx.Conn) {
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
+// dueNotification — повторение события, по которому пора отправить напоминание.
+// Reminders — все его наступившие и ещё не доставленные напоминания.
+type dueNotification struct {
+	Event     models.Event
+	Reminders []models.Reminder
+}
+
+// DefaultNotifierInterval — наибольшая пауза между проверками напоминаний по умолчанию
+const DefaultNotifierInterval = 5 * time.Minute
+
+// DefaultLateWindow — сколько после начала события по умолчанию ещё отправляются
+// пропущенные напоминания
+const DefaultLateWindow = 15 * time.Minute
+
+// NotifierOptions — настройки notifier-а
+type NotifierOptions struct {
+	// Interval — наибольшая пауза между проверками; 0 — DefaultNotifierInterval.
+	// Ближайшее напоминание notifier ждёт точно, а проверка раз в Interval подхватывает
+	// изменения, о которых он не узнал через LISTEN/NOTIFY (например, сделанные в обход бота).
+	Interval time.Duration
+	// LateWindow — сколько после начала повторения ещё отправляются напоминания,
+	// пропущенные, пока бот был остановлен; 0 — DefaultLateWindow
+	LateWindow time.Duration
+}
+
+// StartNotifier отправляет напоминания, пока не отменён ctx. Notifier вычисляет, когда
+// наступит ближайшее напоминание, и спит до этого момента; изменение событий в любом
+// экземпляре бота будит его раньше (LISTEN/NOTIFY). Напоминания, пропущенные за время остановки, отправляются при запуске,
+// если повторение началось не раньше чем LateWindow назад.
+//
+// Каждое напоминание события (и каждого повторения серии) учитывается отдельно и ставится
+// в очередь отправки (reminder_outbox) один раз. Доставленным сообщение считается, только
+// когда мессенджер подтвердил отправку; при ошибке отправка повторяется с растущей паузой,
+// пока напоминание не устарело. Если мессенджер запретил писать в чат (бота заблокировали),
+// напоминания чата отключаются до /start.
+// Для событий с режимом Nag напоминание повторяется, пока пользователь его не подтвердит.
+// Notifier берёт соединения из общего пула и работает одновременно с обработчиками.
+//
+// Если с одной базой работает несколько экземпляров бота, напоминания отправляет один
+// из них — лидер, державший advisory-блокировку на отдельном соединении пула; остальные
+// ждут и подхватывают работу, если лидер остановится или потеряет связь с базой.
+// Даже когда два notifier-а ненадолго работают одновременно, напоминание попадает
+// в очередь один раз, а сообщение из очереди берёт в отправку один из них.
+//
+// После отмены ctx уже начатая отправка доводится до конца, следующие не начинаются;
+// StartNotifier возвращается, когда остановлен.
+func StartNotifier(ctx context.Context, bot messenger.Messenger, repo *PgRepository, opts NotifierOptions) {
+	runElected(ctx, repo, notifierLockKey, leaderRetry, func(ctx context.Context) {
+		// Изменения, сделанные другими экземплярами, приходят через LISTEN/NOTIFY
+		listening := make(chan struct{})
+		go func() {
+			defer close(listening)
+			repo.listenChanges(ctx, leaderRetry)
+		}()
+		runNotifier(ctx, bot, repo, opts, allChats)
+		<-listening
+	})
+}
+
+// StartChatNotifier — StartNotifier только для событий чата chatID, без выбора лидера.
+// Консольный режим работает с той же базой, что и бот, и не должен забирать напоминания
+// других чатов.
+func StartChatNotifier(ctx context.Context, bot messenger.Messenger, repo *PgRepository, opts NotifierOptions, chatID int64) {
+	runNotifier(ctx, bot, repo, opts, chatID)
+}
+
+// allChats — фильтр notifier-а без ограничения по чату
+const allChats int64 = 0
+
+func runNotifier(ctx context.Context, bot messenger.Messenger, repo *PgRepository, opts NotifierOptions, chatID int64) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultNotifierInterval
+	}
+	if opts.LateWindow <= 0 {
+		opts.LateWindow = DefaultLateWindow
+	}
 
 	for {
-		<-ticker.C
+		// Канал берётся до проверки, чтобы не пропустить изменение, сделанное во время неё
+		changes := repo.scheduleChanges()
+		notifyDue(ctx, bot, repo, time.Now(), opts.LateWindow, chatID)
+		if ctx.Err() != nil {
+			return
+		}
+
 		now := time.Now()
+		wait := opts.Interval
+		next, ok, err := repo.nextDueTime(ctx, now, now.Add(opts.Interval), chatID)
+		if err != nil && ctx.Err() == nil {
+			log.Println("Ошибка nextDueTime:", err)
+		}
+		if ok {
+			wait = next.Sub(now)
+		}
 
-		events, err := findEventsToNotify(conn, now)
-		if err != nil {
-			log.Println("Ошибка findEventsToNotify:", err)
-			continue
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-changes:
+			timer.Stop()
+		case <-timer.C:
 		}
-		if len(events) == 0 {
-			continue
+	}
+}
+
+// notifyDue ставит в очередь отправки все наступившие напоминания чата chatID
+// (allChats — всех чатов), пропуская те, что опоздали больше чем на late, и отправляет
+// очередь. Напоминание отмечается в БД в одной транзакции с постановкой в очередь,
+// поэтому в очередь оно попадает ровно один раз.
+func notifyDue(ctx context.Context, bot messenger.Messenger, repo *PgRepository, now time.Time, late time.Duration, chatID int64) {
+	enqueueDue(ctx, repo, now, late, chatID)
+	deliverOutbox(ctx, bot, repo, now, chatID)
+}
+
+func enqueueDue(ctx context.Context, repo *PgRepository, now time.Time, late time.Duration, chatID int64) {
+	due, err := repo.findEventsToNotify(ctx, now, late, chatID)
+	if err != nil && ctx.Err() == nil {
+		log.Println("Ошибка findEventsToNotify:", err)
+	}
+	for _, n := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		_, err := repo.enqueue(ctx, func(ctx context.Context, q querier) (bool, error) {
+			claimed, err := claimReminders(ctx, q, n)
+			if err != nil || !claimed {
+				return false, err
+			}
+			return true, startNagging(ctx, q, n.Event, now)
+		}, reminderMessage(n.Event, now, late, "Напоминание!"), now)
+		if err != nil {
+			log.Println("Ошибка постановки напоминания в очередь:", err)
 		}
+	}
 
-		for _, ev := range events {
-			notifyUser(bot, ev)
-			if err := markEventNotified(conn, ev.ID); err != nil {
-				log.Println("Ошибка markEventNotified:", err)
+	snoozes, err := repo.findDueSnoozes(ctx, now.Add(-late), now, chatID)
+	if err != nil && ctx.Err() == nil {
+		log.Println("Ошибка findDueSnoozes:", err)
+	}
+	for _, sn := range snoozes {
+		if ctx.Err() != nil {
+			return
+		}
+		_, err := repo.enqueue(ctx, func(ctx context.Context, q querier) (bool, error) {
+			claimed, err := claimSnooze(ctx, q, sn.ID)
+			if err != nil || !claimed {
+				return false, err
 			}
+			return true, startNagging(ctx, q, sn.Event, now)
+		}, reminderMessage(sn.Event, now, late, "Напоминание!"), now)
+		if err != nil {
+			log.Println("Ошибка постановки отложенного напоминания в очередь:", err)
+		}
+	}
+
+	nags, err := repo.findDueNags(ctx, now.Add(-late), now, chatID)
+	if err != nil && ctx.Err() == nil {
+		log.Println("Ошибка findDueNags:", err)
+	}
+	for _, n := range nags {
+		if ctx.Err() != nil {
+			return
+		}
+		header := fmt.Sprintf("Напоминание (повтор %d из %d)!", n.SentCount+1, n.Event.Nag.MaxRepeats)
+		_, err := repo.enqueue(ctx, func(ctx context.Context, q querier) (bool, error) {
+			return claimNag(ctx, q, n, now)
+		}, reminderMessage(n.Event, now, late, header), now)
+		if err != nil {
+			log.Println("Ошибка постановки повтора в очередь:", err)
 		}
 	}
 }
 
-// findEventsToNotify ищет события, для которых пора отправить уведомление.
-func findEventsToNotify(conn *pgx.Conn, now time.Time) ([]models.Event, error) {
-	rows, err := conn.Query(context.Background(), `
-SELECT id, chat_id, title, start_time, end_time, notify_before, notified
+// reminderEvents загружает события чата chatID с напоминаниями, у которых может
+// найтись повторение, начинающееся не раньше from, с напоминанием не позже until.
+// Серия подходит, если окно попадает между её началом и series_end или в окно
+// перенесено одно из её повторений. Точный отбор повторений делает вызывающий.
+func (repo *PgRepository) reminderEvents(ctx context.Context, from, until time.Time, chatID int64) ([]models.Event, error) {
+	rows, err := repo.pool.Query(ctx, `
+WITH offsets AS (
+    SELECT event_id, MAX(offset_minutes) * INTERVAL '1 minute' AS max_offset
+    FROM event_reminders
+    GROUP BY event_id
+)
+SELECT `+eventColumns+`
 FROM events
-WHERE notified = false
-  AND start_time > $1
-  AND (start_time - $1) <= (notify_before * INTERVAL '1 minute')
-`, now)
+JOIN offsets ON offsets.event_id = events.id
+WHERE ($3::bigint = 0 OR chat_id = $3)
+  AND (
+        (rrule IS NULL AND start_time >= $1 AND start_time - offsets.max_offset <= $2)
+     OR (rrule IS NOT NULL AND start_time - offsets.max_offset <= $2
+         AND (series_end IS NULL OR series_end >= $1))
+     OR (rrule IS NOT NULL AND EXISTS (
+            SELECT 1 FROM event_exceptions x
+            WHERE x.event_id = events.id AND NOT x.cancelled
+              AND x.start_time >= $1 AND x.start_time - offsets.max_offset <= $2))
+  )
+`, from, until, chatID)
+	if err != nil {
+		return nil, err
+	}
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := attachExceptions(ctx, repo.pool, events); err != nil {
+		return nil, err
+	}
+	if err := attachReminders(ctx, repo.pool, events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// maxReminderOffset — самое раннее напоминание события
+func maxReminderOffset(ev models.Event) time.Duration {
+	var maxOffset time.Duration
+	for _, r := range ev.Reminders {
+		maxOffset = max(maxOffset, r.Offset)
+	}
+	return maxOffset
+}
+
+// findEventsToNotify ищет повторения событий, у которых наступило время хотя бы одного
+// недоставленного напоминания: start_time - offset <= now, а само повторение началось
+// не раньше now - late. chatID ограничивает поиск одним чатом; allChats — все чаты.
+func (repo *PgRepository) findEventsToNotify(ctx context.Context, now time.Time, late time.Duration, chatID int64) ([]dueNotification, error) {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	from := now.Add(-late)
+	events, err := repo.reminderEvents(ctx, from, now, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Сначала все наступившие напоминания, затем одним запросом — какие из них уже доставлены
+	var candidates []dueNotification
+	var keys []deliveryKey
+	for _, ev := range events {
+		for _, occ := range ev.Occurrences(from, now.Add(maxReminderOffset(ev)+time.Nanosecond)) {
+			n := dueNotification{Event: occ}
+			for _, r := range ev.Reminders {
+				if !occ.StartTime.Add(-r.Offset).After(now) {
+					n.Reminders = append(n.Reminders, r)
+					keys = append(keys, deliveryKey{r.ID, occ.OccurrenceKey().UnixMicro()})
+				}
+			}
+			if len(n.Reminders) > 0 {
+				candidates = append(candidates, n)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	sent, err := repo.sentReminders(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []dueNotification
+	for _, n := range candidates {
+		pending := n.Reminders[:0:0]
+		for _, r := range n.Reminders {
+			if !sent[deliveryKey{r.ID, n.Event.OccurrenceKey().UnixMicro()}] {
+				pending = append(pending, r)
+			}
+		}
+		if len(pending) > 0 {
+			n.Reminders = pending
+			result = append(result, n)
+		}
+	}
+	return result, nil
+}
+
+// nextDueTime возвращает ближайший момент в (now, until], когда наступит напоминание,
+// отложенное напоминание, повтор или следующая попытка отправки из очереди. ok = false, если до until ничего не наступает.
+func (repo *PgRepository) nextDueTime(ctx context.Context, now, until time.Time, chatID int64) (next time.Time, ok bool, err error) {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	consider := func(t time.Time) {
+		if t.After(now) && !t.After(until) && (!ok || t.Before(next)) {
+			next, ok = t, true
+		}
+	}
+
+	events, err := repo.reminderEvents(ctx, now, until, chatID)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	for _, ev := range events {
+		for _, occ := range ev.Occurrences(now, until.Add(maxReminderOffset(ev)+time.Nanosecond)) {
+			for _, r := range ev.Reminders {
+				consider(occ.StartTime.Add(-r.Offset))
+			}
+		}
+	}
+
+	var snoozeAt, nagAt, retryAt *time.Time
+	err = repo.pool.QueryRow(ctx, `
+SELECT
+    (SELECT MIN(s.remind_at)
+     FROM snoozes s
+     JOIN events e ON e.id = s.event_id
+     WHERE s.sent_at IS NULL
+       AND s.remind_at > $1 AND s.remind_at <= $2
+       AND ($3::bigint = 0 OR e.chat_id = $3)
+       AND NOT `+occurrenceCancelled("s")+`),
+    (SELECT MIN(n.next_at)
+     FROM nag_states n
+     JOIN events e ON e.id = n.event_id
+     WHERE n.acknowledged_at IS NULL
+       AND n.next_at > $1 AND n.next_at <= $2
+       AND e.nag_interval_minutes IS NOT NULL
+       AND n.sent_count < e.nag_max
+       AND ($3::bigint = 0 OR e.chat_id = $3)
+       AND NOT `+occurrenceCancelled("n")+`),
+    (SELECT MIN(next_attempt_at)
+     FROM reminder_outbox
+     WHERE sent_at IS NULL AND failed_at IS NULL
+       AND next_attempt_at > $1 AND next_attempt_at <= $2
+       AND ($3::bigint = 0 OR chat_id = $3))
+`, now, until, chatID).Scan(&snoozeAt, &nagAt, &retryAt)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	for _, t := range []*time.Time{snoozeAt, nagAt, retryAt} {
+		if t != nil {
+			consider(*t)
+		}
+	}
+	return next, ok, nil
+}
+
+// deliveryKey — напоминание и повторение (OccurrenceKey в микросекундах, с точностью
+// timestamptz), для которого оно доставляется
+type deliveryKey struct {
+	reminderID      int
+	occurrenceStart int64
+}
+
+// sentReminders возвращает, какие из напоминаний keys уже доставлены
+func (repo *PgRepository) sentReminders(ctx context.Context, keys []deliveryKey) (map[deliveryKey]bool, error) {
+	ids := make([]int, len(keys))
+	starts := make([]time.Time, len(keys))
+	for i, k := range keys {
+		ids[i] = k.reminderID
+		starts[i] = time.UnixMicro(k.occurrenceStart)
+	}
+	rows, err := repo.pool.Query(ctx, `
+SELECT d.reminder_id, d.occurrence_start
+FROM reminder_deliveries d
+JOIN unnest($1::int[], $2::timestamptz[]) AS k (reminder_id, occurrence_start)
+  ON k.reminder_id = d.reminder_id AND k.occurrence_start = d.occurrence_start
+`, ids, starts)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var result []models.Event
+	sent := make(map[deliveryKey]bool)
 	for rows.Next() {
-		var e models.Event
-		err := rows.Scan(&e.ID, &e.ChatID, &e.Title, &e.StartTime, &e.EndTime, &e.NotifyBefore, &e.Notified)
-		if err != nil {
+		var k deliveryKey
+		var start time.Time
+		if err := rows.Scan(&k.reminderID, &start); err != nil {
 			return nil, err
 		}
-		result = append(result, e)
+		k.occurrenceStart = start.UnixMicro()
+		sent[k] = true
 	}
-	return result, nil
+	return sent, rows.Err()
 }
 
-func markEventNotified(conn *pgx.Conn, eventID int) error {
-	_, err := conn.Exec(context.Background(), `
-UPDATE events
-SET notified = true
-WHERE id = $1
-`, eventID)
-	return err
+// claimReminders отмечает доставку наступивших напоминаний повторения.
+// Возвращает true, если хотя бы одно из них отметил этот вызов, и тогда пользователь
+// получает одно сообщение, даже если напоминаний несколько (например, событие создано
+// за 30 минут до начала с напоминаниями «1d, 1h»). false — их уже отметил кто-то другой.
+func claimReminders(ctx context.Context, q querier, n dueNotification) (bool, error) {
+	ids := make([]int, 0, len(n.Reminders))
+	for _, r := range n.Reminders {
+		ids = append(ids, r.ID)
+	}
+	// Одним запросом: параллельный вызов ждёт на первом же конфликте и не отметит
+	// часть напоминаний, отправив второе сообщение
+	tag, err := q.Exec(ctx, `
+INSERT INTO reminder_deliveries (reminder_id, occurrence_start, sent_at)
+SELECT unnest($1::int[]), $2, now()
+ON CONFLICT DO NOTHING
+`, ids, n.Event.OccurrenceKey())
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
 }
 
-func notifyUser(bot *tgbotapi.BotAPI, ev models.Event) {
-	mins := ev.NotifyBefore
+// reminderMessage — сообщение-напоминание о повторении ev, составленное в now.
+// Отправлять его имеет смысл до начала повторения и ещё late после.
+func reminderMessage(ev models.Event, now time.Time, late time.Duration, header string) outboxMessage {
 	startStr := ev.StartTime.Format("15:04")
 	endStr := ev.EndTime.Format("15:04")
 
-	text := fmt.Sprintf("Напоминание!\nЧерез %d мин начнётся событие:\n%s\nВремя: %s - %s",
-		mins, ev.Title, startStr, endStr)
-	msg := tgbotapi.NewMessage(ev.ChatID, text)
-	bot.Send(msg)
+	var text string
+	if left := ev.StartTime.Sub(now); left >= time.Minute {
+		text = fmt.Sprintf("%s\nЧерез %s начнётся событие:\n%s\nВремя: %s - %s",
+			header, models.FormatOffset(left), ev.Title, startStr, endStr)
+	} else if left <= -time.Minute {
+		text = fmt.Sprintf("%s\n%s назад началось событие:\n%s\nВремя: %s - %s",
+			header, models.FormatOffset(-left), ev.Title, startStr, endStr)
+	} else {
+		text = fmt.Sprintf("%s\nСобытие начинается:\n%s\nВремя: %s - %s",
+			header, ev.Title, startStr, endStr)
+	}
+	return outboxMessage{
+		ChatID:    ev.ChatID,
+		Text:      text,
+		Keyboard:  reminderKeyboard(ev, now),
+		ExpiresAt: maxTime(ev.StartTime, now).Add(late),
+	}
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// reminderKeyboard — кнопки «отложить» и «понятно» под напоминанием.
+// Формат callback_data: snooze:<минуты|start>:<eventID>:<unix повторения>, ack:<eventID>:<unix повторения>
+func reminderKeyboard(ev models.Event, now time.Time) messenger.Keyboard {
+	key := fmt.Sprintf("%d:%d", ev.ID, ev.OccurrenceKey().Unix())
+	snoozeRow := messenger.NewRow(
+		messenger.NewButton("Отложить 5 мин", "snooze:5:"+key),
+		messenger.NewButton("Отложить 15 мин", "snooze:15:"+key),
+	)
+	rows := [][]messenger.Button{snoozeRow}
+	if ev.StartTime.After(now) {
+		rows = append(rows, messenger.NewRow(
+			messenger.NewButton("Напомнить в начале", "snooze:start:"+key),
+		))
+	}
+	rows = append(rows, messenger.NewRow(
+		messenger.NewButton("Понятно", "ack:"+key),
+	))
+	return messenger.NewKeyboard(rows...)
 }
@@ -0,0 +1,431 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+	"github.com/natindo/CalVigil/internal/models"
+	"github.com/natindo/CalVigil/internal/recurrence"
+)
+
+// recorder — Messenger, запоминающий отправленные сообщения; fail, если задана,
+// может отклонить отправку
+type recorder struct {
+	mu       sync.Mutex
+	sent     []string
+	chats    []int64
+	at       []time.Time
+	attempts int
+	fail     func(chatID int64) error
+}
+
+func (r *recorder) SendMessage(chatID int64, text string, keyboard messenger.Keyboard) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts++
+	if r.fail != nil {
+		if err := r.fail(chatID); err != nil {
+			return 0, err
+		}
+	}
+	r.sent = append(r.sent, text)
+	r.chats = append(r.chats, chatID)
+	r.at = append(r.at, time.Now())
+	return len(r.sent), nil
+}
+
+func (r *recorder) EditMessage(int64, int, string, messenger.Keyboard) error { return nil }
+func (r *recorder) AnswerCallback(string, string) error                      { return nil }
+func (r *recorder) SetCommands([]messenger.Command) error                    { return nil }
+
+func (r *recorder) messages() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.sent...)
+}
+
+// messagesTo возвращает сообщения, отправленные в чат chatID
+func (r *recorder) messagesTo(chatID int64) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result []string
+	for i, text := range r.sent {
+		if r.chats[i] == chatID {
+			result = append(result, text)
+		}
+	}
+	return result
+}
+
+func TestReminderMessage(t *testing.T) {
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		start time.Time
+		want  string
+	}{
+		{now.Add(15 * time.Minute), "Через 15 мин начнётся событие"},
+		{now, "Событие начинается"},
+		{now.Add(-5 * time.Minute), "5 мин назад началось событие"},
+	}
+	for _, tt := range tests {
+		ev := models.Event{ChatID: 42, Title: "Созвон", StartTime: tt.start, EndTime: tt.start.Add(time.Hour)}
+		m := reminderMessage(ev, now, 15*time.Minute, "Напоминание!")
+		if !strings.Contains(m.Text, tt.want) || m.ChatID != 42 || len(m.Keyboard) == 0 {
+			t.Errorf("начало %s: %+v, ожидалось «%s»", tt.start.Format("15:04"), m, tt.want)
+		}
+		// Отправлять напоминание имеет смысл до начала и ещё 15 минут после
+		if want := maxTime(tt.start, now).Add(15 * time.Minute); !m.ExpiresAt.Equal(want) {
+			t.Errorf("начало %s: срок %s, ожидался %s", tt.start.Format("15:04"), m.ExpiresAt, want)
+		}
+	}
+}
+
+// insertTestEvent создаёт событие и удаляет его по окончании теста
+func insertTestEvent(t *testing.T, repo *PgRepository, ev models.Event) int {
+	t.Helper()
+	ctx := context.Background()
+	id, err := repo.InsertEvent(ctx, ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.DeleteEvent(context.Background(), ev.ChatID, id) })
+	return id
+}
+
+// TestNotifierWakesAtReminder — notifier спит до напоминания, а не до следующей проверки,
+// и узнаёт о событии, созданном уже после запуска
+func TestNotifierWakesAtReminder(t *testing.T) {
+	repo := testRepository(t)
+	chatID := -time.Now().UnixNano()
+	var r recorder
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		StartChatNotifier(ctx, &r, repo, NotifierOptions{Interval: time.Hour}, chatID)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now().Add(500 * time.Millisecond).Truncate(time.Millisecond)
+	insertTestEvent(t, repo, models.Event{
+		ChatID:    chatID,
+		Title:     "Точное напоминание",
+		StartTime: start,
+		EndTime:   start.Add(time.Hour),
+		Reminders: []models.Reminder{{Offset: 0}},
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(r.messages()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("напоминание не пришло")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	r.mu.Lock()
+	at := r.at[0]
+	r.mu.Unlock()
+	if at.Before(start) || at.Sub(start) > time.Second {
+		t.Errorf("напоминание пришло в %s, ожидалось в %s", at.Format("15:04:05.000"), start.Format("15:04:05.000"))
+	}
+}
+
+// TestNotifyDueCatchUp — после простоя отправляются напоминания о недавно начавшихся
+// событиях, но не о давно прошедших, и каждое — один раз
+func TestNotifyDueCatchUp(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	chatID := -time.Now().UnixNano()
+	now := time.Now().Truncate(time.Second)
+
+	for _, ev := range []struct {
+		title string
+		start time.Time
+	}{
+		{"Недавнее", now.Add(-5 * time.Minute)},
+		{"Давнее", now.Add(-time.Hour)},
+		{"Будущее", now.Add(time.Hour)},
+	} {
+		insertTestEvent(t, repo, models.Event{
+			ChatID:    chatID,
+			Title:     ev.title,
+			StartTime: ev.start,
+			EndTime:   ev.start.Add(2 * time.Hour),
+			Reminders: []models.Reminder{{Offset: 10 * time.Minute}},
+		})
+	}
+
+	var r recorder
+	notifyDue(ctx, &r, repo, now, 15*time.Minute, chatID)
+	notifyDue(ctx, &r, repo, now.Add(time.Second), 15*time.Minute, chatID)
+	msgs := r.messages()
+	if len(msgs) != 1 || !strings.Contains(msgs[0], "Недавнее") || !strings.Contains(msgs[0], "5 мин назад") {
+		t.Errorf("отправлено: %q", msgs)
+	}
+}
+
+// TestReminderEventsSeriesWindow — notifier не загружает серии, которые закончились
+// или ещё не начались, но находит перенесённое в окно повторение закончившейся серии
+func TestReminderEventsSeriesWindow(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	chatID := -time.Now().UnixNano()
+	now := time.Now().Truncate(time.Second)
+
+	series := func(title, rule string, start time.Time) int {
+		r, err := recurrence.Parse(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return insertTestEvent(t, repo, models.Event{
+			ChatID:     chatID,
+			Title:      title,
+			StartTime:  start,
+			EndTime:    start.Add(time.Hour),
+			Recurrence: r,
+			Reminders:  []models.Reminder{{Offset: 10 * time.Minute}},
+		})
+	}
+	series("Бесконечная", "FREQ=DAILY", now.AddDate(0, 0, -10))
+	series("Закончилась", "FREQ=DAILY;COUNT=3", now.AddDate(0, 0, -10))
+	series("Ещё не началась", "FREQ=DAILY", now.AddDate(0, 0, 10))
+	moved := series("Перенесена", "FREQ=DAILY;COUNT=2", now.AddDate(0, 0, -10))
+	if err := repo.OverrideOccurrence(ctx, chatID, moved, now.AddDate(0, 0, -9), now.Add(5*time.Minute), now.Add(time.Hour), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := repo.reminderEvents(ctx, now.Add(-time.Hour), now.Add(time.Hour), chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, ev := range events {
+		titles = append(titles, ev.Title)
+	}
+	slices.Sort(titles)
+	if got := strings.Join(titles, ", "); got != "Бесконечная, Перенесена" {
+		t.Errorf("загружены серии: %s", got)
+	}
+}
+
+// TestNagUntilAcknowledged — напоминание с режимом Nag повторяется каждые Interval,
+// пока его не подтвердят, и не больше MaxRepeats раз
+func TestNagUntilAcknowledged(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	const late = 15 * time.Minute
+
+	nagging := func(chatID int64) models.Event {
+		ev := models.Event{
+			ChatID:    chatID,
+			Title:     "Важное",
+			StartTime: now.Add(5 * time.Minute),
+			EndTime:   now.Add(time.Hour),
+			Reminders: []models.Reminder{{Offset: 10 * time.Minute}},
+			Nag:       &models.NagPolicy{Interval: time.Minute, MaxRepeats: 2},
+		}
+		ev.ID = insertTestEvent(t, repo, ev)
+		return ev
+	}
+	// run проверяет notifier в моменты now, now+1m, ... и возвращает, сколько
+	// сообщений отправлено к каждому из них
+	run := func(chatID int64, ticks int, before func(tick int)) []int {
+		var r recorder
+		var sent []int
+		for i := 0; i < ticks; i++ {
+			if before != nil {
+				before(i)
+			}
+			notifyDue(ctx, &r, repo, now.Add(time.Duration(i)*time.Minute+time.Second), late, chatID)
+			sent = append(sent, len(r.messages()))
+		}
+		return sent
+	}
+
+	// Без подтверждения: напоминание и два повтора, дальше тишина
+	chatID := -time.Now().UnixNano()
+	nagging(chatID)
+	if got := fmt.Sprint(run(chatID, 5, nil)); got != "[1 2 3 3 3]" {
+		t.Errorf("без подтверждения отправлено: %s", got)
+	}
+
+	// Подтверждение после первого повтора останавливает остальные
+	chatID = -time.Now().UnixNano()
+	ev := nagging(chatID)
+	got := run(chatID, 4, func(tick int) {
+		if tick == 2 {
+			if err := repo.AcknowledgeOccurrence(ctx, chatID, ev.ID, ev.OccurrenceKey()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	if fmt.Sprint(got) != "[1 2 2 2]" {
+		t.Errorf("с подтверждением отправлено: %v", got)
+	}
+}
+
+func TestNextDueTime(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	chatID := -time.Now().UnixNano()
+	now := time.Now().Truncate(time.Second)
+
+	start := now.Add(2 * time.Hour)
+	id := insertTestEvent(t, repo, models.Event{
+		ChatID:    chatID,
+		Title:     "Через два часа",
+		StartTime: start,
+		EndTime:   start.Add(time.Hour),
+		Reminders: []models.Reminder{{Offset: 30 * time.Minute}, {Offset: time.Hour}},
+	})
+
+	if next, ok, err := repo.nextDueTime(ctx, now, now.Add(3*time.Hour), chatID); err != nil || !ok || !next.Equal(start.Add(-time.Hour)) {
+		t.Errorf("nextDueTime = %s, %v, %v; ожидалось %s", next, ok, err, start.Add(-time.Hour))
+	}
+	if _, ok, err := repo.nextDueTime(ctx, now, now.Add(30*time.Minute), chatID); err != nil || ok {
+		t.Errorf("до until ничего не наступает, получено ok=%v, %v", ok, err)
+	}
+
+	snoozeAt := now.Add(10 * time.Minute)
+	if err := repo.ScheduleSnooze(ctx, chatID, id, start, snoozeAt); err != nil {
+		t.Fatal(err)
+	}
+	if next, ok, _ := repo.nextDueTime(ctx, now, now.Add(3*time.Hour), chatID); !ok || !next.Equal(snoozeAt) {
+		t.Errorf("nextDueTime = %s, ожидалось отложенное напоминание в %s", next, snoozeAt)
+	}
+}
+
+// TestNotifiersNoDuplicates — несколько экземпляров бота, каждый со своим пулом, работают
+// с одной базой через StartNotifier: каждое напоминание отправляется ровно один раз,
+// в том числе о событиях, созданных через экземпляр, который не стал лидером.
+// Лидер рассылает напоминания всех чатов базы, поэтому сообщения считаются по chatID.
+func TestNotifiersNoDuplicates(t *testing.T) {
+	const instances = 3
+	repos := make([]*PgRepository, instances)
+	for i := range repos {
+		repos[i] = testRepository(t)
+	}
+	ctx := context.Background()
+	chatID := -time.Now().UnixNano()
+	now := time.Now().Truncate(time.Second)
+
+	reminded := func(repo *PgRepository, title string, start time.Time) int {
+		return insertTestEvent(t, repo, models.Event{
+			ChatID:    chatID,
+			Title:     title,
+			StartTime: start,
+			EndTime:   start.Add(time.Hour),
+			Reminders: []models.Reminder{{Offset: 5 * time.Minute}, {Offset: 10 * time.Minute}},
+		})
+	}
+	first := reminded(repos[0], "Первое", now.Add(time.Minute))
+	reminded(repos[1], "Второе", now.Add(2*time.Minute))
+	if err := repos[2].ScheduleSnooze(ctx, chatID, first, now.Add(time.Minute), now); err != nil {
+		t.Fatal(err)
+	}
+	nag := models.Event{
+		ChatID:    chatID,
+		Title:     "Повтор",
+		StartTime: now.Add(time.Hour),
+		EndTime:   now.Add(2 * time.Hour),
+		Nag:       &models.NagPolicy{Interval: time.Minute, MaxRepeats: 3},
+	}
+	nag.ID = insertTestEvent(t, repos[0], nag)
+	if err := startNagging(ctx, repos[0].pool, nag, now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Interval больше времени теста: события, созданные после запуска, лидер видит
+	// только по уведомлению из базы
+	recorders := make([]recorder, instances)
+	runCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for i := range repos {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			StartNotifier(runCtx, &recorders[i], repos[i], NotifierOptions{Interval: time.Hour})
+		}(i)
+	}
+	total := func() int {
+		n := 0
+		for i := range recorders {
+			n += len(recorders[i].messagesTo(chatID))
+		}
+		return n
+	}
+	waitTotal := func(want int) {
+		deadline := time.Now().Add(5 * time.Second)
+		for total() < want && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Два напоминания, одно отложенное и один повтор
+	waitTotal(4)
+	for i := range repos {
+		reminded(repos[i], fmt.Sprintf("Созданное в экземпляре %d", i), now.Add(3*time.Minute))
+	}
+	const want = 4 + instances
+	waitTotal(want)
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	if n := total(); n != want {
+		for i := range recorders {
+			t.Logf("экземпляр %d: %q", i, recorders[i].messagesTo(chatID))
+		}
+		t.Errorf("отправлено %d сообщений, ожидалось %d", n, want)
+	}
+}
+
+// TestListenChanges — изменение через один пул будит notifier, слушающий через другой
+func TestListenChanges(t *testing.T) {
+	listener, writer := testRepository(t), testRepository(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	listening := make(chan struct{})
+	subscribed := listener.scheduleChanges()
+	go func() {
+		defer close(listening)
+		listener.listenChanges(ctx, 20*time.Millisecond)
+	}()
+	defer func() {
+		cancel()
+		<-listening
+	}()
+
+	wait := func(ch <-chan struct{}, what string) {
+		t.Helper()
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatal(what)
+		}
+	}
+	// Подписавшись, listenChanges будит notifier-ы один раз
+	wait(subscribed, "подписка не состоялась")
+
+	changed := listener.scheduleChanges()
+	start := time.Now().Add(time.Hour)
+	insertTestEvent(t, writer, models.Event{
+		ChatID:    -time.Now().UnixNano(),
+		Title:     "Из другого экземпляра",
+		StartTime: start,
+		EndTime:   start.Add(time.Hour),
+		Reminders: []models.Reminder{{Offset: 10 * time.Minute}},
+	})
+	wait(changed, "изменение из другого пула не разбудило notifier")
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+)
+
+const (
+	// outboxRetryBase и outboxRetryMax — пауза перед повтором отправки: 10 с, 20 с,
+	// 40 с … и не больше 30 минут
+	outboxRetryBase = 10 * time.Second
+	outboxRetryMax  = 30 * time.Minute
+	// outboxLease — на сколько взятое в отправку сообщение скрыто от других notifier-ов.
+	// Если процесс упадёт посреди отправки, сообщение снова попадёт в очередь через outboxLease.
+	outboxLease = time.Minute
+	// outboxBatch — сколько сообщений берётся в отправку за раз
+	outboxBatch = 50
+	// outboxRetention — сколько хранятся отправленные и отброшенные сообщения
+	outboxRetention = 7 * 24 * time.Hour
+)
+
+// outboxMessage — сообщение в очереди отправки (таблица reminder_outbox)
+type outboxMessage struct {
+	ID        int64
+	ChatID    int64
+	Text      string
+	Keyboard  messenger.Keyboard
+	Attempts  int       // сколько раз сообщение уже брали в отправку, включая текущую
+	ExpiresAt time.Time // после этого момента напоминание бесполезно и не отправляется
+}
+
+// outboxBackoff — пауза перед следующей попыткой после attempts неудачных
+func outboxBackoff(attempts int) time.Duration {
+	d := outboxRetryBase
+	for i := 1; i < attempts && d < outboxRetryMax; i++ {
+		d *= 2
+	}
+	return min(d, outboxRetryMax)
+}
+
+// enqueue в одной транзакции выполняет claim (отметку о том, что напоминание
+// отправлено) и ставит msg в очередь с первой попыткой в now: либо и то и другое,
+// либо ничего. false — claim уже сделан кем-то другим, сообщение не ставится.
+// В заблокированный чат (blocked_chats) сообщение не ставится, а claim всё равно
+// фиксируется: напоминание считается пропущенным.
+func (repo *PgRepository) enqueue(ctx context.Context, claim func(ctx context.Context, q querier) (bool, error), msg outboxMessage, now time.Time) (bool, error) {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	keyboard, err := json.Marshal(msg.Keyboard)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := repo.pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	claimed, err := claim(ctx, tx)
+	if err != nil || !claimed {
+		return false, err
+	}
+	_, err = tx.Exec(ctx, `
+INSERT INTO reminder_outbox (chat_id, text, keyboard, next_attempt_at, expires_at)
+SELECT $1, $2, $3, $4, $5
+WHERE NOT EXISTS (SELECT 1 FROM blocked_chats WHERE chat_id = $1)
+`, msg.ChatID, msg.Text, keyboard, now, msg.ExpiresAt)
+	if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// deliverOutbox отправляет сообщения очереди чата chatID (allChats — всех чатов),
+// которым подошло время. Отправленное отмечается в БД, только когда мессенджер
+// подтвердил отправку; при ошибке попытка повторяется позже (outboxBackoff), а запрет
+// писать в чат (messenger.ErrForbidden) отключает напоминания этого чата.
+// После отмены ctx новые сообщения в отправку не берутся.
+func deliverOutbox(ctx context.Context, bot messenger.Messenger, repo *PgRepository, now time.Time, chatID int64) {
+	markCtx := context.WithoutCancel(ctx)
+
+	msgs, err := repo.claimOutbox(ctx, now, chatID)
+	if err != nil && ctx.Err() == nil {
+		log.Println("Ошибка claimOutbox:", err)
+	}
+	for _, m := range msgs {
+		if ctx.Err() != nil {
+			// Взятые сообщения вернутся в очередь через outboxLease
+			return
+		}
+		_, sendErr := bot.SendMessage(m.ChatID, m.Text, m.Keyboard)
+		if err := repo.finishOutbox(markCtx, m, sendErr, time.Now()); err != nil {
+			log.Println("Ошибка finishOutbox:", err)
+		}
+	}
+
+	if err := repo.pruneOutbox(ctx, now.Add(-outboxRetention)); err != nil && ctx.Err() == nil {
+		log.Println("Ошибка pruneOutbox:", err)
+	}
+}
+
+// claimOutbox берёт в отправку сообщения, которым подошло время, и откладывает их
+// следующую попытку на outboxLease, чтобы их не взял параллельный notifier.
+// Просроченные сообщения отбрасываются.
+func (repo *PgRepository) claimOutbox(ctx context.Context, now time.Time, chatID int64) ([]outboxMessage, error) {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	_, err := repo.pool.Exec(ctx, `
+UPDATE reminder_outbox
+SET failed_at = $1, last_error = 'истёк срок: ' || COALESCE(last_error, 'не отправлено')
+WHERE sent_at IS NULL AND failed_at IS NULL
+  AND expires_at < $1
+  AND ($2::bigint = 0 OR chat_id = $2)
+`, now, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := repo.pool.Query(ctx, `
+UPDATE reminder_outbox
+SET attempts = attempts + 1, next_attempt_at = $2
+WHERE id IN (
+    SELECT id FROM reminder_outbox
+    WHERE sent_at IS NULL AND failed_at IS NULL
+      AND next_attempt_at <= $1
+      AND ($3::bigint = 0 OR chat_id = $3)
+    ORDER BY next_attempt_at
+    LIMIT $4
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, chat_id, text, keyboard, attempts, expires_at
+`, now, now.Add(outboxLease), chatID, outboxBatch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []outboxMessage
+	for rows.Next() {
+		var m outboxMessage
+		var keyboard []byte
+		if err := rows.Scan(&m.ID, &m.ChatID, &m.Text, &keyboard, &m.Attempts, &m.ExpiresAt); err != nil {
+			return nil, err
+		}
+		if len(keyboard) > 0 {
+			if err := json.Unmarshal(keyboard, &m.Keyboard); err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, m)
+	}
+	return result, rows.Err()
+}
+
+// finishOutbox записывает результат попытки отправки m, сделанной в now
+func (repo *PgRepository) finishOutbox(ctx context.Context, m outboxMessage, sendErr error, now time.Time) error {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	switch {
+	case sendErr == nil:
+		_, err := repo.pool.Exec(ctx, `
+UPDATE reminder_outbox SET sent_at = $2 WHERE id = $1
+`, m.ID, now)
+		return err
+
+	case errors.Is(sendErr, messenger.ErrForbidden):
+		log.Printf("Чат %d недоступен, напоминания отключены до /start: %v", m.ChatID, sendErr)
+		return repo.blockChat(ctx, m.ChatID, sendErr.Error())
+
+	default:
+		next := now.Add(outboxBackoff(m.Attempts))
+		if next.After(m.ExpiresAt) {
+			log.Printf("Напоминание в чат %d не отправлено за %d попыток: %v", m.ChatID, m.Attempts, sendErr)
+			_, err := repo.pool.Exec(ctx, `
+UPDATE reminder_outbox SET failed_at = $2, last_error = $3 WHERE id = $1
+`, m.ID, now, sendErr.Error())
+			return err
+		}
+		log.Printf("Напоминание в чат %d не отправлено (попытка %d), повтор в %s: %v",
+			m.ChatID, m.Attempts, next.Format("15:04:05"), sendErr)
+		_, err := repo.pool.Exec(ctx, `
+UPDATE reminder_outbox SET next_attempt_at = $2, last_error = $3 WHERE id = $1
+`, m.ID, next, sendErr.Error())
+		return err
+	}
+}
+
+// blockChat отключает напоминания чата, куда бот больше не может писать, и отбрасывает
+// его сообщения в очереди
+func (repo *PgRepository) blockChat(ctx context.Context, chatID int64, reason string) error {
+	tx, err := repo.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+INSERT INTO blocked_chats (chat_id, reason)
+VALUES ($1, $2)
+ON CONFLICT (chat_id) DO UPDATE SET reason = EXCLUDED.reason, blocked_at = now()
+`, chatID, reason)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+UPDATE reminder_outbox
+SET failed_at = now(), last_error = $2
+WHERE chat_id = $1 AND sent_at IS NULL AND failed_at IS NULL
+`, chatID, reason)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// ResumeReminders снова включает напоминания чата, отключённые из-за того, что бот
+// не мог туда писать. Вызывается, когда чат снова обращается к боту (/start).
+func (repo *PgRepository) ResumeReminders(ctx context.Context, chatID int64) error {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	_, err := repo.pool.Exec(ctx, `
+DELETE FROM blocked_chats WHERE chat_id = $1
+`, chatID)
+	return err
+}
+
+// pruneOutbox удаляет отправленные и отброшенные сообщения, созданные до before
+func (repo *PgRepository) pruneOutbox(ctx context.Context, before time.Time) error {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	_, err := repo.pool.Exec(ctx, `
+DELETE FROM reminder_outbox
+WHERE created_at < $1 AND (sent_at IS NOT NULL OR failed_at IS NOT NULL)
+`, before)
+	return err
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+	"github.com/natindo/CalVigil/internal/models"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := map[int]time.Duration{
+		1:  10 * time.Second,
+		2:  20 * time.Second,
+		3:  40 * time.Second,
+		8:  1280 * time.Second,
+		9:  outboxRetryMax,
+		60: outboxRetryMax,
+	}
+	for attempts, want := range tests {
+		if got := outboxBackoff(attempts); got != want {
+			t.Errorf("outboxBackoff(%d) = %s, ожидалось %s", attempts, got, want)
+		}
+	}
+}
+
+// TestOutboxRetry — временная ошибка отправки не теряет напоминание: оно отправляется
+// повторно после паузы и только один раз
+func TestOutboxRetry(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	chatID := -time.Now().UnixNano()
+	now := time.Now()
+
+	start := now.Add(time.Minute)
+	insertTestEvent(t, repo, models.Event{
+		ChatID:    chatID,
+		Title:     "Сетевой сбой",
+		StartTime: start,
+		EndTime:   start.Add(time.Hour),
+		Reminders: []models.Reminder{{Offset: 5 * time.Minute}},
+	})
+
+	failures := 1
+	r := recorder{fail: func(int64) error {
+		if failures > 0 {
+			failures--
+			return errors.New("connection reset by peer")
+		}
+		return nil
+	}}
+	notifyDue(ctx, &r, repo, now, DefaultLateWindow, chatID)
+	if len(r.messages()) != 0 || r.attempts != 1 {
+		t.Fatalf("после сбоя: попыток %d, отправлено %q", r.attempts, r.messages())
+	}
+
+	// Следующая попытка — через outboxBackoff(1), notifier проснётся к ней
+	next, ok, err := repo.nextDueTime(ctx, now, now.Add(time.Hour), chatID)
+	if err != nil || !ok || next.Before(now.Add(outboxRetryBase)) || next.After(time.Now().Add(outboxRetryBase)) {
+		t.Errorf("nextDueTime = %s, %v, %v; ожидалась попытка через %s", next, ok, err, outboxRetryBase)
+	}
+	notifyDue(ctx, &r, repo, now.Add(outboxRetryBase/2), DefaultLateWindow, chatID)
+	if r.attempts != 1 {
+		t.Errorf("повтор раньше паузы: попыток %d", r.attempts)
+	}
+
+	later := time.Now().Add(2 * outboxRetryBase)
+	notifyDue(ctx, &r, repo, later, DefaultLateWindow, chatID)
+	notifyDue(ctx, &r, repo, later.Add(outboxLease), DefaultLateWindow, chatID)
+	if msgs := r.messages(); len(msgs) != 1 || r.attempts != 2 {
+		t.Errorf("после повтора: попыток %d, отправлено %q", r.attempts, msgs)
+	}
+}
+
+// TestOutboxForbidden — 403 отключает напоминания чата до /start
+func TestOutboxForbidden(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	chatID := -time.Now().UnixNano()
+	now := time.Now()
+
+	blocked := true
+	r := recorder{fail: func(int64) error {
+		if blocked {
+			return fmt.Errorf("%w: Forbidden: bot was blocked by the user", messenger.ErrForbidden)
+		}
+		return nil
+	}}
+	event := func(title string) {
+		start := now.Add(time.Minute)
+		insertTestEvent(t, repo, models.Event{
+			ChatID:    chatID,
+			Title:     title,
+			StartTime: start,
+			EndTime:   start.Add(time.Hour),
+			Reminders: []models.Reminder{{Offset: 5 * time.Minute}},
+		})
+	}
+
+	event("Первое")
+	notifyDue(ctx, &r, repo, now, DefaultLateWindow, chatID)
+	if r.attempts != 1 {
+		t.Fatalf("попыток %d, ожидалась одна", r.attempts)
+	}
+
+	// Пока чат заблокирован, напоминания в него не отправляются и не повторяются
+	event("Второе")
+	notifyDue(ctx, &r, repo, now.Add(time.Second), DefaultLateWindow, chatID)
+	notifyDue(ctx, &r, repo, now.Add(time.Hour/2), DefaultLateWindow, chatID)
+	if r.attempts != 1 {
+		t.Errorf("в заблокированный чат было %d попыток", r.attempts)
+	}
+
+	blocked = false
+	if err := repo.ResumeReminders(ctx, chatID); err != nil {
+		t.Fatal(err)
+	}
+	event("Третье")
+	notifyDue(ctx, &r, repo, now.Add(2*time.Second), DefaultLateWindow, chatID)
+	if msgs := r.messages(); len(msgs) != 1 || !strings.Contains(msgs[0], "Третье") {
+		t.Errorf("после /start отправлено: %q", msgs)
+	}
+}
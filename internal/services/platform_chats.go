@@ -0,0 +1,44 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+)
+
+var _ messenger.ChatDirectory = (*PgRepository)(nil)
+
+// ChatID возвращает числовой ID чата платформы, заводя его при первом обращении.
+// ON CONFLICT ... DO UPDATE нужен, чтобы RETURNING вернул ID и уже известного чата.
+func (repo *PgRepository) ChatID(ctx context.Context, platform, externalID string) (int64, error) {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	var chatID int64
+	err := repo.pool.QueryRow(ctx, `
+INSERT INTO platform_chats (platform, external_id)
+VALUES ($1, $2)
+ON CONFLICT (platform, external_id) DO UPDATE SET platform = EXCLUDED.platform
+RETURNING chat_id
+`, platform, externalID).Scan(&chatID)
+	return chatID, err
+}
+
+// ExternalChatID возвращает ID чата на платформе по числовому ID
+func (repo *PgRepository) ExternalChatID(ctx context.Context, platform string, chatID int64) (string, error) {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	var externalID string
+	err := repo.pool.QueryRow(ctx, `
+SELECT external_id FROM platform_chats WHERE chat_id = $1 AND platform = $2
+`, chatID, platform).Scan(&externalID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("чат %d не найден на платформе %s", chatID, platform)
+	}
+	return externalID, err
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/natindo/CalVigil/internal/models"
+)
+
+// DefaultQueryTimeout — сколько по умолчанию ждать одного обращения к БД
+const DefaultQueryTimeout = 5 * time.Second
+
+// EventRepository — хранилище событий, их повторений, напоминаний и настроек чатов.
+// Каждый метод принимает контекст: его отмена или истечение срока прерывают запрос к БД.
+type EventRepository interface {
+	InsertEvent(ctx context.Context, ev models.Event) (int, error)
+	UpdateEvent(ctx context.Context, chatID int64, eventID int, apply func(ev *models.Event)) (*models.Event, error)
+	DeleteEvent(ctx context.Context, chatID int64, eventID int) error
+	DeleteAllToday(ctx context.Context, chatID int64, now time.Time) error
+	GetEventByID(ctx context.Context, chatID int64, eventID int) (*models.Event, error)
+	GetEventsForToday(ctx context.Context, chatID int64, now time.Time) ([]models.Event, error)
+	GetEventsInRange(ctx context.Context, chatID int64, from, to time.Time) ([]models.Event, error)
+
+	CancelOccurrence(ctx context.Context, chatID int64, eventID int, occurrenceStart time.Time) error
+	OverrideOccurrence(ctx context.Context, chatID int64, eventID int, occurrenceStart time.Time, start, end time.Time, title string) error
+	TruncateSeries(ctx context.Context, chatID int64, eventID int, occurrenceStart time.Time) error
+	SplitSeries(ctx context.Context, chatID int64, eventID int, occurrenceStart time.Time, newEv models.Event) (int, error)
+
+	ScheduleSnooze(ctx context.Context, chatID int64, eventID int, occurrenceStart, remindAt time.Time) error
+	AcknowledgeOccurrence(ctx context.Context, chatID int64, eventID int, occurrenceStart time.Time) error
+
+	ChatLocation(ctx context.Context, chatID int64) (*time.Location, error)
+	SetChatTimezone(ctx context.Context, chatID int64, loc *time.Location) error
+
+	ResumeReminders(ctx context.Context, chatID int64) error
+}
+
+// PgRepository — EventRepository поверх пула соединений PostgreSQL.
+// Безопасен для одновременного использования обработчиками и notifier-ом.
+// Он же хранит состояния диалогов (StateStore).
+type PgRepository struct {
+	pool      *pgxpool.Pool
+	timeout   time.Duration
+	dialogTTL time.Duration
+
+	// changed закрывается, когда меняется расписание напоминаний, и будит notifier-ы
+	mu      sync.Mutex
+	changed chan struct{}
+}
+
+var _ EventRepository = (*PgRepository)(nil)
+
+// NewPgRepository создаёт репозиторий; timeout ограничивает каждое обращение к БД
+// (0 — DefaultQueryTimeout), dialogTTL — время жизни брошенного диалога (0 — DefaultDialogTTL).
+func NewPgRepository(pool *pgxpool.Pool, timeout, dialogTTL time.Duration) *PgRepository {
+	if timeout <= 0 {
+		timeout = DefaultQueryTimeout
+	}
+	if dialogTTL <= 0 {
+		dialogTTL = DefaultDialogTTL
+	}
+	return &PgRepository{pool: pool, timeout: timeout, dialogTTL: dialogTTL}
+}
+
+// withTimeout ограничивает время одного обращения к БД, не продлевая срок родительского контекста
+func (repo *PgRepository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, repo.timeout)
+}
+
+// scheduleChanges возвращает канал, который закроется при следующем изменении
+// событий, напоминаний или отложенных напоминаний
+func (repo *PgRepository) scheduleChanges() <-chan struct{} {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if repo.changed == nil {
+		repo.changed = make(chan struct{})
+	}
+	return repo.changed
+}
+
+// wakeNotifiers будит notifier-ы этого процесса, чтобы они пересчитали время ближайшего
+// напоминания. Notifier-ы других экземпляров будит announceChanges.
+func (repo *PgRepository) wakeNotifiers() {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if repo.changed != nil {
+		close(repo.changed)
+		repo.changed = nil
+	}
+}
+
+// scheduleChannel — канал LISTEN/NOTIFY, которым экземпляры бота сообщают лидеру
+// об изменениях расписания
+const scheduleChannel = "calvigil_schedule"
+
+// announceChanges сообщает notifier-ам всех экземпляров, что расписание изменилось.
+// Вызывается в транзакции изменения: PostgreSQL доставит уведомление только после
+// её фиксации и не доставит, если она откатится.
+func announceChanges(ctx context.Context, q querier) error {
+	_, err := q.Exec(ctx, `SELECT pg_notify($1, '')`, scheduleChannel)
+	return err
+}
+
+// listenChanges подписывается на scheduleChannel на отдельном соединении вне пула и будит
+// notifier-ы этого процесса при каждом изменении расписания в любом экземпляре.
+// Потеряв соединение, подписывается заново через retry. Возвращается после отмены ctx.
+func (repo *PgRepository) listenChanges(ctx context.Context, retry time.Duration) {
+	for {
+		err := repo.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Println("Ошибка подписки на изменения расписания:", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// listen держит одну подписку на scheduleChannel, пока не отменён ctx или не потеряно
+// соединение. Соединение открывается отдельно от пула, чтобы подписка лидера не занимала
+// соединение, нужное обработчикам.
+func (repo *PgRepository) listen(ctx context.Context) error {
+	cctx, cancel := repo.withTimeout(ctx)
+	conn, err := pgx.ConnectConfig(cctx, repo.pool.Config().ConnConfig)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	qctx, cancel := repo.withTimeout(ctx)
+	_, err = conn.Exec(qctx, `LISTEN `+scheduleChannel)
+	cancel()
+	if err != nil {
+		return err
+	}
+	// Пока подписки не было, изменения могли пройти незамеченными
+	repo.wakeNotifiers()
+	for {
+		if _, err := conn.WaitForNotification(ctx); err != nil {
+			return err
+		}
+		repo.wakeNotifiers()
+	}
+}
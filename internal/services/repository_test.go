@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/database"
+	"github.com/natindo/CalVigil/internal/database/dbtest"
+	"github.com/natindo/CalVigil/internal/models"
+)
+
+func TestWithTimeout(t *testing.T) {
+	repo := NewPgRepository(nil, 0, 0)
+	if repo.timeout != DefaultQueryTimeout {
+		t.Fatalf("timeout = %v, ожидался DefaultQueryTimeout", repo.timeout)
+	}
+
+	repo = NewPgRepository(nil, time.Second, 0)
+	ctx, cancel := repo.withTimeout(context.Background())
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > time.Second {
+		t.Errorf("срок запроса %v, ожидалось не больше секунды", time.Until(deadline))
+	}
+
+	// Более близкий срок родительского контекста не продлевается
+	parent, cancelParent := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelParent()
+	ctx, cancel = repo.withTimeout(parent)
+	defer cancel()
+	if deadline, _ := ctx.Deadline(); time.Until(deadline) > 10*time.Millisecond {
+		t.Errorf("срок родительского контекста продлён до %v", deadline)
+	}
+
+	// Отмена родителя прерывает запрос
+	parent, cancelParent = context.WithCancel(context.Background())
+	ctx, cancel = repo.withTimeout(parent)
+	defer cancel()
+	cancelParent()
+	if ctx.Err() == nil {
+		t.Error("отмена родительского контекста не передалась")
+	}
+}
+
+func TestMain(m *testing.M) { dbtest.Main(m) }
+
+// testRepository подключается к тестовой базе (см. dbtest.URL) и применяет миграции
+func testRepository(t *testing.T) *PgRepository {
+	t.Helper()
+	ctx := context.Background()
+	pool, err := database.ConnectPostgres(ctx, dbtest.URL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	if _, err := database.MigrateUp(ctx, pool); err != nil {
+		t.Fatal(err)
+	}
+	return NewPgRepository(pool, 0, 0)
+}
+
+// TestRepositoryConcurrentUse — обработчики и notifier обращаются к БД одновременно
+func TestRepositoryConcurrentUse(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	chatID := -time.Now().UnixNano()
+
+	now := time.Now().Truncate(time.Minute)
+	id, err := repo.InsertEvent(ctx, models.Event{
+		ChatID:    chatID,
+		Title:     "Параллельный тест",
+		StartTime: now.Add(2 * time.Minute),
+		EndTime:   now.Add(time.Hour),
+		Reminders: []models.Reminder{{Offset: 5 * time.Minute}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.DeleteEvent(context.Background(), chatID, id) })
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := repo.GetEventsForToday(ctx, chatID, now)
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := repo.findEventsToNotify(ctx, now, DefaultLateWindow, allChats)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRepositoryCancelledContext(t *testing.T) {
+	repo := testRepository(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := repo.GetEventByID(ctx, 1, 1); err == nil {
+		t.Error("запрос с отменённым контекстом выполнился")
+	}
+}
+
+func TestGetEventByIDNotFound(t *testing.T) {
+	repo := testRepository(t)
+	ev, err := repo.GetEventByID(context.Background(), -time.Now().UnixNano(), 1)
+	if ev != nil || err != nil {
+		t.Errorf("GetEventByID несуществующего события = %v, %v; want nil, nil", ev, err)
+	}
+}
+
+func TestPlatformChats(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	room := fmt.Sprintf("!room%d:test", time.Now().UnixNano())
+
+	id, err := repo.ChatID(ctx, "matrix", room)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id < 1<<62 {
+		t.Errorf("ID %d пересекается с ID чатов Telegram", id)
+	}
+	if again, err := repo.ChatID(ctx, "matrix", room); err != nil || again != id {
+		t.Errorf("повторный ChatID = %d, %v; ожидался %d", again, err, id)
+	}
+	if other, _ := repo.ChatID(ctx, "slack", room); other == id {
+		t.Error("чаты разных платформ получили один ID")
+	}
+	if got, err := repo.ExternalChatID(ctx, "matrix", id); err != nil || got != room {
+		t.Errorf("ExternalChatID = %q, %v", got, err)
+	}
+	if _, err := repo.ExternalChatID(ctx, "slack", id); err == nil {
+		t.Error("чат найден на чужой платформе")
+	}
+}
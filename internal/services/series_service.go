@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/natindo/CalVigil/internal/models"
+)
+
+// Область применения изменения для повторяющейся серии
+const (
+	ScopeThis      = "this"      // только выбранное повторение
+	ScopeFollowing = "following" // выбранное и все последующие
+	ScopeAll       = "all"       // вся серия
+)
+
+// ErrEventNotFound возвращается, если событие не найдено или принадлежит другому чату
+var ErrEventNotFound = errors.New("событие не найдено")
+
+// CancelOccurrence отменяет одно повторение серии. Отложенные напоминания и повторы
+// «пока не подтвердят» для него удаляются.
+func (repo *PgRepository) CancelOccurrence(ctx context.Context, chatID int64, eventID int, occurrenceStart time.Time) error {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := repo.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+INSERT INTO event_exceptions (event_id, occurrence_start, cancelled)
+SELECT id, $3, true
+FROM events
+WHERE chat_id = $1 AND id = $2
+ON CONFLICT (event_id, occurrence_start)
+DO UPDATE SET cancelled = true, start_time = NULL, end_time = NULL, title = NULL
+`, chatID, eventID, occurrenceStart)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrEventNotFound
+	}
+	if err := forgetOccurrence(ctx, tx, eventID, occurrenceStart); err != nil {
+		return err
+	}
+	if err := announceChanges(ctx, tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	repo.wakeNotifiers()
+	return nil
+}
+
+// OverrideOccurrence переносит одно повторение серии и/или меняет его название.
+// Состояние уведомления для повторения сбрасывается, чтобы напомнить о новом времени:
+// доставки напоминаний, отложенные напоминания и повторы «пока не подтвердят».
+func (repo *PgRepository) OverrideOccurrence(ctx context.Context, chatID int64, eventID int, occurrenceStart time.Time, start, end time.Time, title string) error {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := repo.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+INSERT INTO event_exceptions (event_id, occurrence_start, cancelled, start_time, end_time, title)
+SELECT id, $3, false, $4, $5, NULLIF($6, '')
+FROM events
+WHERE chat_id = $1 AND id = $2
+ON CONFLICT (event_id, occurrence_start)
+DO UPDATE SET cancelled = false,
+              start_time = EXCLUDED.start_time,
+              end_time = EXCLUDED.end_time,
+              title = EXCLUDED.title
+`, chatID, eventID, occurrenceStart, start, end, title)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrEventNotFound
+	}
+
+	_, err = tx.Exec(ctx, `
+DELETE FROM reminder_deliveries
+WHERE occurrence_start = $2
+  AND reminder_id IN (SELECT id FROM event_reminders WHERE event_id = $1)
+`, eventID, occurrenceStart)
+	if err != nil {
+		return err
+	}
+	if err := forgetOccurrence(ctx, tx, eventID, occurrenceStart); err != nil {
+		return err
+	}
+	if err := announceChanges(ctx, tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	repo.wakeNotifiers()
+	return nil
+}
+
+// forgetOccurrence удаляет неотправленные отложенные напоминания и повторы
+// «пока не подтвердят» повторения серии
+func forgetOccurrence(ctx context.Context, q querier, eventID int, occurrenceStart time.Time) error {
+	_, err := q.Exec(ctx, `
+DELETE FROM snoozes
+WHERE event_id = $1 AND occurrence_start = $2 AND sent_at IS NULL
+`, eventID, occurrenceStart)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(ctx, `
+DELETE FROM nag_states WHERE event_id = $1 AND occurrence_start = $2
+`, eventID, occurrenceStart)
+	return err
+}
+
+// TruncateSeries завершает серию перед повторением occurrenceStart
+// («удалить это и последующие»). Если это первое повторение, серия удаляется целиком.
+func (repo *PgRepository) TruncateSeries(ctx context.Context, chatID int64, eventID int, occurrenceStart time.Time) error {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := repo.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := truncateSeriesTx(ctx, tx, chatID, eventID, occurrenceStart); err != nil {
+		return err
+	}
+	if err := announceChanges(ctx, tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	repo.wakeNotifiers()
+	return nil
+}
+
+// SplitSeries завершает старую серию перед occurrenceStart и создаёт новую серию
+// из newEv («изменить это и последующие»). Возвращает ID новой серии.
+// Если у старой серии был COUNT, новой достаётся оставшееся число повторений.
+func (repo *PgRepository) SplitSeries(ctx context.Context, chatID int64, eventID int, occurrenceStart time.Time, newEv models.Event) (int, error) {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := repo.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	old, err := lockSeries(ctx, tx, chatID, eventID)
+	if err != nil {
+		return 0, err
+	}
+	if newEv.Recurrence != nil && old.Recurrence != nil && old.Recurrence.Count > 0 &&
+		newEv.Recurrence.String() == old.Recurrence.String() {
+		before := len(old.Recurrence.Between(old.StartTime, old.StartTime, occurrenceStart))
+		rule := *newEv.Recurrence
+		rule.Count = old.Recurrence.Count - before
+		if rule.Count < 1 {
+			rule.Count = 1
+		}
+		newEv.Recurrence = &rule
+	}
+
+	if err := truncateSeriesTx(ctx, tx, chatID, eventID, occurrenceStart); err != nil {
+		return 0, err
+	}
+
+	newEv.ChatID = chatID
+	newID, err := insertEvent(ctx, tx, newEv)
+	if err != nil {
+		return 0, err
+	}
+	if err := announceChanges(ctx, tx); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	repo.wakeNotifiers()
+	return newID, nil
+}
+
+// occurrenceCancelled — условие SQL «повторение отменено» для строки alias
+// с колонками event_id и occurrence_start (snoozes, nag_states)
+func occurrenceCancelled(alias string) string {
+	return `EXISTS (
+    SELECT 1 FROM event_exceptions x
+    WHERE x.event_id = ` + alias + `.event_id
+      AND x.occurrence_start = ` + alias + `.occurrence_start
+      AND x.cancelled)`
+}
+
+func lockSeries(ctx context.Context, tx pgx.Tx, chatID int64, eventID int) (models.Event, error) {
+	row := tx.QueryRow(ctx, `
+SELECT `+eventColumns+`
+FROM events
+WHERE chat_id = $1 AND id = $2
+FOR UPDATE
+`, chatID, eventID)
+	ev, err := scanEvent(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ev, ErrEventNotFound
+	}
+	return ev, err
+}
+
+func truncateSeriesTx(ctx context.Context, tx pgx.Tx, chatID int64, eventID int, occurrenceStart time.Time) error {
+	ev, err := lockSeries(ctx, tx, chatID, eventID)
+	if err != nil {
+		return err
+	}
+
+	if !ev.IsRecurring() || !ev.StartTime.Before(occurrenceStart) {
+		_, err := tx.Exec(ctx, `DELETE FROM events WHERE id = $1`, eventID)
+		return err
+	}
+
+	// COUNT и UNTIL взаимоисключающие — переводим серию на UNTIL
+	rule := *ev.Recurrence
+	rule.Count = 0
+	rule.Until = occurrenceStart.Add(-time.Second)
+	ev.Recurrence = &rule
+
+	_, err = tx.Exec(ctx, `
+UPDATE events SET rrule = $2, series_end = $3 WHERE id = $1
+`, eventID, rruleValue(&rule), seriesEndValue(ev))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+DELETE FROM event_exceptions
+WHERE event_id = $1 AND occurrence_start >= $2
+`, eventID, occurrenceStart)
+	return err
+}
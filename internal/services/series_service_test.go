@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/models"
+	"github.com/natindo/CalVigil/internal/recurrence"
+)
+
+// dailySeries создаёт ежедневную серию с началом в start
+func dailySeries(t *testing.T, repo *PgRepository, chatID int64, start time.Time, nag *models.NagPolicy) models.Event {
+	t.Helper()
+	rule, err := recurrence.Parse("FREQ=DAILY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := models.Event{
+		ChatID:     chatID,
+		Title:      "Серия",
+		StartTime:  start,
+		EndTime:    start.Add(time.Hour),
+		Recurrence: rule,
+		Reminders:  []models.Reminder{{Offset: 10 * time.Minute}},
+		Nag:        nag,
+	}
+	ev.ID = insertTestEvent(t, repo, ev)
+	return ev
+}
+
+// TestCancelOccurrenceStopsReminders — об отменённом повторении не приходят ни отложенные
+// напоминания, ни повторы
+func TestCancelOccurrenceStopsReminders(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	chatID := -time.Now().UnixNano()
+	now := time.Now().Truncate(time.Second)
+
+	ev := dailySeries(t, repo, chatID, now.Add(5*time.Minute), &models.NagPolicy{Interval: time.Minute, MaxRepeats: 3})
+	occ := ev.Occurrence(ev.StartTime)
+	if err := repo.ScheduleSnooze(ctx, chatID, ev.ID, occ.OccurrenceStart, now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := startNagging(ctx, repo.pool, occ, now.Add(-2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if snoozes, _ := repo.findDueSnoozes(ctx, now.Add(-time.Hour), now, chatID); len(snoozes) != 1 {
+		t.Fatalf("до отмены отложенных напоминаний: %d", len(snoozes))
+	}
+
+	if err := repo.CancelOccurrence(ctx, chatID, ev.ID, occ.OccurrenceStart); err != nil {
+		t.Fatal(err)
+	}
+	// Отложенное напоминание, поставленное уже после отмены (кнопка под старым сообщением),
+	// тоже не отправляется
+	if err := repo.ScheduleSnooze(ctx, chatID, ev.ID, occ.OccurrenceStart, now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	snoozes, err := repo.findDueSnoozes(ctx, now.Add(-time.Hour), now, chatID)
+	if err != nil || len(snoozes) != 0 {
+		t.Errorf("отложенные напоминания об отменённом повторении: %+v, %v", snoozes, err)
+	}
+	nags, err := repo.findDueNags(ctx, now.Add(-time.Hour), now, chatID)
+	if err != nil || len(nags) != 0 {
+		t.Errorf("повторы об отменённом повторении: %+v, %v", nags, err)
+	}
+	var rows int
+	if err := repo.pool.QueryRow(ctx, `SELECT count(*) FROM nag_states WHERE event_id = $1`, ev.ID).Scan(&rows); err != nil || rows != 0 {
+		t.Errorf("nag_states после отмены: %d, %v", rows, err)
+	}
+}
+
+func TestShiftOccurrence(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	at := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2025, month, day, hour, min, 0, 0, berlin)
+	}
+	tests := []struct {
+		occ, oldStart, newStart, want time.Time
+	}{
+		// Время суток меняется, дата — нет; через переход на летнее время часы на стене те же
+		{at(3, 31, 9, 0), at(3, 28, 9, 0), at(3, 28, 11, 30), at(3, 31, 11, 30)},
+		// Серия переносится на день позже
+		{at(4, 7, 9, 0), at(3, 3, 9, 0), at(3, 4, 8, 0), at(4, 8, 8, 0)},
+		// и на день раньше, через границу месяца
+		{at(4, 1, 9, 0), at(3, 4, 9, 0), at(3, 3, 9, 0), at(3, 31, 9, 0)},
+	}
+	for _, tt := range tests {
+		got := shiftOccurrence(tt.occ.UTC(), tt.oldStart, tt.newStart)
+		if !got.Equal(tt.want) || got.Location() != berlin {
+			t.Errorf("shiftOccurrence(%v, %v → %v) = %v, want %v", tt.occ, tt.oldStart, tt.newStart, got, tt.want)
+		}
+	}
+}
+
+// TestUpdateSeriesKeepsExceptions — если изменить время серии, отменённое повторение
+// остаётся отменённым, а перенесённое — перенесённым
+func TestUpdateSeriesKeepsExceptions(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	chatID := -time.Now().UnixNano()
+
+	// Завтра в 10:00, чтобы сдвиг на два часа не перешёл через полночь
+	d := time.Now().In(DefaultLocation).AddDate(0, 0, 1)
+	created := dailySeries(t, repo, chatID, time.Date(d.Year(), d.Month(), d.Day(), 10, 0, 0, 0, DefaultLocation), nil)
+	ev, err := repo.GetEventByID(ctx, chatID, created.ID)
+	if err != nil || ev == nil {
+		t.Fatal(ev, err)
+	}
+	occs := ev.Occurrences(ev.StartTime, ev.StartTime.AddDate(0, 0, 4))
+	cancelled, moved := occs[1], occs[2]
+	if err := repo.CancelOccurrence(ctx, chatID, ev.ID, cancelled.OccurrenceStart); err != nil {
+		t.Fatal(err)
+	}
+	movedStart := moved.StartTime.Add(-30 * time.Minute)
+	if err := repo.OverrideOccurrence(ctx, chatID, ev.ID, moved.OccurrenceStart, movedStart, movedStart.Add(time.Hour), "Перенесённое"); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := repo.UpdateEvent(ctx, chatID, ev.ID, func(ev *models.Event) {
+		ev.StartTime = ev.StartTime.Add(2 * time.Hour)
+		ev.EndTime = ev.EndTime.Add(2 * time.Hour)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := updated.OccurrenceOn(cancelled.StartTime); ok {
+		t.Error("отменённое повторение снова в расписании")
+	}
+	occ, ok := updated.OccurrenceOn(moved.StartTime)
+	if !ok || !occ.StartTime.Equal(movedStart) || occ.Title != "Перенесённое" {
+		t.Errorf("перенесённое повторение: %+v, %v", occ, ok)
+	}
+	// Остальные повторения идут по новому времени
+	if occ, ok := updated.OccurrenceOn(occs[3].StartTime); !ok || !occ.StartTime.Equal(occs[3].StartTime.Add(2*time.Hour)) {
+		t.Errorf("обычное повторение: %+v, %v", occ, ok)
+	}
+}
+
+// TestGetEventsInRangeSeriesEnd — закончившаяся серия не попадает в выборку, а её
+// последнее повторение, ещё идущее в начале окна, попадает
+func TestGetEventsInRangeSeriesEnd(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	chatID := -time.Now().UnixNano()
+	now := time.Now().Truncate(time.Second)
+
+	rule, err := recurrence.Parse("FREQ=DAILY;COUNT=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := now.AddDate(0, 0, -10)
+	insertTestEvent(t, repo, models.Event{ChatID: chatID, Title: "Серия", StartTime: start, EndTime: start.Add(time.Hour), Recurrence: rule})
+
+	if events, err := repo.GetEventsInRange(ctx, chatID, now, now.Add(time.Hour)); err != nil || len(events) != 0 {
+		t.Errorf("закончившаяся серия: %+v, %v", events, err)
+	}
+	last := start.AddDate(0, 0, 2)
+	events, err := repo.GetEventsInRange(ctx, chatID, last.Add(30*time.Minute), last.Add(2*time.Hour))
+	if err != nil || len(events) != 1 || !events[0].StartTime.Equal(last) {
+		t.Errorf("последнее повторение: %+v, %v", events, err)
+	}
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/models"
+)
+
+// ScheduleSnooze сохраняет разовое «отложенное» напоминание о повторении события.
+// Оно хранится в БД, поэтому переживает перезапуск и отправляется обычным notifier-ом.
+func (repo *PgRepository) ScheduleSnooze(ctx context.Context, chatID int64, eventID int, occurrenceStart, remindAt time.Time) error {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := repo.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+INSERT INTO snoozes (event_id, occurrence_start, remind_at)
+SELECT id, $3, $4
+FROM events
+WHERE chat_id = $1 AND id = $2
+`, chatID, eventID, occurrenceStart, remindAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrEventNotFound
+	}
+	if err := announceChanges(ctx, tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	repo.wakeNotifiers()
+	return nil
+}
+
+// dueSnooze — наступившее отложенное напоминание
+type dueSnooze struct {
+	ID    int
+	Event models.Event // повторение, о котором напоминаем
+}
+
+// findDueSnoozes возвращает неотправленные отложенные напоминания чата chatID
+// (allChats — всех чатов) с from <= remind_at <= now. Напоминания об отменённых
+// повторениях пропускаются.
+func (repo *PgRepository) findDueSnoozes(ctx context.Context, from, now time.Time, chatID int64) ([]dueSnooze, error) {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := repo.pool.Query(ctx, `
+SELECT s.id, s.occurrence_start, `+eventColumnsE+`
+FROM snoozes s
+JOIN events e ON e.id = s.event_id
+WHERE s.sent_at IS NULL
+  AND s.remind_at BETWEEN $1 AND $2
+  AND ($3::bigint = 0 OR e.chat_id = $3)
+  AND NOT `+occurrenceCancelled("s")+`
+ORDER BY s.remind_at
+`, from, now, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type rawSnooze struct {
+		id       int
+		occStart time.Time
+	}
+	var raws []rawSnooze
+	var events []models.Event
+	for rows.Next() {
+		var r rawSnooze
+		var er eventRow
+		if err := rows.Scan(append([]any{&r.id, &r.occStart}, er.targets()...)...); err != nil {
+			return nil, err
+		}
+		e, err := er.event()
+		if err != nil {
+			return nil, err
+		}
+		raws = append(raws, r)
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := attachExceptions(ctx, repo.pool, events); err != nil {
+		return nil, err
+	}
+
+	result := make([]dueSnooze, 0, len(raws))
+	for i, r := range raws {
+		occ := events[i]
+		if occ.IsRecurring() {
+			occ = occ.Occurrence(r.occStart.In(occ.StartTime.Location()))
+		}
+		result = append(result, dueSnooze{ID: r.id, Event: occ})
+	}
+	return result, nil
+}
+
+// claimSnooze отмечает отложенное напоминание отправленным.
+// false — его уже отметил кто-то другой.
+func claimSnooze(ctx context.Context, q querier, snoozeID int) (bool, error) {
+	tag, err := q.Exec(ctx, `
+UPDATE snoozes SET sent_at = now() WHERE id = $1 AND sent_at IS NULL
+`, snoozeID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
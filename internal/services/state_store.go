@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/natindo/CalVigil/internal/dialog"
+	"github.com/natindo/CalVigil/internal/models"
+	"github.com/natindo/CalVigil/internal/recurrence"
+)
+
+// DefaultDialogTTL — через сколько после последнего действия брошенный диалог забывается
+const DefaultDialogTTL = 24 * time.Hour
+
+// StateStore хранит незавершённые диалоги создания и редактирования событий, по одному на чат.
+// Диалог, который не менялся дольше TTL, считается брошенным: LoadDialog его не возвращает.
+type StateStore interface {
+	// LoadDialog возвращает диалог чата или nil, если его нет или он устарел
+	LoadDialog(ctx context.Context, chatID int64) (*models.CreationState, error)
+	SaveDialog(ctx context.Context, chatID int64, state *models.CreationState) error
+	DeleteDialog(ctx context.Context, chatID int64) error
+	// DialogTTL — сколько диалог ждёт ответа, прежде чем считается брошенным
+	DialogTTL() time.Duration
+}
+
+// Store — хранилища, с которыми работают обработчики бота
+type Store interface {
+	EventRepository
+	StateStore
+}
+
+var _ Store = (*PgRepository)(nil)
+
+// storedState — models.CreationState в виде JSON для колонки dialog_states.state.
+// Часовой пояс хранится по имени, правило повторения — строкой RRULE.
+type storedState struct {
+	Cursor          dialog.Cursor     `json:"cursor"`
+	SelectedDate    time.Time         `json:"selected_date"`
+	SelectedStart   time.Time         `json:"selected_start"`
+	Duration        time.Duration     `json:"duration"`
+	Reminders       []time.Duration   `json:"reminders"`
+	RRule           string            `json:"rrule,omitempty"`
+	Nag             *models.NagPolicy `json:"nag,omitempty"`
+	Title           string            `json:"title"`
+	MessageID       int               `json:"message_id"`
+	Location        string            `json:"location,omitempty"`
+	CalendarMonth   time.Time         `json:"calendar_month"`
+	EditEventID     int               `json:"edit_event_id,omitempty"`
+	EditScope       string            `json:"edit_scope,omitempty"`
+	OccurrenceStart time.Time         `json:"occurrence_start"`
+	EditField       string            `json:"edit_field,omitempty"`
+}
+
+func encodeState(state *models.CreationState) ([]byte, error) {
+	s := storedState{
+		Cursor:          state.Cursor,
+		SelectedDate:    state.SelectedDate,
+		SelectedStart:   state.SelectedStart,
+		Duration:        state.Duration,
+		Reminders:       state.Reminders,
+		Nag:             state.Nag,
+		Title:           state.Title,
+		MessageID:       state.MessageID,
+		EditEventID:     state.EditEventID,
+		EditScope:       state.EditScope,
+		OccurrenceStart: state.OccurrenceStart,
+		EditField:       state.EditField,
+		CalendarMonth:   state.CalendarMonth,
+	}
+	if state.Recurrence != nil {
+		s.RRule = state.Recurrence.String()
+	}
+	if state.Location != nil {
+		s.Location = state.Location.String()
+	}
+	return json.Marshal(s)
+}
+
+// decodeState восстанавливает состояние; время переводится обратно в пояс диалога
+func decodeState(data []byte) (*models.CreationState, error) {
+	var s storedState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	state := &models.CreationState{
+		Cursor:      s.Cursor,
+		Duration:    s.Duration,
+		Reminders:   s.Reminders,
+		Nag:         s.Nag,
+		Title:       s.Title,
+		MessageID:   s.MessageID,
+		EditEventID: s.EditEventID,
+		EditScope:   s.EditScope,
+		EditField:   s.EditField,
+	}
+	if s.RRule != "" {
+		rule, err := recurrence.Parse(s.RRule)
+		if err != nil {
+			return nil, err
+		}
+		state.Recurrence = rule
+	}
+
+	loc := DefaultLocation
+	if s.Location != "" {
+		loc = locationOrDefault(&s.Location)
+		state.Location = loc
+	}
+	inLoc := func(t time.Time) time.Time {
+		if t.IsZero() {
+			return time.Time{}
+		}
+		return t.In(loc)
+	}
+	state.SelectedDate = inLoc(s.SelectedDate)
+	state.SelectedStart = inLoc(s.SelectedStart)
+	state.OccurrenceStart = inLoc(s.OccurrenceStart)
+	state.CalendarMonth = inLoc(s.CalendarMonth)
+	return state, nil
+}
+
+// LoadDialog возвращает незавершённый диалог чата, если он менялся не раньше чем dialogTTL назад
+func (repo *PgRepository) LoadDialog(ctx context.Context, chatID int64) (*models.CreationState, error) {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	var data []byte
+	err := repo.pool.QueryRow(ctx, `
+SELECT state FROM dialog_states
+WHERE chat_id = $1 AND updated_at > now() - $2 * INTERVAL '1 second'
+`, chatID, repo.dialogTTL.Seconds()).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeState(data)
+}
+
+// SaveDialog сохраняет диалог чата и заодно удаляет брошенные диалоги всех чатов
+func (repo *PgRepository) SaveDialog(ctx context.Context, chatID int64, state *models.CreationState) error {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	data, err := encodeState(state)
+	if err != nil {
+		return err
+	}
+	_, err = repo.pool.Exec(ctx, `
+INSERT INTO dialog_states (chat_id, state, updated_at)
+VALUES ($1, $2, now())
+ON CONFLICT (chat_id) DO UPDATE SET state = EXCLUDED.state, updated_at = EXCLUDED.updated_at
+`, chatID, data)
+	if err != nil {
+		return err
+	}
+	_, err = repo.pool.Exec(ctx, `
+DELETE FROM dialog_states WHERE updated_at <= now() - $1 * INTERVAL '1 second'
+`, repo.dialogTTL.Seconds())
+	return err
+}
+
+// DialogTTL возвращает время жизни брошенного диалога (настройка dialog_ttl)
+func (repo *PgRepository) DialogTTL() time.Duration {
+	return repo.dialogTTL
+}
+
+// DeleteDialog завершает диалог чата
+func (repo *PgRepository) DeleteDialog(ctx context.Context, chatID int64) error {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	_, err := repo.pool.Exec(ctx, `DELETE FROM dialog_states WHERE chat_id = $1`, chatID)
+	return err
+}
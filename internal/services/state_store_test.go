@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/natindo/CalVigil/internal/dialog"
+	"github.com/natindo/CalVigil/internal/models"
+	"github.com/natindo/CalVigil/internal/recurrence"
+)
+
+func TestStateRoundTrip(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	rule, err := recurrence.Parse("FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, 3, 30, 9, 30, 0, 0, berlin)
+	in := &models.CreationState{
+		Cursor:        dialog.Cursor{Dialog: "follow", Step: "title", History: []string{"date", "time"}, Touched: start},
+		SelectedDate:  time.Date(2025, 3, 30, 0, 0, 0, 0, berlin),
+		SelectedStart: start,
+		Duration:      90 * time.Minute,
+		Reminders:     []time.Duration{24 * time.Hour, 10 * time.Minute},
+		Recurrence:    rule,
+		Nag:           &models.NagPolicy{Interval: 5 * time.Minute, MaxRepeats: 6},
+		Title:         "Планёрка",
+		MessageID:     42,
+		Location:      berlin,
+		EditEventID:   7,
+		EditScope:     ScopeFollowing,
+		EditField:     "title",
+	}
+
+	data, err := encodeState(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := decodeState(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Location == nil || out.Location.String() != "Europe/Berlin" {
+		t.Errorf("Location = %v, ожидался %v", out.Location, berlin)
+	}
+	if !out.SelectedStart.Equal(start) || out.SelectedStart.Hour() != 9 {
+		t.Errorf("SelectedStart = %v", out.SelectedStart)
+	}
+	if !out.OccurrenceStart.IsZero() {
+		t.Errorf("OccurrenceStart = %v, ожидалось нулевое время", out.OccurrenceStart)
+	}
+	if out.Recurrence == nil || out.Recurrence.String() != rule.String() {
+		t.Errorf("Recurrence = %v", out.Recurrence)
+	}
+	if out.Nag == nil || *out.Nag != *in.Nag {
+		t.Errorf("Nag = %+v", out.Nag)
+	}
+	if out.Cursor.Step != "title" || len(out.Cursor.History) != 2 || !out.Cursor.Touched.Equal(start) {
+		t.Errorf("Cursor = %+v", out.Cursor)
+	}
+	if out.Duration != in.Duration || out.Title != in.Title ||
+		out.MessageID != in.MessageID || out.EditEventID != in.EditEventID ||
+		out.EditScope != in.EditScope || out.EditField != in.EditField ||
+		len(out.Reminders) != 2 || out.Reminders[1] != 10*time.Minute {
+		t.Errorf("состояние изменилось: %+v", out)
+	}
+}
+
+func TestStateWithoutLocation(t *testing.T) {
+	data, err := encodeState(&models.CreationState{Cursor: dialog.Cursor{Dialog: "create", Step: "date"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := decodeState(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Cursor.Step != "date" || out.Location != nil || out.Recurrence != nil || out.Nag != nil || !out.SelectedDate.IsZero() || !out.CalendarMonth.IsZero() {
+		t.Errorf("пустое состояние восстановлено как %+v", out)
+	}
+}
+
+func TestDialogStore(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	chatID := -time.Now().UnixNano()
+	t.Cleanup(func() { repo.DeleteDialog(context.Background(), chatID) })
+
+	if state, err := repo.LoadDialog(ctx, chatID); err != nil || state != nil {
+		t.Fatalf("LoadDialog без диалога = %v, %v", state, err)
+	}
+	if err := repo.SaveDialog(ctx, chatID, &models.CreationState{Cursor: dialog.Cursor{Step: "duration"}, Title: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	state, err := repo.LoadDialog(ctx, chatID)
+	if err != nil || state == nil || state.Cursor.Step != "duration" {
+		t.Fatalf("LoadDialog = %+v, %v", state, err)
+	}
+
+	// Брошенный диалог не возвращается
+	short := NewPgRepository(repo.pool, 0, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	if state, err := short.LoadDialog(ctx, chatID); err != nil || state != nil {
+		t.Fatalf("устаревший диалог = %+v, %v", state, err)
+	}
+
+	if err := repo.DeleteDialog(ctx, chatID); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := repo.LoadDialog(ctx, chatID); state != nil {
+		t.Fatal("диалог не удалён")
+	}
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultLocation — часовой пояс чатов, которые не выбрали свой через /timezone
+var DefaultLocation = time.Local
+
+// timezoneAliases — короткие названия для /timezone, помимо имён из базы IANA
+var timezoneAliases = map[string]string{
+	"москва": "Europe/Moscow", "мск": "Europe/Moscow", "moscow": "Europe/Moscow", "msk": "Europe/Moscow",
+	"берлин": "Europe/Berlin", "berlin": "Europe/Berlin",
+	"алматы": "Asia/Almaty", "almaty": "Asia/Almaty",
+	"utc": "UTC",
+}
+
+// locations кэширует загруженные часовые пояса по имени
+var locations sync.Map
+
+// ParseTimezone разбирает имя часового пояса IANA ("Europe/Berlin") или короткое название ("москва").
+func ParseTimezone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if alias, ok := timezoneAliases[strings.ToLower(name)]; ok {
+		name = alias
+	}
+	// Пустое имя и "Local" LoadLocation понимает как UTC и пояс сервера — для чата это не выбор
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("неизвестный часовой пояс %q", name)
+	}
+	loc, err := loadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("неизвестный часовой пояс %q", name)
+	}
+	return loc, nil
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// locationOrDefault возвращает пояс по имени из chat_settings (NULL — пояс по умолчанию)
+func locationOrDefault(name *string) *time.Location {
+	if name == nil {
+		return DefaultLocation
+	}
+	loc, err := loadLocation(*name)
+	if err != nil {
+		return DefaultLocation
+	}
+	return loc
+}
+
+// ChatLocation возвращает часовой пояс чата: в нём вводятся и показываются даты,
+// считаются границы «сегодня» и разворачиваются повторяющиеся события.
+func (repo *PgRepository) ChatLocation(ctx context.Context, chatID int64) (*time.Location, error) {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	var name *string
+	err := repo.pool.QueryRow(ctx, `
+SELECT timezone FROM chat_settings WHERE chat_id = $1
+`, chatID).Scan(&name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DefaultLocation, nil
+	}
+	if err != nil {
+		return DefaultLocation, err
+	}
+	return locationOrDefault(name), nil
+}
+
+// SetChatTimezone сохраняет часовой пояс чата.
+// Время событий хранится в UTC, поэтому смена пояса меняет только отображение
+// и ввод; повторяющиеся серии дальше разворачиваются по местному времени нового пояса.
+func (repo *PgRepository) SetChatTimezone(ctx context.Context, chatID int64, loc *time.Location) error {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+
+	_, err := repo.pool.Exec(ctx, `
+INSERT INTO chat_settings (chat_id, timezone)
+VALUES ($1, $2)
+ON CONFLICT (chat_id) DO UPDATE SET timezone = EXCLUDED.timezone
+`, chatID, loc.String())
+	return err
+}
+
+// DayBounds возвращает начало суток, в которые попадает t, и начало следующих суток
+// в поясе t. В дни перехода на летнее/зимнее время сутки длятся 23 или 25 часов.
+func DayBounds(t time.Time) (time.Time, time.Time) {
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return start, start.AddDate(0, 0, 1)
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skip("нет базы часовых поясов:", err)
+	}
+	return loc
+}
+
+func TestParseTimezone(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Europe/Berlin", "Europe/Berlin"},
+		{" Asia/Almaty ", "Asia/Almaty"},
+		{"москва", "Europe/Moscow"},
+		{"Берлин", "Europe/Berlin"},
+		{"UTC", "UTC"},
+		{"utc", "UTC"},
+	}
+	mustLoad(t, "Europe/Berlin")
+	for _, tt := range tests {
+		loc, err := ParseTimezone(tt.in)
+		if err != nil {
+			t.Errorf("ParseTimezone(%q): %v", tt.in, err)
+			continue
+		}
+		if loc.String() != tt.want {
+			t.Errorf("ParseTimezone(%q) = %s, want %s", tt.in, loc, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "Local", "Mars/Olympus", "+03:00"} {
+		if _, err := ParseTimezone(in); err == nil {
+			t.Errorf("ParseTimezone(%q): want error", in)
+		}
+	}
+}
+
+func TestDayBounds(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	moscow := mustLoad(t, "Europe/Moscow")
+	almaty := mustLoad(t, "Asia/Almaty")
+
+	tests := []struct {
+		name   string
+		t      time.Time
+		length time.Duration
+	}{
+		{"Берлин, переход на летнее время", time.Date(2025, time.March, 30, 12, 0, 0, 0, berlin), 23 * time.Hour},
+		{"Берлин, переход на зимнее время", time.Date(2025, time.October, 26, 12, 0, 0, 0, berlin), 25 * time.Hour},
+		{"Берлин, обычный день", time.Date(2025, time.March, 29, 12, 0, 0, 0, berlin), 24 * time.Hour},
+		{"Москва в тот же день", time.Date(2025, time.March, 30, 12, 0, 0, 0, moscow), 24 * time.Hour},
+		{"Алматы в тот же день", time.Date(2025, time.October, 26, 12, 0, 0, 0, almaty), 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to := DayBounds(tt.t)
+			if from.Hour() != 0 || from.Minute() != 0 || from.Day() != tt.t.Day() {
+				t.Errorf("from = %v, want local midnight of %v", from, tt.t)
+			}
+			if to.Hour() != 0 || to.Day() == from.Day() {
+				t.Errorf("to = %v, want next local midnight", to)
+			}
+			if got := to.Sub(from); got != tt.length {
+				t.Errorf("day length = %v, want %v", got, tt.length)
+			}
+		})
+	}
+}
+
+func TestDayBoundsPerChat(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	almaty := mustLoad(t, "Asia/Almaty")
+
+	// Один и тот же момент — 22:30 UTC — в Берлине ещё 15 января, в Алматы уже 16-е
+	now := time.Date(2025, time.January, 15, 22, 30, 0, 0, time.UTC)
+
+	fromBerlin, _ := DayBounds(now.In(berlin))
+	fromAlmaty, _ := DayBounds(now.In(almaty))
+	if fromBerlin.Day() != 15 || fromAlmaty.Day() != 16 {
+		t.Fatalf("today: Berlin %v, Almaty %v", fromBerlin, fromAlmaty)
+	}
+	if want := time.Date(2025, time.January, 14, 23, 0, 0, 0, time.UTC); !fromBerlin.Equal(want) {
+		t.Errorf("Berlin start of day = %v, want %v", fromBerlin.UTC(), want)
+	}
+}
+
+func TestLocationOrDefault(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	name := "Europe/Berlin"
+	if got := locationOrDefault(&name); got.String() != berlin.String() {
+		t.Errorf("locationOrDefault(Europe/Berlin) = %v", got)
+	}
+	if got := locationOrDefault(nil); got != DefaultLocation {
+		t.Errorf("locationOrDefault(nil) = %v, want default", got)
+	}
+	bad := "Nowhere/Void"
+	if got := locationOrDefault(&bad); got != DefaultLocation {
+		t.Errorf("locationOrDefault(bad) = %v, want default", got)
+	}
+}
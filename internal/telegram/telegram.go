@@ -0,0 +1,140 @@
+// Package telegram — адаптер Bot API: Messenger поверх tgbotapi, приём апдейтов
+// long polling-ом или вебхуком и перевод их в апдейты ядра (messenger.Update).
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/natindo/CalVigil/internal/bot"
+	"github.com/natindo/CalVigil/internal/messenger"
+	"github.com/natindo/CalVigil/internal/services"
+)
+
+// NewBot подключается к Bot API с токеном token
+func NewBot(token string) (*tgbotapi.BotAPI, error) {
+	api, err := tgbotapi.NewBotAPI(token)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Бот %s успешно инициализирован\n", api.Self.UserName)
+	return api, nil
+}
+
+// Run запускает bot.Serve поверх Bot API: апдейты приходят через вебхук,
+// если webhook не nil, иначе long polling-ом.
+func Run(ctx context.Context, api *tgbotapi.BotAPI, repo services.Store, opts bot.Options, webhook *WebhookOptions) error {
+	receive := func(ctx context.Context, dispatch func(messenger.Update) bool) error {
+		if webhook != nil {
+			return serveWebhook(ctx, api, *webhook, dispatch)
+		}
+		pollUpdates(ctx, api, dispatch)
+		return nil
+	}
+	return bot.Serve(ctx, NewMessenger(api), repo, opts, receive)
+}
+
+// Messenger — messenger.Messenger поверх Bot API
+type Messenger struct {
+	api *tgbotapi.BotAPI
+}
+
+var _ messenger.Messenger = (*Messenger)(nil)
+
+// NewMessenger оборачивает клиент Bot API
+func NewMessenger(api *tgbotapi.BotAPI) *Messenger {
+	return &Messenger{api: api}
+}
+
+func (t *Messenger) SendMessage(chatID int64, text string, keyboard messenger.Keyboard) (int, error) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	if keyboard != nil {
+		msg.ReplyMarkup = inlineKeyboard(keyboard)
+	}
+	sent, err := t.api.Send(msg)
+	if err != nil {
+		return 0, wrapError(err)
+	}
+	return sent.MessageID, nil
+}
+
+func (t *Messenger) EditMessage(chatID int64, messageID int, text string, keyboard messenger.Keyboard) error {
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	if keyboard != nil {
+		markup := inlineKeyboard(keyboard)
+		edit.ReplyMarkup = &markup
+	}
+	_, err := t.api.Send(edit)
+	if err != nil && strings.Contains(err.Error(), "message is not modified") {
+		return nil
+	}
+	return wrapError(err)
+}
+
+func (t *Messenger) AnswerCallback(callbackID, text string) error {
+	_, err := t.api.Request(tgbotapi.NewCallback(callbackID, text))
+	return err
+}
+
+func (t *Messenger) SetCommands(commands []messenger.Command) error {
+	list := make([]tgbotapi.BotCommand, 0, len(commands))
+	for _, c := range commands {
+		list = append(list, tgbotapi.BotCommand{Command: c.Name, Description: c.Description})
+	}
+	_, err := t.api.Request(tgbotapi.NewSetMyCommands(list...))
+	return err
+}
+
+// wrapError добавляет к ответу 403 (бот заблокирован или удалён из чата)
+// messenger.ErrForbidden; исходная *tgbotapi.Error остаётся доступна через errors.As
+func wrapError(err error) error {
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden {
+		return fmt.Errorf("%w: %w", messenger.ErrForbidden, err)
+	}
+	return err
+}
+
+// inlineKeyboard переводит клавиатуру ядра в inline-клавиатуру Telegram
+func inlineKeyboard(keyboard messenger.Keyboard) tgbotapi.InlineKeyboardMarkup {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(keyboard))
+	for _, row := range keyboard {
+		buttons := make([]tgbotapi.InlineKeyboardButton, 0, len(row))
+		for _, b := range row {
+			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(b.Text, b.Data))
+		}
+		rows = append(rows, buttons)
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// convertUpdate переводит апдейт Telegram в апдейт ядра. Апдейты, на которые бот
+// не отвечает (правки сообщений, посты каналов, нажатия в inline-режиме без
+// сообщения), отбрасываются: ok = false.
+func convertUpdate(update tgbotapi.Update) (messenger.Update, bool) {
+	switch {
+	case update.Message != nil:
+		msg := update.Message
+		return messenger.Update{Message: &messenger.Message{
+			ID:      msg.MessageID,
+			ChatID:  msg.Chat.ID,
+			Text:    msg.Text,
+			Private: msg.Chat.IsPrivate(),
+		}}, true
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		cq := update.CallbackQuery
+		return messenger.Update{Callback: &messenger.Callback{
+			ID:          cq.ID,
+			ChatID:      cq.Message.Chat.ID,
+			MessageID:   cq.Message.MessageID,
+			MessageText: cq.Message.Text,
+			Data:        cq.Data,
+		}}, true
+	}
+	return messenger.Update{}, false
+}
@@ -0,0 +1,115 @@
+package telegram
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+	"github.com/natindo/CalVigil/internal/telegramtest"
+)
+
+func TestMessenger(t *testing.T) {
+	srv := telegramtest.NewServer(t)
+	tg := NewMessenger(srv.Bot(t))
+
+	keyboard := messenger.NewKeyboard(messenger.NewRow(
+		messenger.NewButton("Понятно", "ack:1:0"),
+	))
+	id, err := tg.SendMessage(42, "Напоминание", keyboard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := srv.Messages(42)
+	if len(msgs) != 1 || msgs[0].ID != id || msgs[0].Text != "Напоминание" || len(msgs[0].Buttons()) != 1 {
+		t.Fatalf("отправлено: %+v", msgs)
+	}
+
+	// Та же правка повторно — «message is not modified», это не ошибка
+	for i := 0; i < 2; i++ {
+		if err := tg.EditMessage(42, id, "Напоминание\n\nПонятно", nil); err != nil {
+			t.Fatalf("правка %d: %v", i+1, err)
+		}
+	}
+	if m := srv.Messages(42)[0]; !m.Edited || m.Keyboard != nil {
+		t.Errorf("после правки: %+v", m)
+	}
+	if err := tg.EditMessage(42, id+100, "x", nil); err == nil {
+		t.Error("правка несуществующего сообщения прошла без ошибки")
+	}
+
+	if err := tg.AnswerCallback("cq1", "Готово"); err != nil {
+		t.Fatal(err)
+	}
+	if calls := srv.Calls("answerCallbackQuery"); len(calls) != 1 || calls[0].Params.Get("text") != "Готово" {
+		t.Errorf("answerCallbackQuery: %+v", calls)
+	}
+	if err := tg.SetCommands([]messenger.Command{{Name: "help", Description: "Справка"}}); err != nil {
+		t.Fatal(err)
+	}
+	if calls := srv.Calls("setMyCommands"); len(calls) != 1 ||
+		calls[0].Params.Get("commands") != `[{"command":"help","description":"Справка"}]` {
+		t.Errorf("setMyCommands: %+v", calls)
+	}
+}
+
+func TestMessengerError(t *testing.T) {
+	srv := telegramtest.NewServer(t)
+	tg := NewMessenger(srv.Bot(t))
+
+	srv.Fail("sendMessage", http.StatusForbidden, "Forbidden: bot was blocked by the user")
+	_, err := tg.SendMessage(42, "привет", nil)
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusForbidden || !errors.Is(err, messenger.ErrForbidden) {
+		t.Fatalf("SendMessage = %v, ожидалась ошибка 403", err)
+	}
+	if _, err := tg.SendMessage(42, "привет", nil); err != nil {
+		t.Errorf("ошибка не разовая: %v", err)
+	}
+
+	// Временная ошибка не считается запретом
+	srv.Fail("sendMessage", http.StatusTooManyRequests, "Too Many Requests: retry after 5")
+	if _, err := tg.SendMessage(42, "привет", nil); err == nil || errors.Is(err, messenger.ErrForbidden) {
+		t.Errorf("SendMessage = %v, ожидалась временная ошибка", err)
+	}
+}
+
+func TestConvertUpdate(t *testing.T) {
+	cq := tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:   "cq1",
+		From: &tgbotapi.User{ID: 7},
+		Message: &tgbotapi.Message{
+			MessageID: 11,
+			Chat:      &tgbotapi.Chat{ID: -100, Type: "supergroup"},
+			Text:      "Выберите дату",
+		},
+		Data: "cal:day:2025-01-15",
+	}}
+	u, ok := convertUpdate(cq)
+	want := messenger.Callback{ID: "cq1", ChatID: -100, MessageID: 11, MessageText: "Выберите дату", Data: "cal:day:2025-01-15"}
+	if !ok || u.Callback == nil || *u.Callback != want || u.ChatID() != -100 {
+		t.Errorf("callback: %+v", u.Callback)
+	}
+
+	msg := tgbotapi.Update{Message: &tgbotapi.Message{
+		MessageID: 10,
+		Chat:      &tgbotapi.Chat{ID: 42, Type: "private"},
+		Text:      "/add@CalVigilBot завтра созвон",
+	}}
+	u, ok = convertUpdate(msg)
+	if !ok || u.Message == nil || !u.Message.Private || u.Message.Command() != "add" ||
+		u.Message.CommandArguments() != "завтра созвон" {
+		t.Errorf("сообщение: %+v", u.Message)
+	}
+
+	// Нажатие в inline-режиме приходит без сообщения и чата — бот таких не отправляет
+	inline := tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{From: &tgbotapi.User{ID: 7}}}
+	edited := tgbotapi.Update{EditedMessage: msg.Message}
+	for _, u := range []tgbotapi.Update{inline, edited} {
+		if _, ok := convertUpdate(u); ok {
+			t.Errorf("апдейт принят: %+v", u)
+		}
+	}
+}
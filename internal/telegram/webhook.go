@@ -0,0 +1,149 @@
+package telegram
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+)
+
+// secretTokenHeader — заголовок, в котором Telegram присылает secret_token вебхука
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// maxUpdateSize ограничивает тело запроса вебхука; апдейты намного меньше
+const maxUpdateSize = 1 << 20
+
+// WebhookOptions — приём апдейтов через вебхук вместо long polling.
+// Без CertFile/KeyFile сервер слушает обычный HTTP: TLS завершается на reverse proxy,
+// который проксирует URL на Listen.
+type WebhookOptions struct {
+	// URL — публичный https-адрес, который регистрируется в Telegram;
+	// его путь — путь обработчика на локальном сервере
+	URL string
+	// Listen — адрес локального HTTP-сервера, например ":8080"
+	Listen string
+	// SecretToken — секрет, который Telegram присылает в каждом запросе; пусто — без проверки
+	SecretToken string
+	// CertFile и KeyFile — сертификат и ключ, если TLS завершается самим ботом
+	CertFile string
+	KeyFile  string
+}
+
+// serveWebhook регистрирует вебхук в Telegram и принимает апдейты, пока не отменён ctx.
+// Принятые апдейты передаются в dispatch — тот же путь, что и при long polling.
+func serveWebhook(ctx context.Context, bot *tgbotapi.BotAPI, opts WebhookOptions, dispatch func(messenger.Update) bool) error {
+	link, err := url.Parse(opts.URL)
+	if err != nil {
+		return fmt.Errorf("адрес вебхука: %w", err)
+	}
+	path := link.Path
+	if path == "" {
+		path = "/"
+	}
+
+	params := tgbotapi.Params{"url": link.String()}
+	params.AddNonEmpty("secret_token", opts.SecretToken)
+	if _, err := bot.MakeRequest("setWebhook", params); err != nil {
+		return fmt.Errorf("setWebhook: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, webhookHandler(opts.SecretToken, dispatch))
+	srv := &http.Server{
+		Addr:              opts.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		if opts.CertFile != "" {
+			errc <- srv.ListenAndServeTLS(opts.CertFile, opts.KeyFile)
+		} else {
+			errc <- srv.ListenAndServe()
+		}
+	}()
+	log.Printf("Вебхук %s, сервер слушает %s", link.Redacted(), opts.Listen)
+
+	select {
+	case err := <-errc:
+		return fmt.Errorf("сервер вебхука: %w", err)
+	case <-ctx.Done():
+	}
+
+	// Вебхук в Telegram не снимается: пока бот остановлен, апдейты копятся на стороне Telegram
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("остановка сервера вебхука: %w", err)
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// webhookHandler принимает POST с апдейтом в JSON. Запрос без верного секрета
+// отклоняется; если бот уже останавливается, отвечает 503, и Telegram повторит апдейт позже.
+// Апдейты, на которые бот не отвечает, подтверждаются без обработки.
+func webhookHandler(secretToken string, dispatch func(messenger.Update) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if secretToken != "" &&
+			subtle.ConstantTimeCompare([]byte(r.Header.Get(secretTokenHeader)), []byte(secretToken)) != 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		var update tgbotapi.Update
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUpdateSize)).Decode(&update); err != nil {
+			http.Error(w, "bad update", http.StatusBadRequest)
+			return
+		}
+		if u, ok := convertUpdate(update); ok && !dispatch(u) {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// pollUpdates получает апдейты long polling-ом, пока не отменён ctx.
+// Вебхук, оставшийся от запуска в режиме вебхука, снимается: иначе getUpdates не работает.
+func pollUpdates(ctx context.Context, bot *tgbotapi.BotAPI, dispatch func(messenger.Update) bool) {
+	if _, err := bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		log.Println("Не удалось снять вебхук:", err)
+	}
+
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 60
+	updates := bot.GetUpdatesChan(u)
+	defer bot.StopReceivingUpdates()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			if u, ok := convertUpdate(update); ok {
+				dispatch(u)
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package telegram
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/natindo/CalVigil/internal/messenger"
+)
+
+func postFixture(t *testing.T, srv *httptest.Server, name, secret string) *http.Response {
+	t.Helper()
+	body, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/telegram", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(secretTokenHeader, secret)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestWebhookDispatchesFixtures(t *testing.T) {
+	var mu sync.Mutex
+	var got []messenger.Update
+	dispatch := func(u messenger.Update) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, u)
+		return true
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/telegram", webhookHandler("s3cret_token", dispatch))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for _, name := range []string{"message_update.json", "callback_update.json"} {
+		if resp := postFixture(t, srv, name, "s3cret_token"); resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: статус %d", name, resp.StatusCode)
+		}
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("обработано апдейтов: %d", len(got))
+	}
+	if msg := got[0].Message; msg == nil || msg.Command() != "today" || msg.ChatID != 42 || !msg.Private {
+		t.Errorf("сообщение: %+v", msg)
+	}
+	if cq := got[1].Callback; cq == nil || cq.Data != "cal:day:2025-01-15" || cq.ChatID != -1001234567890 ||
+		cq.MessageID != 11 {
+		t.Errorf("callback: %+v", cq)
+	}
+}
+
+func TestWebhookRejects(t *testing.T) {
+	dispatched := 0
+	handler := webhookHandler("s3cret_token", func(messenger.Update) bool {
+		dispatched++
+		return true
+	})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		secret string
+		body   string
+		want   int
+	}{
+		{"без секрета", http.MethodPost, "", `{"update_id":1}`, http.StatusForbidden},
+		{"чужой секрет", http.MethodPost, "wrong", `{"update_id":1}`, http.StatusForbidden},
+		{"GET", http.MethodGet, "s3cret_token", "", http.StatusMethodNotAllowed},
+		{"не JSON", http.MethodPost, "s3cret_token", "{", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, srv.URL, strings.NewReader(tt.body))
+		if tt.secret != "" {
+			req.Header.Set(secretTokenHeader, tt.secret)
+		}
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: статус %d, ожидался %d", tt.name, resp.StatusCode, tt.want)
+		}
+	}
+	if dispatched != 0 {
+		t.Errorf("отклонённые запросы переданы в обработку: %d", dispatched)
+	}
+}
+
+func TestWebhookDuringShutdown(t *testing.T) {
+	// Так отвечает dispatch диспетчера после Shutdown
+	stopped := func(messenger.Update) bool { return false }
+
+	mux := http.NewServeMux()
+	mux.Handle("/telegram", webhookHandler("", stopped))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// Telegram повторит апдейт, который не принят из-за остановки
+	if resp := postFixture(t, srv, "message_update.json", ""); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("статус %d, ожидался 503", resp.StatusCode)
+	}
+}
@@ -0,0 +1,404 @@
+// Package telegramtest — поддельный сервер Bot API для тестов. Он отвечает на запросы
+// tgbotapi так же, как Telegram, записывает их и хранит переписку с каждым чатом, а
+// апдейты от имени пользователя ставятся в очередь и отдаются через getUpdates.
+package telegramtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Token — токен, с которым клиент обращается к серверу
+const Token = "123456:TEST"
+
+// BotUserName — имя бота, которое возвращает getMe
+const BotUserName = "calvigil_test_bot"
+
+// Call — один запрос к Bot API
+type Call struct {
+	Method string
+	Params url.Values
+}
+
+// Message — сообщение бота в чате в его текущем виде, с учётом правок
+type Message struct {
+	ID       int
+	ChatID   int64
+	Text     string
+	Keyboard *tgbotapi.InlineKeyboardMarkup
+	Edited   bool
+}
+
+// Buttons — подписи кнопок сообщения по порядку
+func (m Message) Buttons() []string {
+	var labels []string
+	if m.Keyboard == nil {
+		return nil
+	}
+	for _, row := range m.Keyboard.InlineKeyboard {
+		for _, b := range row {
+			labels = append(labels, b.Text)
+		}
+	}
+	return labels
+}
+
+// apiError — ответ с ошибкой, который сервер вернёт вместо очередного вызова метода
+type apiError struct {
+	code        int
+	description string
+}
+
+// Server — поддельный Bot API. Методы безопасны для вызова из нескольких горутин.
+type Server struct {
+	srv  *httptest.Server
+	done chan struct{}
+
+	mu       sync.Mutex
+	calls    []Call
+	messages []*Message
+	failures map[string][]apiError
+	updates  []tgbotapi.Update
+	lastID   int
+	// wake закрывается, когда в очереди появляется апдейт
+	wake chan struct{}
+}
+
+// NewServer запускает сервер; он останавливается вместе с тестом
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		done:     make(chan struct{}),
+		failures: map[string][]apiError{},
+		wake:     make(chan struct{}),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Close останавливает сервер, прерывая ожидающие getUpdates
+func (s *Server) Close() {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	close(s.done)
+	s.srv.Close()
+}
+
+// Endpoint — шаблон адреса для tgbotapi.NewBotAPIWithAPIEndpoint
+func (s *Server) Endpoint() string {
+	return s.srv.URL + "/bot%s/%s"
+}
+
+// Bot возвращает клиент Bot API, подключённый к серверу
+func (s *Server) Bot(t testing.TB) *tgbotapi.BotAPI {
+	t.Helper()
+	api, err := tgbotapi.NewBotAPIWithAPIEndpoint(Token, s.Endpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api
+}
+
+// Calls возвращает записанные запросы метода; пустой method — все запросы
+func (s *Server) Calls(method string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calls []Call
+	for _, c := range s.calls {
+		if method == "" || c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Messages возвращает сообщения бота в чате в порядке отправки
+func (s *Server) Messages(chatID int64) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var msgs []Message
+	for _, m := range s.messages {
+		if m.ChatID == chatID {
+			msgs = append(msgs, *m)
+		}
+	}
+	return msgs
+}
+
+// WaitMessage ждёт, пока в чате появится сообщение, для которого match вернёт true, и
+// возвращает последнее такое сообщение. Через timeout тест завершается с ошибкой.
+func (s *Server) WaitMessage(t testing.TB, chatID int64, timeout time.Duration, match func(Message) bool) Message {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		msgs := s.Messages(chatID)
+		for i := len(msgs) - 1; i >= 0; i-- {
+			if match(msgs[i]) {
+				return msgs[i]
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("за %s в чате %d не появилось ожидаемого сообщения; сообщения: %s",
+				timeout, chatID, describe(msgs))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Fail заставляет следующий вызов method вернуть ошибку Bot API с кодом code
+func (s *Server) Fail(method string, code int, description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = append(s.failures[method], apiError{code: code, description: description})
+}
+
+// Text строит апдейт с сообщением пользователя в личном чате chatID; текст,
+// начинающийся с «/», размечается как команда
+func (s *Server) Text(chatID int64, text string) tgbotapi.Update {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	msg := &tgbotapi.Message{
+		MessageID: s.lastID,
+		From:      user(chatID),
+		Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+	}
+	if strings.HasPrefix(text, "/") {
+		command, _, _ := strings.Cut(text, " ")
+		msg.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+	}
+	return tgbotapi.Update{UpdateID: s.lastID, Message: msg}
+}
+
+// Press строит апдейт нажатия кнопки с подписью label под сообщением m
+func (s *Server) Press(m Message, label string) (tgbotapi.Update, error) {
+	if m.Keyboard != nil {
+		for _, row := range m.Keyboard.InlineKeyboard {
+			for _, b := range row {
+				if b.Text != label || b.CallbackData == nil {
+					continue
+				}
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				s.lastID++
+				return tgbotapi.Update{
+					UpdateID: s.lastID,
+					CallbackQuery: &tgbotapi.CallbackQuery{
+						ID:   strconv.Itoa(s.lastID),
+						From: user(m.ChatID),
+						Message: &tgbotapi.Message{
+							MessageID: m.ID,
+							Chat:      &tgbotapi.Chat{ID: m.ChatID, Type: "private"},
+							Text:      m.Text,
+						},
+						Data: *b.CallbackData,
+					},
+				}, nil
+			}
+		}
+	}
+	return tgbotapi.Update{}, fmt.Errorf("под сообщением %d нет кнопки %q, есть %q", m.ID, label, m.Buttons())
+}
+
+// Enqueue ставит апдейты в очередь getUpdates
+func (s *Server) Enqueue(updates ...tgbotapi.Update) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updates = append(s.updates, updates...)
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+func user(chatID int64) *tgbotapi.User {
+	return &tgbotapi.User{ID: chatID, FirstName: "Тест", UserName: "tester"}
+}
+
+func describe(msgs []Message) string {
+	var b strings.Builder
+	for _, m := range msgs {
+		fmt.Fprintf(&b, "\n#%d %q %q", m.ID, m.Text, m.Buttons())
+	}
+	if b.Len() == 0 {
+		return "нет"
+	}
+	return b.String()
+}
+
+// response — конверт ответа Bot API
+type response struct {
+	Ok          bool   `json:"ok"`
+	Result      any    `json:"result"`
+	ErrorCode   int    `json:"error_code,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	// Путь: /bot<токен>/<метод>
+	token, method, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/bot"), "/")
+	if !ok || token != Token {
+		writeResponse(w, http.StatusUnauthorized, response{ErrorCode: http.StatusUnauthorized, Description: "Unauthorized"})
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeResponse(w, http.StatusBadRequest, response{ErrorCode: http.StatusBadRequest, Description: err.Error()})
+		return
+	}
+
+	if method == "getUpdates" {
+		s.getUpdates(w, r.PostForm)
+		return
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, Call{Method: method, Params: r.PostForm})
+	if queue := s.failures[method]; len(queue) > 0 {
+		s.failures[method] = queue[1:]
+		s.mu.Unlock()
+		writeResponse(w, queue[0].code, response{ErrorCode: queue[0].code, Description: queue[0].description})
+		return
+	}
+	result, apiErr := s.handle(method, r.PostForm)
+	s.mu.Unlock()
+
+	if apiErr != nil {
+		writeResponse(w, apiErr.code, response{ErrorCode: apiErr.code, Description: apiErr.description})
+		return
+	}
+	writeResponse(w, http.StatusOK, response{Ok: true, Result: result})
+}
+
+// handle выполняет метод Bot API; вызывается под s.mu
+func (s *Server) handle(method string, params url.Values) (any, *apiError) {
+	switch method {
+	case "getMe":
+		return tgbotapi.User{ID: 123456, IsBot: true, FirstName: "CalVigil", UserName: BotUserName}, nil
+	case "sendMessage":
+		chatID, err := strconv.ParseInt(params.Get("chat_id"), 10, 64)
+		if err != nil {
+			return nil, &apiError{http.StatusBadRequest, "Bad Request: chat not found"}
+		}
+		keyboard, apiErr := parseKeyboard(params)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		s.lastID++
+		m := &Message{ID: s.lastID, ChatID: chatID, Text: params.Get("text"), Keyboard: keyboard}
+		s.messages = append(s.messages, m)
+		return m.toAPI(), nil
+	case "editMessageText":
+		m := s.find(params)
+		if m == nil {
+			return nil, &apiError{http.StatusBadRequest, "Bad Request: message to edit not found"}
+		}
+		keyboard, apiErr := parseKeyboard(params)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		text := params.Get("text")
+		if text == m.Text && sameKeyboard(keyboard, m.Keyboard) {
+			return nil, &apiError{http.StatusBadRequest, "Bad Request: message is not modified: " +
+				"specified new message content and reply markup are exactly the same as a current content " +
+				"and reply markup of the message"}
+		}
+		m.Text, m.Keyboard, m.Edited = text, keyboard, true
+		return m.toAPI(), nil
+	case "answerCallbackQuery", "setMyCommands", "deleteWebhook", "setWebhook":
+		return true, nil
+	}
+	return nil, &apiError{http.StatusNotFound, "Not Found: method " + method + " is not supported by telegramtest"}
+}
+
+// getUpdates отдаёт апдейты начиная с offset, ожидая их не дольше timeout секунд
+func (s *Server) getUpdates(w http.ResponseWriter, params url.Values) {
+	offset, _ := strconv.Atoi(params.Get("offset"))
+	timeout, _ := strconv.Atoi(params.Get("timeout"))
+	timer := time.NewTimer(time.Duration(timeout) * time.Second)
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		var pending []tgbotapi.Update
+		for _, u := range s.updates {
+			if u.UpdateID >= offset {
+				pending = append(pending, u)
+			}
+		}
+		wake := s.wake
+		s.mu.Unlock()
+
+		if len(pending) > 0 {
+			writeResponse(w, http.StatusOK, response{Ok: true, Result: pending})
+			return
+		}
+		select {
+		case <-wake:
+		case <-timer.C:
+			writeResponse(w, http.StatusOK, response{Ok: true, Result: []tgbotapi.Update{}})
+			return
+		case <-s.done:
+			writeResponse(w, http.StatusOK, response{Ok: true, Result: []tgbotapi.Update{}})
+			return
+		}
+	}
+}
+
+// find ищет сообщение по chat_id и message_id; вызывается под s.mu
+func (s *Server) find(params url.Values) *Message {
+	chatID, _ := strconv.ParseInt(params.Get("chat_id"), 10, 64)
+	id, _ := strconv.Atoi(params.Get("message_id"))
+	for _, m := range s.messages {
+		if m.ChatID == chatID && m.ID == id {
+			return m
+		}
+	}
+	return nil
+}
+
+func (m *Message) toAPI() tgbotapi.Message {
+	return tgbotapi.Message{
+		MessageID:   m.ID,
+		Chat:        &tgbotapi.Chat{ID: m.ChatID, Type: "private"},
+		Date:        int(time.Now().Unix()),
+		Text:        m.Text,
+		ReplyMarkup: m.Keyboard,
+	}
+}
+
+func parseKeyboard(params url.Values) (*tgbotapi.InlineKeyboardMarkup, *apiError) {
+	raw := params.Get("reply_markup")
+	if raw == "" {
+		return nil, nil
+	}
+	var keyboard tgbotapi.InlineKeyboardMarkup
+	if err := json.Unmarshal([]byte(raw), &keyboard); err != nil {
+		return nil, &apiError{http.StatusBadRequest, "Bad Request: can't parse reply keyboard markup JSON object"}
+	}
+	return &keyboard, nil
+}
+
+func sameKeyboard(a, b *tgbotapi.InlineKeyboardMarkup) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
+
+func writeResponse(w http.ResponseWriter, status int, resp response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}